@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"makeprofit/internal/config"
+	"makeprofit/internal/screenshot"
+	"makeprofit/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// shutdownTimeout 收到退出信号后等待进行中请求完成的最长时间
+const shutdownTimeout = 30 * time.Second
+
+func main() {
+	configPath := flag.String("config", "configs/config.yaml", "配置文件路径")
+	checkConfig := flag.Bool("check-config", false, "只加载并校验配置文件，输出各配置项的来源后退出")
+	flag.Parse()
+
+	if *checkConfig {
+		if err := config.Check(*configPath, os.Stdout); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := run(*configPath); err != nil {
+		fmt.Fprintf(os.Stderr, "screenshot-server: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(configPath string) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", configPath, err)
+	}
+
+	logger, err := utils.NewLogger(utils.LogConfig{
+		Level:         cfg.Logging.Level,
+		Format:        cfg.Logging.Format,
+		Output:        cfg.Logging.Output,
+		MaxSizeMB:     cfg.Logging.Rotation.MaxSizeMB,
+		MaxAgeDays:    cfg.Logging.Rotation.MaxAgeDays,
+		MaxBackups:    cfg.Logging.Rotation.MaxBackups,
+		Compress:      cfg.Logging.Rotation.Compress,
+		SyslogNetwork: cfg.Logging.Syslog.Network,
+		SyslogAddress: cfg.Logging.Syslog.Address,
+		SyslogTag:     cfg.Logging.Syslog.Tag,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create logger: %w", err)
+	}
+
+	service, err := screenshot.NewService(cfg, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create screenshot service: %w", err)
+	}
+	defer service.Close()
+
+	// 监听配置文件变化并热更新，失败时继续使用启动时的配置
+	if err := service.WatchConfig(configPath); err != nil {
+		logger.WithError(err).Warn("Failed to watch config file, hot reload is disabled")
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(gin.Recovery())
+	service.SetupRoutes(r)
+	setupWeb(r)
+
+	srv := &http.Server{
+		Addr:         net.JoinHostPort(cfg.Server.Host, strconv.Itoa(cfg.Server.Port)),
+		Handler:      r,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.WithField("addr", srv.Addr).Info("Screenshot server started")
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("failed to start server: %w", err)
+		}
+		return nil
+	case sig := <-quit:
+		logger.WithField("signal", sig.String()).Info("Shutting down screenshot server")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to shut down server: %w", err)
+	}
+	return nil
+}
+
+// setupWeb 提供首页和静态文件，web目录不存在时（如只部署了二进制）跳过
+func setupWeb(r *gin.Engine) {
+	if _, err := os.Stat("web/templates/index.html"); err != nil {
+		return
+	}
+
+	r.LoadHTMLGlob("web/templates/*")
+	r.Static("/static", "web/static")
+	r.GET("/", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "index.html", gin.H{"title": "股票截图服务"})
+	})
+}
@@ -0,0 +1,125 @@
+package apierror
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Code 机器可读的错误码，客户端和GPT Actions据此分支处理，取值保持稳定
+type Code string
+
+const (
+	CodeInvalidRequest      Code = "invalid_request"      // 请求参数错误
+	CodeInvalidSymbol       Code = "invalid_symbol"       // 股票代码格式错误
+	CodeUnauthorized        Code = "unauthorized"         // 缺少或无效的API Key
+	CodeForbidden           Code = "forbidden"            // API Key无权访问
+	CodeNotFound            Code = "not_found"            // 功能未启用或资源不存在
+	CodeSymbolNotFound      Code = "symbol_not_found"     // 图表服务不认识该股票代码
+	CodeRateLimited         Code = "rate_limited"         // 超出限流或每日配额
+	CodeUpstreamError       Code = "upstream_error"       // 图表服务返回错误或无效图片
+	CodeStorageFailure      Code = "storage_failure"      // S3读写失败
+	CodeUpstreamUnavailable Code = "upstream_unavailable" // 图表服务无法连接
+	CodeUpstreamTimeout     Code = "upstream_timeout"     // 图表服务超时
+	CodeInternal            Code = "internal_error"       // 其他内部错误
+	CodeCanceled            Code = "canceled"             // 客户端已断开，不返回响应
+)
+
+// StatusClientClosedRequest 客户端在响应前断开连接（沿用nginx的499）
+const StatusClientClosedRequest = 499
+
+// ContextKey 写入gin.Context的错误码，供访问日志使用
+const ContextKey = "error_code"
+
+var statuses = map[Code]int{
+	CodeInvalidRequest:      http.StatusBadRequest,
+	CodeInvalidSymbol:       http.StatusBadRequest,
+	CodeUnauthorized:        http.StatusUnauthorized,
+	CodeForbidden:           http.StatusForbidden,
+	CodeNotFound:            http.StatusNotFound,
+	CodeSymbolNotFound:      http.StatusNotFound,
+	CodeRateLimited:         http.StatusTooManyRequests,
+	CodeUpstreamError:       http.StatusBadGateway,
+	CodeStorageFailure:      http.StatusBadGateway,
+	CodeUpstreamUnavailable: http.StatusServiceUnavailable,
+	CodeUpstreamTimeout:     http.StatusGatewayTimeout,
+	CodeInternal:            http.StatusInternalServerError,
+	CodeCanceled:            StatusClientClosedRequest,
+}
+
+// Error 带错误码的错误，只有Message返回给调用方，Err为底层原因，只写入服务端日志
+type Error struct {
+	Code    Code
+	Message string
+	Err     error
+}
+
+// New 创建不带底层原因的错误
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Wrap 用错误码包装底层错误
+func Wrap(code Code, message string, err error) *Error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Status 错误码对应的HTTP状态码
+func (e *Error) Status() int {
+	if status, ok := statuses[e.Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// From 从错误链中取出带错误码的错误，没有时视为内部错误
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	if errors.Is(err, context.Canceled) {
+		return Wrap(CodeCanceled, "Request canceled", err)
+	}
+	return Wrap(CodeInternal, "Internal server error", err)
+}
+
+// Abort 按错误码写入错误响应并终止请求
+// 底层原因记入 c.Errors 由访问日志输出，不返回给调用方；客户端已断开时不写响应体
+func Abort(c *gin.Context, err error) {
+	apiErr := From(err)
+	if apiErr.Code != CodeCanceled && c.Request.Context().Err() != nil {
+		// 客户端已断开，原错误多半由取消引起
+		apiErr = Wrap(CodeCanceled, "Request canceled", apiErr)
+	}
+	c.Set(ContextKey, string(apiErr.Code))
+	if apiErr.Err != nil {
+		c.Error(apiErr.Err)
+	}
+
+	if apiErr.Code == CodeCanceled {
+		c.AbortWithStatus(apiErr.Status())
+		return
+	}
+
+	c.AbortWithStatusJSON(apiErr.Status(), gin.H{
+		"success":    false,
+		"message":    apiErr.Message,
+		"error_code": apiErr.Code,
+		"timestamp":  time.Now().Format(time.RFC3339),
+	})
+}
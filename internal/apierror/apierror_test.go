@@ -0,0 +1,141 @@
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		code Code
+		want int
+	}{
+		{code: CodeInvalidRequest, want: http.StatusBadRequest},
+		{code: CodeInvalidSymbol, want: http.StatusBadRequest},
+		{code: CodeUnauthorized, want: http.StatusUnauthorized},
+		{code: CodeForbidden, want: http.StatusForbidden},
+		{code: CodeNotFound, want: http.StatusNotFound},
+		{code: CodeSymbolNotFound, want: http.StatusNotFound},
+		{code: CodeRateLimited, want: http.StatusTooManyRequests},
+		{code: CodeUpstreamError, want: http.StatusBadGateway},
+		{code: CodeStorageFailure, want: http.StatusBadGateway},
+		{code: CodeUpstreamUnavailable, want: http.StatusServiceUnavailable},
+		{code: CodeUpstreamTimeout, want: http.StatusGatewayTimeout},
+		{code: CodeInternal, want: http.StatusInternalServerError},
+		{code: CodeCanceled, want: StatusClientClosedRequest},
+		{code: "unknown_code", want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := New(tt.code, "message").Status(); got != tt.want {
+			t.Errorf("Status() for %s = %d, want %d", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestFrom(t *testing.T) {
+	notFound := New(CodeSymbolNotFound, "Unknown symbol")
+	tests := []struct {
+		name string
+		err  error
+		want Code
+	}{
+		{name: "api error", err: notFound, want: CodeSymbolNotFound},
+		{name: "wrapped api error", err: fmt.Errorf("render: %w", notFound), want: CodeSymbolNotFound},
+		{name: "canceled", err: fmt.Errorf("refresh: %w", context.Canceled), want: CodeCanceled},
+		{name: "plain error", err: errors.New("disk full"), want: CodeInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := From(tt.err)
+			if got.Code != tt.want {
+				t.Errorf("From() code = %s, want %s", got.Code, tt.want)
+			}
+			if got.Code == CodeInternal && got.Message != "Internal server error" {
+				t.Errorf("From() message = %q leaks the internal error", got.Message)
+			}
+		})
+	}
+}
+
+func TestAbort(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		err        error
+		disconnect bool
+		wantStatus int
+		wantCode   Code
+		wantBody   bool
+	}{
+		{
+			name:       "public message only",
+			err:        Wrap(CodeStorageFailure, "Failed to upload screenshot", errors.New("AccessDenied: bucket policy")),
+			wantStatus: http.StatusBadGateway,
+			wantCode:   CodeStorageFailure,
+			wantBody:   true,
+		},
+		{name: "internal error", err: errors.New("nil pointer"), wantStatus: http.StatusInternalServerError, wantCode: CodeInternal, wantBody: true},
+		// 客户端断开后不写响应体，错误码记为canceled
+		{
+			name:       "client disconnected",
+			err:        Wrap(CodeUpstreamTimeout, "Chart service timed out", context.DeadlineExceeded),
+			disconnect: true,
+			wantStatus: StatusClientClosedRequest,
+			wantCode:   CodeCanceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.disconnect {
+				cancel()
+			}
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+
+			Abort(c, tt.err)
+
+			if status := c.Writer.Status(); status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if code, _ := c.Get(ContextKey); code != string(tt.wantCode) {
+				t.Errorf("%s = %v, want %s", ContextKey, code, tt.wantCode)
+			}
+			if !tt.wantBody {
+				if w.Body.Len() != 0 {
+					t.Errorf("body = %q, want empty", w.Body.String())
+				}
+				return
+			}
+
+			var body struct {
+				Success   bool   `json:"success"`
+				Message   string `json:"message"`
+				ErrorCode Code   `json:"error_code"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("failed to decode body %q: %v", w.Body.String(), err)
+			}
+			if body.Success || body.ErrorCode != tt.wantCode {
+				t.Errorf("body = %+v", body)
+			}
+			if cause := errors.Unwrap(tt.err); cause != nil && strings.Contains(w.Body.String(), cause.Error()) {
+				t.Errorf("body %q leaks the underlying error", w.Body.String())
+			}
+			if len(c.Errors) == 0 && errors.Unwrap(tt.err) != nil {
+				t.Error("underlying error was not recorded for the access log")
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"makeprofit/internal/apierror"
+	"makeprofit/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// 权限范围
+const (
+	ScopeScreenshot = "screenshot"
+	ScopeData       = "data"
+	ScopeAdmin      = "admin"
+)
+
+const (
+	defaultHeader     = "X-API-Key"
+	defaultQueryParam = "api_key"
+
+	contextKey = "auth.api_key"
+)
+
+// Key 已认证的API Key
+type Key struct {
+	Name    string
+	scopes  map[string]bool
+	markets map[string]bool
+}
+
+// HasScope 判断Key是否拥有指定权限，admin拥有所有权限
+func (k *Key) HasScope(scope string) bool {
+	return k.scopes[scope] || k.scopes[ScopeAdmin]
+}
+
+// AllowsMarket 判断Key是否允许访问指定市场
+func (k *Key) AllowsMarket(market string) bool {
+	return len(k.markets) == 0 || k.markets[strings.ToLower(market)]
+}
+
+// Authenticator API Key鉴权器
+type Authenticator struct {
+	enabled    bool
+	header     string
+	queryParam string
+	keys       map[[sha256.Size]byte]*Key
+}
+
+// NewAuthenticator 根据配置创建鉴权器，合并配置文件和keys_file中的Key
+func NewAuthenticator(cfg *config.AuthConfig) (*Authenticator, error) {
+	a := &Authenticator{
+		enabled:    cfg.Enabled,
+		header:     cfg.Header,
+		queryParam: cfg.QueryParam,
+		keys:       make(map[[sha256.Size]byte]*Key),
+	}
+	if a.header == "" {
+		a.header = defaultHeader
+	}
+	if a.queryParam == "" {
+		a.queryParam = defaultQueryParam
+	}
+
+	keyConfigs := cfg.Keys
+	if cfg.KeysFile != "" {
+		fileKeys, err := loadKeysFile(cfg.KeysFile)
+		if err != nil {
+			return nil, err
+		}
+		keyConfigs = append(keyConfigs, fileKeys...)
+	}
+
+	for i, kc := range keyConfigs {
+		if kc.Key == "" {
+			return nil, fmt.Errorf("auth key #%d (%s) has an empty key", i, kc.Name)
+		}
+
+		key := &Key{
+			Name:    kc.Name,
+			scopes:  make(map[string]bool, len(kc.Scopes)),
+			markets: make(map[string]bool, len(kc.Markets)),
+		}
+		for _, scope := range kc.Scopes {
+			switch scope {
+			case ScopeScreenshot, ScopeData, ScopeAdmin:
+				key.scopes[scope] = true
+			default:
+				return nil, fmt.Errorf("auth key %s has unknown scope %q", kc.Name, scope)
+			}
+		}
+		for _, market := range kc.Markets {
+			key.markets[strings.ToLower(market)] = true
+		}
+
+		hash := sha256.Sum256([]byte(kc.Key))
+		if _, exists := a.keys[hash]; exists {
+			return nil, fmt.Errorf("auth key %s is defined more than once", kc.Name)
+		}
+		a.keys[hash] = key
+	}
+
+	if a.enabled && len(a.keys) == 0 {
+		return nil, fmt.Errorf("auth is enabled but no API keys are configured")
+	}
+
+	return a, nil
+}
+
+// loadKeysFile 从YAML文件加载Key列表，格式与配置文件中的auth.keys一致
+func loadKeysFile(path string) ([]config.APIKeyConfig, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read auth keys file: %w", err)
+	}
+
+	var keys []config.APIKeyConfig
+	if err := v.UnmarshalKey("keys", &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse auth keys file: %w", err)
+	}
+	return keys, nil
+}
+
+// Enabled 是否启用鉴权
+func (a *Authenticator) Enabled() bool {
+	return a.enabled
+}
+
+// Middleware 校验API Key并要求拥有scope权限，scope为空时只要求Key有效
+func (a *Authenticator) Middleware(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.enabled {
+			c.Next()
+			return
+		}
+
+		provided := a.extractKey(c)
+		if provided == "" {
+			apierror.Abort(c, apierror.New(apierror.CodeUnauthorized, "Missing API key"))
+			return
+		}
+
+		key, ok := a.keys[sha256.Sum256([]byte(provided))]
+		if !ok {
+			apierror.Abort(c, apierror.New(apierror.CodeUnauthorized, "Invalid API key"))
+			return
+		}
+
+		if scope != "" && !key.HasScope(scope) {
+			apierror.Abort(c, apierror.New(apierror.CodeForbidden, fmt.Sprintf("API key does not have %s scope", scope)))
+			return
+		}
+
+		c.Set(contextKey, key)
+		c.Next()
+	}
+}
+
+// extractKey 依次从请求头、Authorization: Bearer 和查询参数中获取Key
+func (a *Authenticator) extractKey(c *gin.Context) string {
+	if key := c.GetHeader(a.header); key != "" {
+		return key
+	}
+	if authz := c.GetHeader("Authorization"); strings.HasPrefix(authz, "Bearer ") {
+		return strings.TrimPrefix(authz, "Bearer ")
+	}
+	return c.Query(a.queryParam)
+}
+
+// KeyFromContext 获取当前请求已认证的Key，未启用鉴权时返回nil
+func KeyFromContext(c *gin.Context) *Key {
+	value, ok := c.Get(contextKey)
+	if !ok {
+		return nil
+	}
+	key, _ := value.(*Key)
+	return key
+}
+
+// MarketAllowed 判断当前请求的Key是否允许访问指定市场，未启用鉴权时总是允许
+func MarketAllowed(c *gin.Context, market string) bool {
+	key := KeyFromContext(c)
+	return key == nil || key.AllowsMarket(market)
+}
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"makeprofit/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewAuthenticator(t *testing.T) {
+	keysFile := filepath.Join(t.TempDir(), "keys.yaml")
+	if err := os.WriteFile(keysFile, []byte("keys:\n  - name: from-file\n    key: k-file\n    scopes: [data]\n"), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		cfg      config.AuthConfig
+		wantErr  string
+		wantKeys int
+	}{
+		{name: "disabled without keys", cfg: config.AuthConfig{}},
+		{
+			name:     "keys file is merged",
+			cfg:      config.AuthConfig{Enabled: true, KeysFile: keysFile, Keys: []config.APIKeyConfig{{Name: "ci", Key: "k-ci", Scopes: []string{"screenshot"}}}},
+			wantKeys: 2,
+		},
+		{name: "enabled without keys", cfg: config.AuthConfig{Enabled: true}, wantErr: "no API keys are configured"},
+		{name: "empty key", cfg: config.AuthConfig{Keys: []config.APIKeyConfig{{Name: "ci"}}}, wantErr: "has an empty key"},
+		{name: "unknown scope", cfg: config.AuthConfig{Keys: []config.APIKeyConfig{{Name: "ci", Key: "k", Scopes: []string{"write"}}}}, wantErr: `unknown scope "write"`},
+		{
+			name:    "duplicate key",
+			cfg:     config.AuthConfig{Keys: []config.APIKeyConfig{{Name: "a", Key: "k"}, {Name: "b", Key: "k"}}},
+			wantErr: "defined more than once",
+		},
+		{name: "missing keys file", cfg: config.AuthConfig{KeysFile: filepath.Join(t.TempDir(), "missing.yaml")}, wantErr: "failed to read auth keys file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewAuthenticator(&tt.cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewAuthenticator() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewAuthenticator() error = %v", err)
+			}
+			if len(a.keys) != tt.wantKeys {
+				t.Errorf("NewAuthenticator() loaded %d keys, want %d", len(a.keys), tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	a, err := NewAuthenticator(&config.AuthConfig{
+		Enabled: true,
+		Keys: []config.APIKeyConfig{
+			{Name: "shots", Key: "k-shots", Scopes: []string{ScopeScreenshot}, Markets: []string{"US"}},
+			{Name: "ops", Key: "k-admin", Scopes: []string{ScopeAdmin}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		scope      string
+		setup      func(*http.Request)
+		wantStatus int
+		wantMarket map[string]bool // 通过鉴权后各市场是否允许访问
+	}{
+		{name: "missing key", scope: ScopeScreenshot, setup: func(*http.Request) {}, wantStatus: http.StatusUnauthorized},
+		{name: "invalid key", scope: ScopeScreenshot, setup: func(r *http.Request) { r.Header.Set("X-API-Key", "nope") }, wantStatus: http.StatusUnauthorized},
+		{
+			name:       "header",
+			scope:      ScopeScreenshot,
+			setup:      func(r *http.Request) { r.Header.Set("X-API-Key", "k-shots") },
+			wantStatus: http.StatusOK,
+			wantMarket: map[string]bool{"us": true, "US": true, "hk": false},
+		},
+		{name: "bearer token", scope: ScopeScreenshot, setup: func(r *http.Request) { r.Header.Set("Authorization", "Bearer k-shots") }, wantStatus: http.StatusOK},
+		{name: "query parameter", scope: ScopeScreenshot, setup: func(r *http.Request) { r.URL.RawQuery = "api_key=k-shots" }, wantStatus: http.StatusOK},
+		{name: "missing scope", scope: ScopeData, setup: func(r *http.Request) { r.Header.Set("X-API-Key", "k-shots") }, wantStatus: http.StatusForbidden},
+		{name: "any valid key", setup: func(r *http.Request) { r.Header.Set("X-API-Key", "k-shots") }, wantStatus: http.StatusOK},
+		{
+			// admin拥有所有权限，且不限制市场
+			name:       "admin implies every scope",
+			scope:      ScopeData,
+			setup:      func(r *http.Request) { r.Header.Set("X-API-Key", "k-admin") },
+			wantStatus: http.StatusOK,
+			wantMarket: map[string]bool{"us": true, "hk": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var markets map[string]bool
+			r := gin.New()
+			r.GET("/", a.Middleware(tt.scope), func(c *gin.Context) {
+				markets = make(map[string]bool)
+				for market := range tt.wantMarket {
+					markets[market] = MarketAllowed(c, market)
+				}
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			tt.setup(req)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			for market, want := range tt.wantMarket {
+				if markets[market] != want {
+					t.Errorf("MarketAllowed(%s) = %v, want %v", market, markets[market], want)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddlewareDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	a, err := NewAuthenticator(&config.AuthConfig{})
+	if err != nil {
+		t.Fatalf("NewAuthenticator() error = %v", err)
+	}
+
+	allowed := false
+	r := gin.New()
+	r.GET("/", a.Middleware(ScopeAdmin), func(c *gin.Context) {
+		allowed = KeyFromContext(c) == nil && MarketAllowed(c, "hk")
+		c.Status(http.StatusOK)
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusOK || !allowed {
+		t.Errorf("disabled auth: status = %d, market allowed = %v", w.Code, allowed)
+	}
+}
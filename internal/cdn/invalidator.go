@@ -0,0 +1,184 @@
+package cdn
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"makeprofit/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPurgeBatchSize     = 30 // Cloudflare单次按URL清除的上限
+	defaultPurgeBatchInterval = 5 * time.Second
+	defaultPurgeTimeout       = 30 * time.Second
+)
+
+// Invalidator 收集被覆盖的key，攒批并限速地清除CDN缓存
+type Invalidator struct {
+	purger        Purger
+	urls          *URLBuilder
+	batchSize     int
+	batchInterval time.Duration
+	minInterval   time.Duration
+	timeout       time.Duration
+	logger        *logrus.Logger
+
+	mu        sync.Mutex
+	pending   []string
+	queued    map[string]bool
+	lastPurge time.Time
+
+	full     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewInvalidator 创建CDN缓存失效器并启动后台攒批
+func NewInvalidator(cfg *config.InvalidationConfig, s3Cfg *config.S3Config, urls *URLBuilder, logger *logrus.Logger) (*Invalidator, error) {
+	if !urls.hasCDN() {
+		return nil, fmt.Errorf("cdn.invalidation.mode %s requires cdn.base_url", InvalidationPurge)
+	}
+
+	purger, err := NewPurger(cfg, s3Cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := &Invalidator{
+		purger:        purger,
+		urls:          urls,
+		batchSize:     cfg.BatchSize,
+		batchInterval: cfg.BatchInterval,
+		minInterval:   cfg.MinInterval,
+		timeout:       cfg.Timeout,
+		logger:        logger,
+		queued:        make(map[string]bool),
+		full:          make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+	}
+	if inv.batchSize <= 0 {
+		inv.batchSize = defaultPurgeBatchSize
+	}
+	if inv.batchInterval <= 0 {
+		inv.batchInterval = defaultPurgeBatchInterval
+	}
+	if inv.timeout <= 0 {
+		inv.timeout = defaultPurgeTimeout
+	}
+
+	inv.wg.Add(1)
+	go inv.loop()
+
+	return inv, nil
+}
+
+// SetURLBuilder 配置热更新后替换URL生成器，之后加入队列的key使用新的CDN域名
+func (inv *Invalidator) SetURLBuilder(urls *URLBuilder) {
+	inv.mu.Lock()
+	inv.urls = urls
+	inv.mu.Unlock()
+}
+
+// Invalidate 将S3 key加入待清除队列，不阻塞调用方
+func (inv *Invalidator) Invalidate(s3Key string) {
+	inv.mu.Lock()
+	purgeURL := inv.urls.cdnURL(s3Key)
+	if !inv.queued[purgeURL] {
+		inv.queued[purgeURL] = true
+		inv.pending = append(inv.pending, purgeURL)
+	}
+	full := len(inv.pending) >= inv.batchSize
+	inv.mu.Unlock()
+
+	if full {
+		select {
+		case inv.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close 停止后台攒批，并清除剩余的URL
+func (inv *Invalidator) Close() {
+	inv.stopOnce.Do(func() { close(inv.stop) })
+	inv.wg.Wait()
+}
+
+func (inv *Invalidator) loop() {
+	defer inv.wg.Done()
+
+	ticker := time.NewTicker(inv.batchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			inv.flush(false)
+		case <-inv.full:
+			inv.flush(false)
+		case <-inv.stop:
+			inv.flush(true)
+			return
+		}
+	}
+}
+
+// flush 发送待清除的URL，每批不超过batchSize，批次之间至少间隔minInterval
+// drain为false时最多发送一批，其余留到下一次
+func (inv *Invalidator) flush(drain bool) {
+	for {
+		inv.mu.Lock()
+		if len(inv.pending) == 0 {
+			inv.mu.Unlock()
+			return
+		}
+		wait := inv.minInterval - time.Since(inv.lastPurge)
+		if wait > 0 && !drain {
+			inv.mu.Unlock()
+			return
+		}
+
+		n := len(inv.pending)
+		if n > inv.batchSize {
+			n = inv.batchSize
+		}
+		batch := inv.pending[:n:n]
+		inv.pending = inv.pending[n:]
+		for _, purgeURL := range batch {
+			delete(inv.queued, purgeURL)
+		}
+		inv.mu.Unlock()
+
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+		inv.purge(batch)
+
+		if !drain {
+			return
+		}
+	}
+}
+
+func (inv *Invalidator) purge(batch []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), inv.timeout)
+	defer cancel()
+
+	err := inv.purger.Purge(ctx, batch)
+
+	inv.mu.Lock()
+	inv.lastPurge = time.Now()
+	inv.mu.Unlock()
+
+	// 失败时不重试，缓存会在TTL到期后自然失效
+	if err != nil {
+		inv.logger.WithError(err).WithField("urls", batch).Error("Failed to purge CDN cache")
+		return
+	}
+	inv.logger.WithField("count", len(batch)).Info("CDN cache purged")
+}
@@ -0,0 +1,123 @@
+package cdn
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"makeprofit/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newTestInvalidator 创建通过webhook清除缓存的失效器，每次purge请求的URL列表发送到返回的channel
+func newTestInvalidator(t *testing.T, cfg config.InvalidationConfig, baseURL string) (*Invalidator, <-chan []string) {
+	t.Helper()
+	batches := make(chan []string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			URLs []string `json:"urls"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("failed to decode purge request: %v", err)
+		}
+		batches <- payload.URLs
+	}))
+	t.Cleanup(server.Close)
+
+	cfg.Mode = InvalidationPurge
+	cfg.Provider = PurgerWebhook
+	cfg.WebhookURL = server.URL
+	urls, err := NewURLBuilder(&config.CDNConfig{BaseURL: baseURL}, testS3Config, nil)
+	if err != nil {
+		t.Fatalf("NewURLBuilder() error = %v", err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	inv, err := NewInvalidator(&cfg, testS3Config, urls, logger)
+	if err != nil {
+		t.Fatalf("NewInvalidator() error = %v", err)
+	}
+	t.Cleanup(inv.Close)
+	return inv, batches
+}
+
+func receiveBatch(t *testing.T, batches <-chan []string) string {
+	t.Helper()
+	select {
+	case batch := <-batches:
+		return strings.Join(batch, ",")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a purge request")
+		return ""
+	}
+}
+
+func TestNewInvalidatorRequiresCDN(t *testing.T) {
+	urls, err := NewURLBuilder(&config.CDNConfig{}, testS3Config, nil)
+	if err != nil {
+		t.Fatalf("NewURLBuilder() error = %v", err)
+	}
+	cfg := &config.InvalidationConfig{Mode: InvalidationPurge, Provider: PurgerWebhook, WebhookURL: "https://purge.example.com"}
+	if _, err := NewInvalidator(cfg, testS3Config, urls, logrus.New()); err == nil || !strings.Contains(err.Error(), "requires cdn.base_url") {
+		t.Errorf("NewInvalidator() error = %v, want cdn.base_url error", err)
+	}
+}
+
+func TestInvalidatorBatches(t *testing.T) {
+	// 攒批时间足够长，只有队列满或关闭时才会发送
+	inv, batches := newTestInvalidator(t, config.InvalidationConfig{BatchSize: 2, BatchInterval: time.Hour}, "https://cdn.example.com")
+
+	inv.Invalidate("screenshot/screenshots/a.png")
+	inv.Invalidate("screenshot/screenshots/a.png") // 队列中已有的URL不重复清除
+	inv.Invalidate("screenshot/screenshots/b.png")
+	if got := receiveBatch(t, batches); got != "https://cdn.example.com/screenshots/a.png,https://cdn.example.com/screenshots/b.png" {
+		t.Errorf("first batch = %s", got)
+	}
+
+	// 热更新CDN域名后新加入的key使用新域名；关闭时清除剩余的URL
+	urls, err := NewURLBuilder(&config.CDNConfig{BaseURL: "https://cdn2.example.com"}, testS3Config, nil)
+	if err != nil {
+		t.Fatalf("NewURLBuilder() error = %v", err)
+	}
+	inv.SetURLBuilder(urls)
+	inv.Invalidate("screenshot/screenshots/a.png")
+	inv.Close()
+	if got := receiveBatch(t, batches); got != "https://cdn2.example.com/screenshots/a.png" {
+		t.Errorf("batch on close = %s", got)
+	}
+	select {
+	case batch := <-batches:
+		t.Errorf("unexpected purge after close: %v", batch)
+	default:
+	}
+}
+
+func TestInvalidatorBatchInterval(t *testing.T) {
+	inv, batches := newTestInvalidator(t, config.InvalidationConfig{BatchSize: 10, BatchInterval: 20 * time.Millisecond}, "https://cdn.example.com")
+
+	inv.Invalidate("screenshot/data/NVDA_us_1d.json")
+	if got := receiveBatch(t, batches); got != "https://cdn.example.com/data/NVDA_us_1d.json" {
+		t.Errorf("batch = %s", got)
+	}
+}
+
+func TestInvalidatorMinInterval(t *testing.T) {
+	const minInterval = 200 * time.Millisecond
+	inv, batches := newTestInvalidator(t, config.InvalidationConfig{BatchSize: 1, BatchInterval: 10 * time.Millisecond, MinInterval: minInterval}, "https://cdn.example.com")
+
+	inv.Invalidate("screenshot/screenshots/a.png")
+	receiveBatch(t, batches)
+	first := time.Now()
+
+	inv.Invalidate("screenshot/screenshots/b.png")
+	receiveBatch(t, batches)
+	if elapsed := time.Since(first); elapsed < minInterval/2 {
+		t.Errorf("second purge after %s, want at least about %s", elapsed, minInterval)
+	}
+}
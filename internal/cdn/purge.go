@@ -0,0 +1,186 @@
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"makeprofit/internal/config"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	cftypes "github.com/aws/aws-sdk-go-v2/service/cloudfront/types"
+)
+
+// 缓存失效方式
+const (
+	InvalidationNone    = "none"
+	InvalidationPurge   = "purge"
+	InvalidationVersion = "version"
+)
+
+// purge提供方
+const (
+	PurgerCloudFront = "cloudfront"
+	PurgerCloudflare = "cloudflare"
+	PurgerWebhook    = "webhook"
+)
+
+// Purger 清除CDN上指定URL的缓存
+type Purger interface {
+	Purge(ctx context.Context, urls []string) error
+}
+
+// NewPurger 按配置创建purge提供方，CloudFront复用S3的凭证配置
+func NewPurger(cfg *config.InvalidationConfig, s3Cfg *config.S3Config) (Purger, error) {
+	switch cfg.Provider {
+	case PurgerCloudFront:
+		if cfg.DistributionID == "" {
+			return nil, fmt.Errorf("cloudfront purger requires cdn.invalidation.distribution_id")
+		}
+		return newCloudFrontPurger(cfg.DistributionID, s3Cfg)
+	case PurgerCloudflare:
+		if cfg.ZoneID == "" || cfg.APIToken == "" {
+			return nil, fmt.Errorf("cloudflare purger requires cdn.invalidation.zone_id and cdn.invalidation.api_token")
+		}
+		return &cloudflarePurger{
+			zoneID:   cfg.ZoneID,
+			apiToken: cfg.APIToken,
+			client:   &http.Client{},
+		}, nil
+	case PurgerWebhook:
+		if cfg.WebhookURL == "" {
+			return nil, fmt.Errorf("webhook purger requires cdn.invalidation.webhook_url")
+		}
+		return &webhookPurger{
+			url:     cfg.WebhookURL,
+			headers: cfg.WebhookHeaders,
+			client:  &http.Client{},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown cdn.invalidation.provider %q", cfg.Provider)
+	}
+}
+
+// cloudFrontPurger 通过CreateInvalidation清除CloudFront缓存
+type cloudFrontPurger struct {
+	client         *cloudfront.Client
+	distributionID string
+}
+
+func newCloudFrontPurger(distributionID string, s3Cfg *config.S3Config) (*cloudFrontPurger, error) {
+	// CloudFront是全局服务，固定使用us-east-1
+	opts := []func(*awsconfig.LoadOptions) error{awsconfig.WithRegion("us-east-1")}
+	if s3Cfg.AccessKeyID != "" && s3Cfg.SecretAccessKey != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(credentials.StaticCredentialsProvider{
+			Value: aws.Credentials{
+				AccessKeyID:     s3Cfg.AccessKeyID,
+				SecretAccessKey: s3Cfg.SecretAccessKey,
+			},
+		}))
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.TODO(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	return &cloudFrontPurger{
+		client:         cloudfront.NewFromConfig(awsCfg),
+		distributionID: distributionID,
+	}, nil
+}
+
+func (p *cloudFrontPurger) Purge(ctx context.Context, urls []string) error {
+	paths := urlPaths(urls)
+	_, err := p.client.CreateInvalidation(ctx, &cloudfront.CreateInvalidationInput{
+		DistributionId: aws.String(p.distributionID),
+		InvalidationBatch: &cftypes.InvalidationBatch{
+			CallerReference: aws.String(strconv.FormatInt(time.Now().UnixNano(), 10)),
+			Paths: &cftypes.Paths{
+				Items:    paths,
+				Quantity: aws.Int32(int32(len(paths))),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create CloudFront invalidation: %w", err)
+	}
+	return nil
+}
+
+// cloudflarePurger 通过Cloudflare API按URL清除缓存
+type cloudflarePurger struct {
+	zoneID   string
+	apiToken string
+	client   *http.Client
+}
+
+func (p *cloudflarePurger) Purge(ctx context.Context, urls []string) error {
+	endpoint := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/purge_cache", p.zoneID)
+	headers := map[string]string{"Authorization": "Bearer " + p.apiToken}
+	return postJSON(ctx, p.client, endpoint, headers, map[string]interface{}{"files": urls})
+}
+
+// webhookPurger 将需要清除的URL和路径POST到自定义接口
+type webhookPurger struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (p *webhookPurger) Purge(ctx context.Context, urls []string) error {
+	return postJSON(ctx, p.client, p.url, p.headers, map[string]interface{}{
+		"urls":  urls,
+		"paths": urlPaths(urls),
+	})
+}
+
+func postJSON(ctx context.Context, client *http.Client, endpoint string, headers map[string]string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal purge request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create purge request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send purge request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("purge request failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// urlPaths 提取URL的路径部分
+func urlPaths(urls []string) []string {
+	paths := make([]string, 0, len(urls))
+	for _, rawURL := range urls {
+		parsed, err := url.Parse(rawURL)
+		if err != nil {
+			continue
+		}
+		paths = append(paths, parsed.EscapedPath())
+	}
+	return paths
+}
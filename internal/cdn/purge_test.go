@@ -0,0 +1,135 @@
+package cdn
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"makeprofit/internal/config"
+)
+
+// roundTripFunc 拦截请求，不访问真实的CDN API
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestNewPurger(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.InvalidationConfig
+		wantErr string
+	}{
+		{name: "cloudflare", cfg: config.InvalidationConfig{Provider: PurgerCloudflare, ZoneID: "zone", APIToken: "token"}},
+		{name: "webhook", cfg: config.InvalidationConfig{Provider: PurgerWebhook, WebhookURL: "https://purge.example.com"}},
+		{name: "cloudfront without distribution", cfg: config.InvalidationConfig{Provider: PurgerCloudFront}, wantErr: "distribution_id"},
+		{name: "cloudflare without token", cfg: config.InvalidationConfig{Provider: PurgerCloudflare, ZoneID: "zone"}, wantErr: "api_token"},
+		{name: "webhook without url", cfg: config.InvalidationConfig{Provider: PurgerWebhook}, wantErr: "webhook_url"},
+		{name: "unknown provider", cfg: config.InvalidationConfig{Provider: "fastly"}, wantErr: `unknown cdn.invalidation.provider "fastly"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPurger(&tt.cfg, testS3Config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("NewPurger() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewPurger() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhookPurger(t *testing.T) {
+	var payload struct {
+		URLs  []string `json:"urls"`
+		Paths []string `json:"paths"`
+	}
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("X-Purge-Token")
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("failed to decode purge request: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	purger, err := NewPurger(&config.InvalidationConfig{
+		Provider:       PurgerWebhook,
+		WebhookURL:     server.URL,
+		WebhookHeaders: map[string]string{"X-Purge-Token": "t0ken"},
+	}, testS3Config)
+	if err != nil {
+		t.Fatalf("NewPurger() error = %v", err)
+	}
+
+	urls := []string{"https://cdn.example.com/screenshots/NVDA_us_1d.png", "https://cdn.example.com/data/BRK%20B_us_1d.json"}
+	if err := purger.Purge(context.Background(), urls); err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	if header != "t0ken" {
+		t.Errorf("X-Purge-Token = %q", header)
+	}
+	if strings.Join(payload.URLs, ",") != strings.Join(urls, ",") {
+		t.Errorf("urls = %v", payload.URLs)
+	}
+	if strings.Join(payload.Paths, ",") != "/screenshots/NVDA_us_1d.png,/data/BRK%20B_us_1d.json" {
+		t.Errorf("paths = %v", payload.Paths)
+	}
+}
+
+func TestCloudflarePurger(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr string
+	}{
+		{name: "success", status: http.StatusOK},
+		{name: "rejected", status: http.StatusForbidden, wantErr: "purge request failed with status 403"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req *http.Request
+			var body []byte
+			purger := &cloudflarePurger{zoneID: "zone-1", apiToken: "cf-token", client: &http.Client{
+				Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+					req = r
+					body, _ = io.ReadAll(r.Body)
+					return &http.Response{
+						StatusCode: tt.status,
+						Body:       io.NopCloser(strings.NewReader(`{"success":false}`)),
+						Header:     http.Header{},
+					}, nil
+				}),
+			}}
+
+			err := purger.Purge(context.Background(), []string{"https://cdn.example.com/screenshots/a.png"})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Purge() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Purge() error = %v", err)
+			}
+			if req.URL.String() != "https://api.cloudflare.com/client/v4/zones/zone-1/purge_cache" {
+				t.Errorf("request URL = %s", req.URL)
+			}
+			if req.Header.Get("Authorization") != "Bearer cf-token" {
+				t.Errorf("Authorization = %q", req.Header.Get("Authorization"))
+			}
+			if string(body) != `{"files":["https://cdn.example.com/screenshots/a.png"]}` {
+				t.Errorf("body = %s", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package cdn
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"makeprofit/internal/config"
+)
+
+// URL模式
+const (
+	URLModePublic           = "public"
+	URLModeS3Presigned      = "s3_presigned"
+	URLModeCloudFrontSigned = "cloudfront_signed"
+	URLModeHMACSigned       = "hmac_signed"
+)
+
+const defaultURLTTL = 24 * time.Hour
+
+// Presigner 生成S3预签名下载URL
+type Presigner interface {
+	PresignGetURL(ctx context.Context, s3Key string, ttl time.Duration) (string, error)
+}
+
+// SignedURL 生成的访问URL，ExpiresAt为零值表示永久有效
+type SignedURL struct {
+	URL       string
+	ExpiresAt time.Time
+}
+
+// URLBuilder 根据配置生成对象的访问URL
+type URLBuilder struct {
+	baseURL   string
+	mode      string
+	ttl       time.Duration
+	s3Config  *config.S3Config
+	presigner Presigner
+	versioned bool // 在URL上追加 ?v=<version>
+
+	keyPairID  string
+	privateKey *rsa.PrivateKey
+	hmacSecret []byte
+}
+
+// NewURLBuilder 创建URL生成器，签名模式所需的密钥在此处加载校验
+func NewURLBuilder(cdnCfg *config.CDNConfig, s3Cfg *config.S3Config, presigner Presigner) (*URLBuilder, error) {
+	b := &URLBuilder{
+		baseURL:   strings.TrimSuffix(cdnCfg.BaseURL, "/"),
+		mode:      cdnCfg.URLMode,
+		ttl:       cdnCfg.URLTTL,
+		s3Config:  s3Cfg,
+		presigner: presigner,
+		versioned: cdnCfg.Invalidation.Mode == InvalidationVersion,
+	}
+	if b.mode == "" {
+		b.mode = URLModePublic
+	}
+	if b.ttl <= 0 {
+		b.ttl = defaultURLTTL
+	}
+
+	switch b.mode {
+	case URLModePublic:
+	case URLModeS3Presigned:
+		if presigner == nil {
+			return nil, fmt.Errorf("url_mode %s requires an S3 presigner", b.mode)
+		}
+	case URLModeCloudFrontSigned:
+		if !b.hasCDN() {
+			return nil, fmt.Errorf("url_mode %s requires cdn.base_url", b.mode)
+		}
+		if cdnCfg.KeyPairID == "" || cdnCfg.PrivateKeyFile == "" {
+			return nil, fmt.Errorf("url_mode %s requires cdn.key_pair_id and cdn.private_key_file", b.mode)
+		}
+		privateKey, err := loadRSAPrivateKey(cdnCfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		b.keyPairID = cdnCfg.KeyPairID
+		b.privateKey = privateKey
+	case URLModeHMACSigned:
+		if !b.hasCDN() {
+			return nil, fmt.Errorf("url_mode %s requires cdn.base_url", b.mode)
+		}
+		if cdnCfg.HMACSecret == "" {
+			return nil, fmt.Errorf("url_mode %s requires cdn.hmac_secret", b.mode)
+		}
+		b.hmacSecret = []byte(cdnCfg.HMACSecret)
+	default:
+		return nil, fmt.Errorf("unknown cdn.url_mode %q", b.mode)
+	}
+
+	return b, nil
+}
+
+// hasCDN 是否配置了真实的CDN域名
+func (b *URLBuilder) hasCDN() bool {
+	return b.baseURL != ""
+}
+
+// Versioned URL上是否追加 ?v=<version>，为false时VersionedURL忽略version参数
+func (b *URLBuilder) Versioned() bool {
+	return b.versioned
+}
+
+// URL 生成S3 key对应的访问URL
+func (b *URLBuilder) URL(ctx context.Context, s3Key string) (*SignedURL, error) {
+	return b.VersionedURL(ctx, s3Key, "")
+}
+
+// VersionedURL 生成带版本参数的访问URL，使覆盖后的key绕过CDN旧缓存
+// 仅在 cdn.invalidation.mode 为 version 时追加；预签名URL本身每次不同，不追加
+func (b *URLBuilder) VersionedURL(ctx context.Context, s3Key, version string) (*SignedURL, error) {
+	switch b.mode {
+	case URLModeS3Presigned:
+		presigned, err := b.presigner.PresignGetURL(ctx, s3Key, b.ttl)
+		if err != nil {
+			return nil, fmt.Errorf("failed to presign URL: %w", err)
+		}
+		return &SignedURL{URL: presigned, ExpiresAt: time.Now().Add(b.ttl)}, nil
+	case URLModeCloudFrontSigned:
+		return b.cloudFrontSignedURL(b.withVersion(b.cdnURL(s3Key), version))
+	case URLModeHMACSigned:
+		return b.hmacSignedURL(b.withVersion(b.cdnURL(s3Key), version))
+	default:
+		return &SignedURL{URL: b.withVersion(b.publicURL(s3Key), version)}, nil
+	}
+}
+
+func (b *URLBuilder) withVersion(rawURL, version string) string {
+	if !b.versioned || version == "" {
+		return rawURL
+	}
+	return appendQuery(rawURL, url.Values{"v": {version}})
+}
+
+// publicURL 生成公开访问URL，未配置CDN时返回S3 URL
+func (b *URLBuilder) publicURL(s3Key string) string {
+	if !b.hasCDN() {
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s",
+			b.s3Config.Bucket, b.s3Config.Region, s3Key)
+	}
+	return b.cdnURL(s3Key)
+}
+
+// cdnURL 生成CDN URL
+func (b *URLBuilder) cdnURL(s3Key string) string {
+	// 从S3 key中提取文件名部分（去掉screenshot/前缀）
+	// S3 key格式: screenshot/screenshots/PDD_us_1h_20250808_01.png
+	// 我们需要提取: screenshots/PDD_us_1h_20250808_01.png
+	fileName := strings.TrimPrefix(s3Key, "screenshot/")
+	return fmt.Sprintf("%s/%s", b.baseURL, fileName)
+}
+
+// cloudFrontSignedURL 使用CloudFront标准(canned)策略签名URL
+func (b *URLBuilder) cloudFrontSignedURL(rawURL string) (*SignedURL, error) {
+	expiresAt := time.Now().Add(b.ttl)
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+
+	policy := fmt.Sprintf(`{"Statement":[{"Resource":"%s","Condition":{"DateLessThan":{"AWS:EpochTime":%s}}}]}`, rawURL, expires)
+	digest := sha1.Sum([]byte(policy))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, b.privateKey, crypto.SHA1, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign CloudFront URL: %w", err)
+	}
+
+	query := url.Values{}
+	query.Set("Expires", expires)
+	query.Set("Signature", cloudFrontEncode(signature))
+	query.Set("Key-Pair-Id", b.keyPairID)
+
+	return &SignedURL{URL: appendQuery(rawURL, query), ExpiresAt: expiresAt}, nil
+}
+
+// cloudFrontEncode CloudFront要求的URL安全Base64编码
+func cloudFrontEncode(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	return strings.NewReplacer("+", "-", "=", "_", "/", "~").Replace(encoded)
+}
+
+// hmacSignedURL 生成 ?expires=<unix>&signature=<hex(HMAC-SHA256(path+expires))> 形式的签名URL
+func (b *URLBuilder) hmacSignedURL(rawURL string) (*SignedURL, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CDN URL: %w", err)
+	}
+
+	expiresAt := time.Now().Add(b.ttl)
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+
+	mac := hmac.New(sha256.New, b.hmacSecret)
+	mac.Write([]byte(parsed.EscapedPath() + expires))
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", hex.EncodeToString(mac.Sum(nil)))
+
+	return &SignedURL{URL: appendQuery(rawURL, query), ExpiresAt: expiresAt}, nil
+}
+
+func appendQuery(rawURL string, query url.Values) string {
+	separator := "?"
+	if strings.Contains(rawURL, "?") {
+		separator = "&"
+	}
+	return rawURL + separator + query.Encode()
+}
+
+// loadRSAPrivateKey 加载PEM格式（PKCS1或PKCS8）的RSA私钥
+func loadRSAPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CloudFront private key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %s", path)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CloudFront private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("CloudFront private key must be RSA")
+	}
+	return key, nil
+}
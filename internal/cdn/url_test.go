@@ -0,0 +1,284 @@
+package cdn
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"makeprofit/internal/config"
+)
+
+var testS3Config = &config.S3Config{Bucket: "charts", Region: "us-east-1"}
+
+type fakePresigner struct{}
+
+func (fakePresigner) PresignGetURL(_ context.Context, s3Key string, ttl time.Duration) (string, error) {
+	return "https://charts.s3.amazonaws.com/" + s3Key + "?X-Amz-Expires=" + ttl.String(), nil
+}
+
+// writeRSAKey 生成测试用RSA私钥并写入PEM文件
+func writeRSAKey(t *testing.T, pkcs8 bool) (string, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	if pkcs8 {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatalf("MarshalPKCS8PrivateKey() error = %v", err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+
+	path := filepath.Join(t.TempDir(), "cloudfront.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path, key
+}
+
+func TestNewURLBuilder(t *testing.T) {
+	keyFile, _ := writeRSAKey(t, false)
+	notAKey := filepath.Join(t.TempDir(), "not-a-key.pem")
+	os.WriteFile(notAKey, []byte("hello"), 0600)
+
+	tests := []struct {
+		name      string
+		cfg       config.CDNConfig
+		presigner Presigner
+		wantErr   bool
+	}{
+		{name: "default public", cfg: config.CDNConfig{}},
+		{name: "presigned", cfg: config.CDNConfig{URLMode: URLModeS3Presigned}, presigner: fakePresigner{}},
+		{name: "presigned without presigner", cfg: config.CDNConfig{URLMode: URLModeS3Presigned}, wantErr: true},
+		{
+			name: "cloudfront",
+			cfg:  config.CDNConfig{URLMode: URLModeCloudFrontSigned, BaseURL: "https://cdn.example.com", KeyPairID: "K1", PrivateKeyFile: keyFile},
+		},
+		{
+			name:    "cloudfront without base_url",
+			cfg:     config.CDNConfig{URLMode: URLModeCloudFrontSigned, KeyPairID: "K1", PrivateKeyFile: keyFile},
+			wantErr: true,
+		},
+		{
+			name:    "cloudfront without key pair",
+			cfg:     config.CDNConfig{URLMode: URLModeCloudFrontSigned, BaseURL: "https://cdn.example.com", PrivateKeyFile: keyFile},
+			wantErr: true,
+		},
+		{
+			name:    "cloudfront with invalid key",
+			cfg:     config.CDNConfig{URLMode: URLModeCloudFrontSigned, BaseURL: "https://cdn.example.com", KeyPairID: "K1", PrivateKeyFile: notAKey},
+			wantErr: true,
+		},
+		{name: "hmac", cfg: config.CDNConfig{URLMode: URLModeHMACSigned, BaseURL: "https://cdn.example.com", HMACSecret: "s3cret"}},
+		{name: "hmac without secret", cfg: config.CDNConfig{URLMode: URLModeHMACSigned, BaseURL: "https://cdn.example.com"}, wantErr: true},
+		{name: "unknown mode", cfg: config.CDNConfig{URLMode: "signed"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewURLBuilder(&tt.cfg, testS3Config, tt.presigner)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewURLBuilder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestURLBuilderUnsignedURLs(t *testing.T) {
+	const key = "screenshot/screenshots/NVDA_us_1d_20250729.png"
+
+	tests := []struct {
+		name      string
+		cfg       config.CDNConfig
+		presigner Presigner
+		version   string
+		want      string
+		wantTTL   bool
+	}{
+		{
+			name: "s3 url without cdn",
+			want: "https://charts.s3.us-east-1.amazonaws.com/" + key,
+		},
+		{
+			name: "cdn url strips screenshot prefix",
+			cfg:  config.CDNConfig{BaseURL: "https://cdn.example.com/"},
+			want: "https://cdn.example.com/screenshots/NVDA_us_1d_20250729.png",
+		},
+		{
+			name:    "version ignored without version mode",
+			cfg:     config.CDNConfig{BaseURL: "https://cdn.example.com"},
+			version: "abc123",
+			want:    "https://cdn.example.com/screenshots/NVDA_us_1d_20250729.png",
+		},
+		{
+			name:    "version mode appends hash",
+			cfg:     config.CDNConfig{BaseURL: "https://cdn.example.com", Invalidation: config.InvalidationConfig{Mode: InvalidationVersion}},
+			version: "abc123",
+			want:    "https://cdn.example.com/screenshots/NVDA_us_1d_20250729.png?v=abc123",
+		},
+		{
+			name: "version mode without version",
+			cfg:  config.CDNConfig{BaseURL: "https://cdn.example.com", Invalidation: config.InvalidationConfig{Mode: InvalidationVersion}},
+			want: "https://cdn.example.com/screenshots/NVDA_us_1d_20250729.png",
+		},
+		{
+			name:      "presigned",
+			cfg:       config.CDNConfig{URLMode: URLModeS3Presigned, URLTTL: time.Hour},
+			presigner: fakePresigner{},
+			want:      "https://charts.s3.amazonaws.com/" + key + "?X-Amz-Expires=1h0m0s",
+			wantTTL:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewURLBuilder(&tt.cfg, testS3Config, tt.presigner)
+			if err != nil {
+				t.Fatalf("NewURLBuilder() error = %v", err)
+			}
+			signed, err := b.VersionedURL(context.Background(), key, tt.version)
+			if err != nil {
+				t.Fatalf("VersionedURL() error = %v", err)
+			}
+			if signed.URL != tt.want {
+				t.Errorf("URL = %s, want %s", signed.URL, tt.want)
+			}
+			if signed.ExpiresAt.IsZero() == tt.wantTTL {
+				t.Errorf("ExpiresAt = %v, want expiry %v", signed.ExpiresAt, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestURLBuilderHMACSigned(t *testing.T) {
+	const secret = "s3cret"
+	b, err := NewURLBuilder(&config.CDNConfig{
+		URLMode:      URLModeHMACSigned,
+		BaseURL:      "https://cdn.example.com",
+		URLTTL:       time.Hour,
+		HMACSecret:   secret,
+		Invalidation: config.InvalidationConfig{Mode: InvalidationVersion},
+	}, testS3Config, nil)
+	if err != nil {
+		t.Fatalf("NewURLBuilder() error = %v", err)
+	}
+
+	before := time.Now()
+	signed, err := b.VersionedURL(context.Background(), "screenshot/screenshots/BRK B_us_1d.png", "abc123")
+	if err != nil {
+		t.Fatalf("VersionedURL() error = %v", err)
+	}
+
+	parsed, err := url.Parse(signed.URL)
+	if err != nil {
+		t.Fatalf("url.Parse() error = %v", err)
+	}
+	query := parsed.Query()
+	if query.Get("v") != "abc123" {
+		t.Errorf("v = %q, want abc123", query.Get("v"))
+	}
+
+	// 签名覆盖转义后的路径和过期时间，版本参数不参与签名
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(parsed.EscapedPath() + query.Get("expires")))
+	if want := hex.EncodeToString(mac.Sum(nil)); query.Get("signature") != want {
+		t.Errorf("signature = %s, want %s", query.Get("signature"), want)
+	}
+	if parseUnix(t, query.Get("expires")) != signed.ExpiresAt.Unix() {
+		t.Errorf("expires = %s, ExpiresAt = %v", query.Get("expires"), signed.ExpiresAt)
+	}
+	if ttl := signed.ExpiresAt.Sub(before); ttl < time.Hour-time.Second || ttl > time.Hour+time.Second {
+		t.Errorf("ExpiresAt is %v from now, want 1h", ttl)
+	}
+}
+
+func TestURLBuilderCloudFrontSigned(t *testing.T) {
+	for _, pkcs8 := range []bool{false, true} {
+		name := "pkcs1"
+		if pkcs8 {
+			name = "pkcs8"
+		}
+		t.Run(name, func(t *testing.T) {
+			keyFile, key := writeRSAKey(t, pkcs8)
+			b, err := NewURLBuilder(&config.CDNConfig{
+				URLMode:        URLModeCloudFrontSigned,
+				BaseURL:        "https://d111.cloudfront.net",
+				URLTTL:         10 * time.Minute,
+				KeyPairID:      "K2JCJMDEHXQW5F",
+				PrivateKeyFile: keyFile,
+			}, testS3Config, nil)
+			if err != nil {
+				t.Fatalf("NewURLBuilder() error = %v", err)
+			}
+
+			signed, err := b.URL(context.Background(), "screenshot/screenshots/NVDA_us_1d.png")
+			if err != nil {
+				t.Fatalf("URL() error = %v", err)
+			}
+
+			rawURL, rawQuery, _ := strings.Cut(signed.URL, "?")
+			if rawURL != "https://d111.cloudfront.net/screenshots/NVDA_us_1d.png" {
+				t.Errorf("resource = %s", rawURL)
+			}
+			query, err := url.ParseQuery(rawQuery)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			if query.Get("Key-Pair-Id") != "K2JCJMDEHXQW5F" {
+				t.Errorf("Key-Pair-Id = %q", query.Get("Key-Pair-Id"))
+			}
+			if parseUnix(t, query.Get("Expires")) != signed.ExpiresAt.Unix() {
+				t.Errorf("Expires = %s, ExpiresAt = %v", query.Get("Expires"), signed.ExpiresAt)
+			}
+
+			// 按CloudFront的canned policy规则还原签名内容并验证
+			policy := `{"Statement":[{"Resource":"` + rawURL + `","Condition":{"DateLessThan":{"AWS:EpochTime":` + query.Get("Expires") + `}}}]}`
+			signature := strings.NewReplacer("-", "+", "_", "=", "~", "/").Replace(query.Get("Signature"))
+			decoded, err := base64.StdEncoding.DecodeString(signature)
+			if err != nil {
+				t.Fatalf("failed to decode signature: %v", err)
+			}
+			digest := sha1.Sum([]byte(policy))
+			if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, digest[:], decoded); err != nil {
+				t.Errorf("signature does not verify: %v", err)
+			}
+		})
+	}
+}
+
+func TestCloudFrontEncode(t *testing.T) {
+	// 标准Base64编码为 "+//++/8="
+	got := cloudFrontEncode([]byte{0xfb, 0xff, 0xfe, 0xfb, 0xff})
+	if strings.ContainsAny(got, "+=/") {
+		t.Errorf("cloudFrontEncode() = %q contains characters CloudFront rejects", got)
+	}
+	if want := "-~~--~8_"; got != want {
+		t.Errorf("cloudFrontEncode() = %q, want %q", got, want)
+	}
+}
+
+func parseUnix(t *testing.T, s string) int64 {
+	t.Helper()
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		t.Fatalf("invalid unix timestamp %q", s)
+	}
+	return n
+}
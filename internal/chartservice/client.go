@@ -3,33 +3,187 @@ package chartservice
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
+	"makeprofit/internal/config"
 	"makeprofit/pkg/utils"
 
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	defaultTimeout             = 30 * time.Second
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 10
+	defaultIdleConnTimeout     = 90 * time.Second
+)
+
 // Client 本地图表服务客户端
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
 	logger     *logrus.Logger
+
+	refreshTimeout time.Duration
+	renderTimeout  time.Duration
+	panelTimeout   time.Duration
+
+	bearerToken string
+	headers     map[string]string
+
+	refreshRules   *refreshRules
+	refreshTracker *RefreshTracker
+
+	imageValidator *imageValidator
 }
 
-// NewClient 创建新的本地图表服务客户端
-func NewClient(baseURL string) *Client {
+// NewClient 创建新的本地图表服务客户端，tracker为nil时使用独立的刷新记录
+func NewClient(cfg *config.ChartServiceConfig, tracker *RefreshTracker, logger *logrus.Logger) (*Client, error) {
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshRules, err := newRefreshRules(&cfg.Refresh)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	if tracker == nil {
+		tracker = NewRefreshTracker()
+	}
+
 	return &Client{
-		baseURL: baseURL,
+		baseURL: cfg.BaseURL,
+		// 超时由各操作通过context控制
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Transport: transport,
 		},
-		logger: utils.GetLogger(),
+		logger:         logger,
+		refreshTimeout: durationOr(cfg.RefreshTimeout, timeout),
+		renderTimeout:  durationOr(cfg.RenderTimeout, timeout),
+		panelTimeout:   durationOr(cfg.PanelTimeout, timeout),
+		bearerToken:    cfg.BearerToken,
+		headers:        cfg.Headers,
+		refreshRules:   refreshRules,
+		refreshTracker: tracker,
+		imageValidator: newImageValidator(&cfg.ImageValidation),
+	}, nil
+}
+
+// newTransport 根据配置创建HTTP传输层（连接池、TLS）
+func newTransport(cfg *config.ChartServiceConfig) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = intOr(cfg.MaxIdleConns, defaultMaxIdleConns)
+	transport.MaxIdleConnsPerHost = intOr(cfg.MaxIdleConnsPerHost, defaultMaxIdleConnsPerHost)
+	transport.IdleConnTimeout = durationOr(cfg.IdleConnTimeout, defaultIdleConnTimeout)
+
+	tlsCfg := cfg.TLS
+	if tlsCfg.CertFile == "" && tlsCfg.CAFile == "" && !tlsCfg.InsecureSkipVerify {
+		return transport, nil
 	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: tlsCfg.InsecureSkipVerify,
+	}
+
+	// 客户端证书（mTLS）
+	if tlsCfg.CertFile != "" || tlsCfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(tlsCfg.CertFile, tlsCfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load chart service client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	// 自定义CA
+	if tlsCfg.CAFile != "" {
+		caPEM, err := os.ReadFile(tlsCfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chart service CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no valid certificates found in %s", tlsCfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// newRequest 创建带鉴权头的请求
+func (c *Client) newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	for key, value := range c.headers {
+		req.Header.Set(key, value)
+	}
+	if c.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.bearerToken)
+	}
+	// 透传请求ID，便于与图表服务的日志关联
+	if requestID := utils.RequestID(ctx); requestID != "" {
+		req.Header.Set(utils.RequestIDHeader, requestID)
+	}
+
+	return req, nil
+}
+
+// log 返回带请求ID的日志
+func (c *Client) log(ctx context.Context) *logrus.Entry {
+	return utils.LoggerFromContext(ctx, c.logger)
+}
+
+func durationOr(d, fallback time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return fallback
+}
+
+func intOr(n, fallback int) int {
+	if n > 0 {
+		return n
+	}
+	return fallback
+}
+
+// StatusError 图表服务返回了非200状态码
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// maxErrorBodySize 错误响应体最多读取的字节数
+const maxErrorBodySize = 4 << 10
+
+// newStatusError 读取有限长度的错误响应体，避免异常的上游响应占用大量内存
+func newStatusError(resp *http.Response) *StatusError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	return &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
 }
 
 // PanelData 面板数据响应
@@ -41,8 +195,10 @@ type PanelData struct {
 
 // ChartImage 图表图片响应
 type ChartImage struct {
-	Data []byte
-	Type string
+	Data   []byte
+	Type   string
+	Width  int
+	Height int
 }
 
 // RefreshResponse 刷新响应
@@ -60,15 +216,18 @@ type SaveChartRequest struct {
 func (c *Client) GetPanelData(ctx context.Context, symbol, duration string) (*PanelData, error) {
 	url := fmt.Sprintf("%s/kline/panel/%s/%s", c.baseURL, symbol, duration)
 
-	c.logger.WithFields(logrus.Fields{
+	c.log(ctx).WithFields(logrus.Fields{
 		"symbol":   symbol,
 		"duration": duration,
 		"url":      url,
 	}).Info("Getting panel data")
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	ctx, cancel := context.WithTimeout(ctx, c.panelTimeout)
+	defer cancel()
+
+	req, err := c.newRequest(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
 	resp, err := c.httpClient.Do(req)
@@ -78,8 +237,7 @@ func (c *Client) GetPanelData(ctx context.Context, symbol, duration string) (*Pa
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, newStatusError(resp)
 	}
 
 	// 读取响应体
@@ -101,7 +259,7 @@ func (c *Client) GetPanelData(ctx context.Context, symbol, duration string) (*Pa
 		Message: "Data retrieved successfully",
 	}
 
-	c.logger.WithFields(logrus.Fields{
+	c.log(ctx).WithFields(logrus.Fields{
 		"symbol":    symbol,
 		"duration":  duration,
 		"data_type": fmt.Sprintf("%T", dataArray),
@@ -114,15 +272,18 @@ func (c *Client) GetPanelData(ctx context.Context, symbol, duration string) (*Pa
 func (c *Client) RefreshKlineData(ctx context.Context, symbol, duration string) (*RefreshResponse, error) {
 	url := fmt.Sprintf("%s/kline/refresh/%s/%s", c.baseURL, symbol, duration)
 
-	c.logger.WithFields(logrus.Fields{
+	c.log(ctx).WithFields(logrus.Fields{
 		"symbol":   symbol,
 		"duration": duration,
 		"url":      url,
 	}).Info("Refreshing kline data")
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	ctx, cancel := context.WithTimeout(ctx, c.refreshTimeout)
+	defer cancel()
+
+	req, err := c.newRequest(ctx, "POST", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
 	resp, err := c.httpClient.Do(req)
@@ -132,8 +293,7 @@ func (c *Client) RefreshKlineData(ctx context.Context, symbol, duration string)
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, newStatusError(resp)
 	}
 
 	var refreshResp RefreshResponse
@@ -148,15 +308,18 @@ func (c *Client) RefreshKlineData(ctx context.Context, symbol, duration string)
 func (c *Client) GetChartImage(ctx context.Context, symbol, duration string) (*ChartImage, error) {
 	url := fmt.Sprintf("%s/kline/chart/%s/%s", c.baseURL, symbol, duration)
 
-	c.logger.WithFields(logrus.Fields{
+	c.log(ctx).WithFields(logrus.Fields{
 		"symbol":   symbol,
 		"duration": duration,
 		"url":      url,
 	}).Info("Getting chart image")
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	ctx, cancel := context.WithTimeout(ctx, c.renderTimeout)
+	defer cancel()
+
+	req, err := c.newRequest(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
 	resp, err := c.httpClient.Do(req)
@@ -166,8 +329,7 @@ func (c *Client) GetChartImage(ctx context.Context, symbol, duration string) (*C
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, newStatusError(resp)
 	}
 
 	// 读取图片数据
@@ -176,15 +338,26 @@ func (c *Client) GetChartImage(ctx context.Context, symbol, duration string) (*C
 		return nil, fmt.Errorf("failed to read image data: %w", err)
 	}
 
-	// 获取Content-Type
+	// 校验图片内容，避免把错误页面或空白画布当作图片上传
+	width, height, detectedType, err := c.imageValidator.validate(imageData)
+	if err != nil {
+		return nil, err
+	}
+
+	// 获取Content-Type，优先使用根据内容检测出的图片类型
 	contentType := resp.Header.Get("Content-Type")
+	if strings.HasPrefix(detectedType, "image/") {
+		contentType = detectedType
+	}
 	if contentType == "" {
 		contentType = "image/png" // 默认假设是PNG
 	}
 
 	return &ChartImage{
-		Data: imageData,
-		Type: contentType,
+		Data:   imageData,
+		Type:   contentType,
+		Width:  width,
+		Height: height,
 	}, nil
 }
 
@@ -192,7 +365,7 @@ func (c *Client) GetChartImage(ctx context.Context, symbol, duration string) (*C
 func (c *Client) SaveChartImage(ctx context.Context, symbol, duration, filepath string) (*RefreshResponse, error) {
 	url := fmt.Sprintf("%s/kline/chart/%s/%s", c.baseURL, symbol, duration)
 
-	c.logger.WithFields(logrus.Fields{
+	c.log(ctx).WithFields(logrus.Fields{
 		"symbol":   symbol,
 		"duration": duration,
 		"filepath": filepath,
@@ -209,9 +382,12 @@ func (c *Client) SaveChartImage(ctx context.Context, symbol, duration, filepath
 		return nil, fmt.Errorf("failed to marshal request data: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	ctx, cancel := context.WithTimeout(ctx, c.renderTimeout)
+	defer cancel()
+
+	req, err := c.newRequest(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -223,8 +399,7 @@ func (c *Client) SaveChartImage(ctx context.Context, symbol, duration, filepath
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, newStatusError(resp)
 	}
 
 	var saveResp RefreshResponse
@@ -235,38 +410,63 @@ func (c *Client) SaveChartImage(ctx context.Context, symbol, duration, filepath
 	return &saveResp, nil
 }
 
-// TakeScreenshotWithRefresh 先刷新K线数据，然后获取图表图片
-func (c *Client) TakeScreenshotWithRefresh(ctx context.Context, symbol, duration string) (*ChartImage, error) {
-	c.logger.WithFields(logrus.Fields{
+// TakeScreenshotWithRefresh 按刷新策略刷新K线数据，然后获取图表图片
+// opts为nil时使用配置中该时间框架的刷新策略
+func (c *Client) TakeScreenshotWithRefresh(ctx context.Context, symbol, duration string, opts *RefreshOptions) (*ChartImage, error) {
+	c.log(ctx).WithFields(logrus.Fields{
 		"symbol":   symbol,
 		"duration": duration,
 	}).Info("Taking screenshot with refresh")
 
-	// 1. 先刷新K线数据
-	refreshResp, err := c.RefreshKlineData(ctx, symbol, duration)
-	if err != nil {
-		c.logger.WithError(err).Warn("Failed to refresh kline data, will continue with current data")
-	} else {
-		c.logger.WithFields(logrus.Fields{
-			"symbol":   symbol,
-			"duration": duration,
-			"success":  refreshResp.Success,
-			"message":  refreshResp.Message,
-		}).Info("Kline data refresh completed")
+	// 1. 按策略刷新K线数据
+	if err := c.Refresh(ctx, symbol, duration, opts); err != nil {
+		return nil, err
 	}
 
 	// 2. 获取图表图片
-	chartImage, err := c.GetChartImage(ctx, symbol, duration)
+	return c.RenderChartImage(ctx, symbol, duration)
+}
+
+// RenderChartImage 获取并校验图表图片，空白或无效图片时重新渲染
+func (c *Client) RenderChartImage(ctx context.Context, symbol, duration string) (*ChartImage, error) {
+	var chartImage *ChartImage
+	err := c.retryInvalidImage(ctx, symbol, duration, func() (err error) {
+		chartImage, err = c.GetChartImage(ctx, symbol, duration)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get chart image: %w", err)
 	}
 
-	c.logger.WithFields(logrus.Fields{
+	c.log(ctx).WithFields(logrus.Fields{
 		"symbol":       symbol,
 		"duration":     duration,
 		"image_size":   len(chartImage.Data),
+		"image_width":  chartImage.Width,
+		"image_height": chartImage.Height,
 		"content_type": chartImage.Type,
 	}).Info("Chart image retrieved successfully")
 
 	return chartImage, nil
 }
+
+// retryInvalidImage 执行渲染，图片未通过校验时按配置等待后重新渲染
+func (c *Client) retryInvalidImage(ctx context.Context, symbol, duration string, render func() error) error {
+	err := render()
+	for attempt := 1; err != nil && errors.Is(err, ErrInvalidImage) && attempt <= c.imageValidator.maxRetries; attempt++ {
+		c.log(ctx).WithError(err).WithFields(logrus.Fields{
+			"symbol":   symbol,
+			"duration": duration,
+			"attempt":  attempt,
+		}).Warn("Chart image failed validation, retrying render")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.imageValidator.retryDelay):
+		}
+
+		err = render()
+	}
+	return err
+}
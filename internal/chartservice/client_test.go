@@ -0,0 +1,50 @@
+package chartservice
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"makeprofit/internal/config"
+)
+
+func TestStatusErrorBodyIsLimited(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(strings.Repeat("x", 1<<20)))
+	}, config.ChartServiceConfig{})
+
+	calls := map[string]func() error{
+		"panel": func() error {
+			_, err := client.GetPanelData(context.Background(), "AAPL.US", "1d")
+			return err
+		},
+		"refresh": func() error {
+			_, err := client.RefreshKlineData(context.Background(), "AAPL.US", "1d")
+			return err
+		},
+		"chart": func() error {
+			_, err := client.GetChartImage(context.Background(), "AAPL.US", "1d")
+			return err
+		},
+		"stream": func() error {
+			_, err := client.OpenChartImage(context.Background(), "AAPL.US", "1d")
+			return err
+		},
+		"save": func() error {
+			_, err := client.SaveChartImage(context.Background(), "AAPL.US", "1d", "/tmp/chart.png")
+			return err
+		},
+	}
+	for name, call := range calls {
+		var statusErr *StatusError
+		if err := call(); !errors.As(err, &statusErr) {
+			t.Fatalf("%s error = %v, want *StatusError", name, err)
+		}
+		if statusErr.StatusCode != http.StatusInternalServerError || len(statusErr.Body) != maxErrorBodySize {
+			t.Errorf("%s error = status %d with %d byte body, want 500 with %d bytes", name, statusErr.StatusCode, len(statusErr.Body), maxErrorBodySize)
+		}
+	}
+}
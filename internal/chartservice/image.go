@@ -0,0 +1,206 @@
+package chartservice
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"makeprofit/internal/config"
+)
+
+const (
+	defaultMinImageWidth   = 100
+	defaultMinImageHeight  = 100
+	defaultMinContentRatio = 0.005
+	defaultMaxImagePixels  = 40_000_000
+	defaultRenderRetries   = 1
+	defaultRenderRetryWait = time.Second
+
+	// 统计像素时的最大采样点数，避免大图逐像素扫描
+	maxSampledPixels = 250000
+	// 颜色分量差异阈值（16位色深），低于该值视为背景色
+	backgroundTolerance = 0x0800
+)
+
+// ErrInvalidImage 图表服务返回的内容不是有效的图表图片
+var ErrInvalidImage = errors.New("invalid chart image")
+
+// imageValidator 图表图片校验器
+type imageValidator struct {
+	disabled        bool
+	minWidth        int
+	minHeight       int
+	minContentRatio float64
+	maxPixels       int64
+	maxRetries      int
+	retryDelay      time.Duration
+}
+
+func newImageValidator(cfg *config.ImageValidationConfig) *imageValidator {
+	maxRetries := cfg.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultRenderRetries
+	}
+	if maxRetries < 0 {
+		maxRetries = 0
+	}
+
+	minContentRatio := cfg.MinContentRatio
+	if minContentRatio <= 0 {
+		minContentRatio = defaultMinContentRatio
+	}
+
+	maxPixels := cfg.MaxPixels
+	if maxPixels <= 0 {
+		maxPixels = defaultMaxImagePixels
+	}
+
+	return &imageValidator{
+		disabled:        cfg.Disabled,
+		minWidth:        intOr(cfg.MinWidth, defaultMinImageWidth),
+		minHeight:       intOr(cfg.MinHeight, defaultMinImageHeight),
+		minContentRatio: minContentRatio,
+		maxPixels:       maxPixels,
+		maxRetries:      maxRetries,
+		retryDelay:      durationOr(cfg.RetryDelay, defaultRenderRetryWait),
+	}
+}
+
+// validate 校验图片格式、尺寸和内容，返回宽高和检测出的Content-Type
+func (v *imageValidator) validate(data []byte) (width, height int, contentType string, err error) {
+	contentType = http.DetectContentType(data)
+	if v.disabled {
+		return 0, 0, contentType, nil
+	}
+
+	switch contentType {
+	case "image/png", "image/jpeg", "image/gif":
+	default:
+		return 0, 0, contentType, fmt.Errorf("%w: unexpected content type %s", ErrInvalidImage, contentType)
+	}
+
+	img, err := v.decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, contentType, err
+	}
+
+	width, height, err = v.check(img)
+	return width, height, contentType, err
+}
+
+// validateFile 校验磁盘上的图片，只读取文件头检测类型，解码时直接从文件读取
+func (v *imageValidator) validateFile(path string) (width, height int, contentType string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("failed to open chart image: %w", err)
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	contentType = http.DetectContentType(head[:n])
+	if v.disabled {
+		return 0, 0, contentType, nil
+	}
+
+	switch contentType {
+	case "image/png", "image/jpeg", "image/gif":
+	default:
+		return 0, 0, contentType, fmt.Errorf("%w: unexpected content type %s", ErrInvalidImage, contentType)
+	}
+
+	img, err := v.decode(file)
+	if err != nil {
+		return 0, 0, contentType, err
+	}
+
+	width, height, err = v.check(img)
+	return width, height, contentType, err
+}
+
+// decode 先只读取图片头检查像素数，超过上限时不做完整解码
+// 声明了超大画布的小文件完整解码时会分配大量内存
+func (v *imageValidator) decode(r io.ReadSeeker) (image.Image, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read chart image: %w", err)
+	}
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode image: %v", ErrInvalidImage, err)
+	}
+	if pixels := int64(cfg.Width) * int64(cfg.Height); pixels > v.maxPixels {
+		return nil, fmt.Errorf("%w: image too large (%dx%d, maximum %d pixels)",
+			ErrInvalidImage, cfg.Width, cfg.Height, v.maxPixels)
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read chart image: %w", err)
+	}
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode image: %v", ErrInvalidImage, err)
+	}
+	return img, nil
+}
+
+// check 校验解码后图片的尺寸和内容
+func (v *imageValidator) check(img image.Image) (width, height int, err error) {
+	bounds := img.Bounds()
+	width, height = bounds.Dx(), bounds.Dy()
+	if width < v.minWidth || height < v.minHeight {
+		return width, height, fmt.Errorf("%w: image too small (%dx%d, minimum %dx%d)",
+			ErrInvalidImage, width, height, v.minWidth, v.minHeight)
+	}
+
+	if ratio := contentRatio(img); ratio < v.minContentRatio {
+		return width, height, fmt.Errorf("%w: image looks blank (content ratio %.4f, minimum %.4f)",
+			ErrInvalidImage, ratio, v.minContentRatio)
+	}
+
+	return width, height, nil
+}
+
+// contentRatio 计算与背景色（左上角像素）不同的像素占比
+func contentRatio(img image.Image) float64 {
+	bounds := img.Bounds()
+	total := bounds.Dx() * bounds.Dy()
+	if total == 0 {
+		return 0
+	}
+
+	step := 1
+	for total/(step*step) > maxSampledPixels {
+		step++
+	}
+
+	bgR, bgG, bgB, bgA := img.At(bounds.Min.X, bounds.Min.Y).RGBA()
+
+	var sampled, content int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			r, g, b, a := img.At(x, y).RGBA()
+			sampled++
+			if colorDiff(r, bgR) > backgroundTolerance || colorDiff(g, bgG) > backgroundTolerance ||
+				colorDiff(b, bgB) > backgroundTolerance || colorDiff(a, bgA) > backgroundTolerance {
+				content++
+			}
+		}
+	}
+
+	return float64(content) / float64(sampled)
+}
+
+func colorDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,259 @@
+package chartservice
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"makeprofit/internal/config"
+)
+
+// testImage 生成白底图片，在左上角画出 content 比例的黑色像素
+func testImage(width, height int, content float64) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	black := int(float64(width*height) * content)
+	for i := 0; i < width*height; i++ {
+		c := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+		// 跳过左上角像素，保证背景色为白色
+		if i > 0 && i <= black {
+			c = color.RGBA{A: 255}
+		}
+		img.Set(i%width, i/width, c)
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("jpeg.Encode() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+// pngHeader 只包含文件签名和IHDR块的PNG，声明任意大小的画布而不含像素数据
+func pngHeader(width, height uint32) []byte {
+	ihdr := binary.BigEndian.AppendUint32([]byte("IHDR"), width)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, height)
+	ihdr = append(ihdr, 8, 6, 0, 0, 0) // 8位RGBA，无隔行
+
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = binary.BigEndian.AppendUint32(data, uint32(len(ihdr)-4))
+	data = append(data, ihdr...)
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(ihdr))
+}
+
+func TestImageValidatorValidate(t *testing.T) {
+	valid := encodePNG(t, testImage(200, 150, 0.1))
+
+	tests := []struct {
+		name        string
+		cfg         config.ImageValidationConfig
+		data        []byte
+		wantType    string
+		wantWidth   int
+		wantHeight  int
+		wantInvalid bool
+	}{
+		{name: "valid png", data: valid, wantType: "image/png", wantWidth: 200, wantHeight: 150},
+		{
+			name:       "valid jpeg",
+			data:       encodeJPEG(t, testImage(200, 150, 0.1)),
+			wantType:   "image/jpeg",
+			wantWidth:  200,
+			wantHeight: 150,
+		},
+		{
+			name:        "html error page",
+			data:        []byte("<!DOCTYPE html><html><body>502 Bad Gateway</body></html>"),
+			wantType:    "text/html; charset=utf-8",
+			wantInvalid: true,
+		},
+		{
+			name:        "truncated png",
+			data:        valid[:len(valid)/2],
+			wantType:    "image/png",
+			wantInvalid: true,
+		},
+		{
+			name:        "too small",
+			data:        encodePNG(t, testImage(50, 150, 0.1)),
+			wantType:    "image/png",
+			wantWidth:   50,
+			wantHeight:  150,
+			wantInvalid: true,
+		},
+		{
+			name:       "custom minimum size",
+			cfg:        config.ImageValidationConfig{MinWidth: 40, MinHeight: 40},
+			data:       encodePNG(t, testImage(50, 50, 0.1)),
+			wantType:   "image/png",
+			wantWidth:  50,
+			wantHeight: 50,
+		},
+		{
+			name:        "blank canvas",
+			data:        encodePNG(t, testImage(200, 150, 0)),
+			wantType:    "image/png",
+			wantWidth:   200,
+			wantHeight:  150,
+			wantInvalid: true,
+		},
+		{
+			name:        "custom content ratio",
+			cfg:         config.ImageValidationConfig{MinContentRatio: 0.5},
+			data:        valid,
+			wantType:    "image/png",
+			wantWidth:   200,
+			wantHeight:  150,
+			wantInvalid: true,
+		},
+		{
+			// 未达到上限的画布只在完整解码时因缺少像素数据失败
+			name:        "header only",
+			data:        pngHeader(200, 150),
+			wantType:    "image/png",
+			wantInvalid: true,
+		},
+		{
+			name:        "huge canvas",
+			data:        pngHeader(100000, 100000),
+			wantType:    "image/png",
+			wantInvalid: true,
+		},
+		{
+			name:        "custom max pixels",
+			cfg:         config.ImageValidationConfig{MaxPixels: 200*150 - 1},
+			data:        valid,
+			wantType:    "image/png",
+			wantInvalid: true,
+		},
+		{
+			name:     "disabled skips checks",
+			cfg:      config.ImageValidationConfig{Disabled: true},
+			data:     []byte("not an image"),
+			wantType: "text/plain; charset=utf-8",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newImageValidator(&tt.cfg)
+			width, height, contentType, err := v.validate(tt.data)
+			if tt.wantInvalid != (err != nil) {
+				t.Fatalf("validate() error = %v, wantInvalid %v", err, tt.wantInvalid)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidImage) {
+				t.Errorf("validate() error = %v, want ErrInvalidImage", err)
+			}
+			if contentType != tt.wantType {
+				t.Errorf("content type = %q, want %q", contentType, tt.wantType)
+			}
+			if width != tt.wantWidth || height != tt.wantHeight {
+				t.Errorf("size = %dx%d, want %dx%d", width, height, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestImageValidatorRejectsHugeCanvasBeforeDecode(t *testing.T) {
+	v := newImageValidator(&config.ImageValidationConfig{})
+	_, _, _, err := v.validate(pngHeader(100000, 100000))
+	if err == nil || !strings.Contains(err.Error(), "image too large (100000x100000") {
+		t.Errorf("validate() error = %v, want image too large", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "huge.png")
+	if err := os.WriteFile(path, pngHeader(100000, 100000), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	_, _, _, err = v.validateFile(path)
+	if err == nil || !strings.Contains(err.Error(), "image too large") {
+		t.Errorf("validateFile() error = %v, want image too large", err)
+	}
+}
+
+func TestImageValidatorValidateFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		wantType    string
+		wantInvalid bool
+		wantErr     bool
+	}{
+		{name: "valid", path: write("valid.png", encodePNG(t, testImage(200, 150, 0.1))), wantType: "image/png"},
+		// 扩展名为.png的JPEG按内容识别
+		{name: "jpeg content", path: write("chart.png", encodeJPEG(t, testImage(200, 150, 0.1))), wantType: "image/jpeg"},
+		{name: "blank", path: write("blank.png", encodePNG(t, testImage(200, 150, 0))), wantType: "image/png", wantInvalid: true},
+		{name: "empty file", path: write("empty.png", nil), wantType: "text/plain; charset=utf-8", wantInvalid: true},
+		{name: "missing file", path: filepath.Join(dir, "missing.png"), wantErr: true},
+	}
+	v := newImageValidator(&config.ImageValidationConfig{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, contentType, err := v.validateFile(tt.path)
+			if (err != nil) != (tt.wantInvalid || tt.wantErr) {
+				t.Fatalf("validateFile() error = %v", err)
+			}
+			if tt.wantInvalid && !errors.Is(err, ErrInvalidImage) {
+				t.Errorf("validateFile() error = %v, want ErrInvalidImage", err)
+			}
+			if tt.wantErr && errors.Is(err, ErrInvalidImage) {
+				t.Errorf("validateFile() error = %v, want I/O error", err)
+			}
+			if contentType != tt.wantType {
+				t.Errorf("content type = %q, want %q", contentType, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestContentRatio(t *testing.T) {
+	tests := []struct {
+		name    string
+		img     image.Image
+		want    float64
+		epsilon float64
+	}{
+		{name: "blank", img: testImage(100, 100, 0), want: 0},
+		{name: "ten percent", img: testImage(100, 100, 0.1), want: 0.1, epsilon: 0.001},
+		{name: "empty bounds", img: image.NewRGBA(image.Rect(0, 0, 0, 0)), want: 0},
+		// 超过采样上限的大图按步长采样，比例仍然接近
+		{name: "sampled", img: testImage(1000, 600, 0.5), want: 0.5, epsilon: 0.01},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := contentRatio(tt.img)
+			if diff := got - tt.want; diff > tt.epsilon || diff < -tt.epsilon {
+				t.Errorf("contentRatio() = %.4f, want %.4f", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package chartservice
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"makeprofit/internal/config"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+// RefreshPolicy K线数据刷新策略
+type RefreshPolicy string
+
+const (
+	// RefreshAlways 每次都刷新，刷新失败时继续使用现有数据
+	RefreshAlways RefreshPolicy = "always"
+	// RefreshNever 从不刷新
+	RefreshNever RefreshPolicy = "never"
+	// RefreshIfOlderThan 距上次成功刷新超过MaxAge时才刷新
+	RefreshIfOlderThan RefreshPolicy = "if_older_than"
+	// RefreshRequired 每次都刷新，刷新失败则整个请求失败
+	RefreshRequired RefreshPolicy = "required"
+)
+
+// ParseRefreshPolicy 解析刷新策略，空字符串返回空策略（使用默认值）
+func ParseRefreshPolicy(s string) (RefreshPolicy, error) {
+	switch p := RefreshPolicy(s); p {
+	case "", RefreshAlways, RefreshNever, RefreshIfOlderThan, RefreshRequired:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown refresh policy %q", s)
+	}
+}
+
+// RefreshOptions 单次请求的刷新选项
+type RefreshOptions struct {
+	Policy RefreshPolicy
+	MaxAge time.Duration
+}
+
+// RefreshTracker 记录每个symbol/timeframe最近一次成功刷新的时间，并合并进行中的刷新
+// 由调用方持有并传给 NewClient，配置热更新重建客户端时继续使用，不会因重载而强制刷新
+type RefreshTracker struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+
+	// 同一symbol/timeframe同时只发起一次刷新，并发请求等待并共享结果
+	inflight singleflight.Group
+}
+
+// NewRefreshTracker 创建刷新记录
+func NewRefreshTracker() *RefreshTracker {
+	return &RefreshTracker{last: make(map[string]time.Time)}
+}
+
+// Reset 清空刷新记录，切换到另一个图表服务时使用
+func (t *RefreshTracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last = make(map[string]time.Time)
+}
+
+func (t *RefreshTracker) lastRefresh(symbol, duration string) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	at, ok := t.last[refreshKey(symbol, duration)]
+	return at, ok
+}
+
+func (t *RefreshTracker) markRefreshed(symbol, duration string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last[refreshKey(symbol, duration)] = at
+}
+
+// refreshKey symbol已包含市场后缀（如 AAPL.US），与时间框架共同确定一份K线数据
+func refreshKey(symbol, duration string) string {
+	return symbol + "/" + duration
+}
+
+// refreshRules 按时间框架解析的刷新策略
+type refreshRules struct {
+	defaultRule RefreshOptions
+	timeframes  map[string]RefreshOptions
+}
+
+func newRefreshRules(cfg *config.RefreshConfig) (*refreshRules, error) {
+	defaultRule, err := parseRefreshRule(cfg.Default, RefreshOptions{Policy: RefreshAlways})
+	if err != nil {
+		return nil, fmt.Errorf("invalid default refresh policy: %w", err)
+	}
+
+	rules := &refreshRules{
+		defaultRule: defaultRule,
+		timeframes:  make(map[string]RefreshOptions, len(cfg.Timeframes)),
+	}
+	for timeframe, rule := range cfg.Timeframes {
+		opts, err := parseRefreshRule(rule, defaultRule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid refresh policy for timeframe %s: %w", timeframe, err)
+		}
+		rules.timeframes[timeframe] = opts
+	}
+
+	return rules, nil
+}
+
+func parseRefreshRule(rule config.RefreshRuleConfig, fallback RefreshOptions) (RefreshOptions, error) {
+	policy, err := ParseRefreshPolicy(rule.Policy)
+	if err != nil {
+		return RefreshOptions{}, err
+	}
+	if policy == "" {
+		policy = fallback.Policy
+	}
+
+	opts := RefreshOptions{Policy: policy, MaxAge: durationOr(rule.MaxAge, fallback.MaxAge)}
+	if opts.Policy == RefreshIfOlderThan && opts.MaxAge <= 0 {
+		return RefreshOptions{}, fmt.Errorf("policy %s requires a positive max_age", RefreshIfOlderThan)
+	}
+	return opts, nil
+}
+
+// resolve 合并请求级选项与配置中的时间框架策略，请求级优先
+func (r *refreshRules) resolve(duration string, override *RefreshOptions) RefreshOptions {
+	opts, ok := r.timeframes[duration]
+	if !ok {
+		opts = r.defaultRule
+	}
+	if override == nil || override.Policy == "" {
+		return opts
+	}
+
+	resolved := *override
+	if resolved.Policy == RefreshIfOlderThan && resolved.MaxAge <= 0 {
+		resolved.MaxAge = opts.MaxAge
+	}
+	return resolved
+}
+
+// Refresh 按刷新策略刷新K线数据，opts为nil时使用配置中该时间框架的刷新策略
+// 仅在required策略下刷新失败时返回错误
+func (c *Client) Refresh(ctx context.Context, symbol, duration string, opts *RefreshOptions) error {
+	return c.refreshIfNeeded(ctx, symbol, duration, c.refreshRules.resolve(duration, opts))
+}
+
+// refreshIfNeeded 根据策略决定是否刷新K线数据，仅在required策略下刷新失败时返回错误
+func (c *Client) refreshIfNeeded(ctx context.Context, symbol, duration string, opts RefreshOptions) error {
+	fields := logrus.Fields{
+		"symbol":         symbol,
+		"duration":       duration,
+		"refresh_policy": opts.Policy,
+	}
+
+	switch opts.Policy {
+	case RefreshNever:
+		c.log(ctx).WithFields(fields).Debug("Skipping kline refresh by policy")
+		return nil
+	case RefreshIfOlderThan:
+		if at, ok := c.refreshTracker.lastRefresh(symbol, duration); ok && time.Since(at) < opts.MaxAge {
+			fields["last_refresh"] = at.Format(time.RFC3339)
+			c.log(ctx).WithFields(fields).Debug("Kline data refreshed recently, skipping refresh")
+			return nil
+		}
+	}
+
+	refreshResp, shared, err := c.refreshShared(ctx, symbol, duration)
+	if err != nil {
+		if opts.Policy == RefreshRequired {
+			return fmt.Errorf("failed to refresh kline data: %w", err)
+		}
+		c.log(ctx).WithError(err).WithFields(fields).Warn("Failed to refresh kline data, will continue with current data")
+		return nil
+	}
+
+	fields["message"] = refreshResp.Message
+	fields["shared"] = shared
+	c.log(ctx).WithFields(fields).Info("Kline data refresh completed")
+	return nil
+}
+
+// refreshShared 刷新K线数据，同一symbol/timeframe已有进行中的刷新时等待其结果而不重复请求图表服务
+// 刷新不随发起请求的ctx取消，避免一个客户端断开导致其他等待者失败；等待者只受自己的ctx约束
+func (c *Client) refreshShared(ctx context.Context, symbol, duration string) (*RefreshResponse, bool, error) {
+	tracker := c.refreshTracker
+	ch := tracker.inflight.DoChan(refreshKey(symbol, duration), func() (interface{}, error) {
+		resp, err := c.RefreshKlineData(context.WithoutCancel(ctx), symbol, duration)
+		if err != nil {
+			return nil, err
+		}
+		// 图表服务以200返回success:false时数据并未更新，不能记为成功刷新
+		if !resp.Success {
+			return nil, fmt.Errorf("chart service reported refresh failure: %s", resp.Message)
+		}
+		tracker.markRefreshed(symbol, duration, time.Now())
+		return resp, nil
+	})
+
+	select {
+	case result := <-ch:
+		if result.Err != nil {
+			return nil, result.Shared, result.Err
+		}
+		return result.Val.(*RefreshResponse), result.Shared, nil
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+}
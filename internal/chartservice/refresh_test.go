@@ -0,0 +1,301 @@
+package chartservice
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"makeprofit/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// newTestClient 创建指向测试服务器的客户端，handler为nil时刷新接口总是成功
+func newTestClient(t *testing.T, handler http.HandlerFunc, cfg config.ChartServiceConfig) *Client {
+	t.Helper()
+	if handler == nil {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(RefreshResponse{Success: true, Message: "ok"})
+		}
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cfg.BaseURL = server.URL
+	client, err := NewClient(&cfg, nil, testLogger())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return client
+}
+
+func TestParseRefreshPolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    RefreshPolicy
+		wantErr bool
+	}{
+		{in: "", want: ""},
+		{in: "always", want: RefreshAlways},
+		{in: "never", want: RefreshNever},
+		{in: "if_older_than", want: RefreshIfOlderThan},
+		{in: "required", want: RefreshRequired},
+		{in: "Always", wantErr: true},
+		{in: "sometimes", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRefreshPolicy(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRefreshPolicy(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRefreshPolicy(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNewRefreshRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.RefreshConfig
+		wantErr bool
+	}{
+		{name: "empty uses always", cfg: config.RefreshConfig{}},
+		{
+			name: "if_older_than with max_age",
+			cfg:  config.RefreshConfig{Default: config.RefreshRuleConfig{Policy: "if_older_than", MaxAge: time.Minute}},
+		},
+		{
+			name:    "if_older_than without max_age",
+			cfg:     config.RefreshConfig{Default: config.RefreshRuleConfig{Policy: "if_older_than"}},
+			wantErr: true,
+		},
+		{
+			name: "timeframe inherits default max_age",
+			cfg: config.RefreshConfig{
+				Default:    config.RefreshRuleConfig{Policy: "always", MaxAge: time.Minute},
+				Timeframes: map[string]config.RefreshRuleConfig{"1d": {Policy: "if_older_than"}},
+			},
+		},
+		{
+			name: "unknown timeframe policy",
+			cfg: config.RefreshConfig{
+				Timeframes: map[string]config.RefreshRuleConfig{"1h": {Policy: "often"}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newRefreshRules(&tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newRefreshRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRefreshRulesResolve(t *testing.T) {
+	rules, err := newRefreshRules(&config.RefreshConfig{
+		Default: config.RefreshRuleConfig{Policy: "always"},
+		Timeframes: map[string]config.RefreshRuleConfig{
+			"1d": {Policy: "if_older_than", MaxAge: time.Hour},
+			"1m": {Policy: "never"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("newRefreshRules() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		duration string
+		override *RefreshOptions
+		want     RefreshOptions
+	}{
+		{name: "default", duration: "1h", want: RefreshOptions{Policy: RefreshAlways}},
+		{name: "timeframe rule", duration: "1d", want: RefreshOptions{Policy: RefreshIfOlderThan, MaxAge: time.Hour}},
+		{name: "empty override", duration: "1m", override: &RefreshOptions{}, want: RefreshOptions{Policy: RefreshNever}},
+		{
+			name:     "override wins",
+			duration: "1d",
+			override: &RefreshOptions{Policy: RefreshRequired},
+			want:     RefreshOptions{Policy: RefreshRequired},
+		},
+		{
+			name:     "override max_age from timeframe",
+			duration: "1d",
+			override: &RefreshOptions{Policy: RefreshIfOlderThan},
+			want:     RefreshOptions{Policy: RefreshIfOlderThan, MaxAge: time.Hour},
+		},
+		{
+			name:     "override with own max_age",
+			duration: "1d",
+			override: &RefreshOptions{Policy: RefreshIfOlderThan, MaxAge: time.Minute},
+			want:     RefreshOptions{Policy: RefreshIfOlderThan, MaxAge: time.Minute},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rules.resolve(tt.duration, tt.override); got != tt.want {
+				t.Errorf("resolve(%q) = %+v, want %+v", tt.duration, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefreshIfNeeded(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        RefreshOptions
+		lastRefresh time.Duration // 距上次刷新的时间，0表示没有刷新记录
+		fail        bool
+		wantCalls   int32
+		wantErr     bool
+	}{
+		{name: "never", opts: RefreshOptions{Policy: RefreshNever}, wantCalls: 0},
+		{name: "always", opts: RefreshOptions{Policy: RefreshAlways}, lastRefresh: time.Second, wantCalls: 1},
+		{name: "always ignores failure", opts: RefreshOptions{Policy: RefreshAlways}, fail: true, wantCalls: 1},
+		{name: "required fails", opts: RefreshOptions{Policy: RefreshRequired}, fail: true, wantCalls: 1, wantErr: true},
+		{
+			name:        "if_older_than recent",
+			opts:        RefreshOptions{Policy: RefreshIfOlderThan, MaxAge: time.Hour},
+			lastRefresh: time.Minute,
+			wantCalls:   0,
+		},
+		{
+			name:        "if_older_than stale",
+			opts:        RefreshOptions{Policy: RefreshIfOlderThan, MaxAge: time.Minute},
+			lastRefresh: time.Hour,
+			wantCalls:   1,
+		},
+		{name: "if_older_than never refreshed", opts: RefreshOptions{Policy: RefreshIfOlderThan, MaxAge: time.Hour}, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				if tt.fail {
+					http.Error(w, "boom", http.StatusInternalServerError)
+					return
+				}
+				json.NewEncoder(w).Encode(RefreshResponse{Success: true})
+			}, config.ChartServiceConfig{})
+
+			if tt.lastRefresh > 0 {
+				client.refreshTracker.markRefreshed("AAPL.US", "1d", time.Now().Add(-tt.lastRefresh))
+			}
+
+			err := client.refreshIfNeeded(context.Background(), "AAPL.US", "1d", tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("refreshIfNeeded() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("refresh calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRefreshRejected(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      RefreshOptions
+		wantErr   bool
+		wantCalls int32 // 连续两次刷新对图表服务的调用次数
+	}{
+		{name: "required", opts: RefreshOptions{Policy: RefreshRequired}, wantErr: true, wantCalls: 2},
+		{name: "always", opts: RefreshOptions{Policy: RefreshAlways}, wantCalls: 2},
+		// 失败的刷新不记录时间，下一次请求仍然刷新
+		{name: "if_older_than", opts: RefreshOptions{Policy: RefreshIfOlderThan, MaxAge: time.Hour}, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				json.NewEncoder(w).Encode(RefreshResponse{Success: false, Message: "symbol not found"})
+			}, config.ChartServiceConfig{})
+
+			for i := 0; i < 2; i++ {
+				err := client.refreshIfNeeded(context.Background(), "AAPL.US", "1d", tt.opts)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("refreshIfNeeded() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("refresh calls = %d, want %d", got, tt.wantCalls)
+			}
+			if _, ok := client.refreshTracker.lastRefresh("AAPL.US", "1d"); ok {
+				t.Error("rejected refresh was recorded as successful")
+			}
+		})
+	}
+}
+
+func TestRefreshSharesInFlight(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		json.NewEncoder(w).Encode(RefreshResponse{Success: true})
+	}, config.ChartServiceConfig{})
+
+	const callers = 5
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := client.refreshIfNeeded(context.Background(), "AAPL.US", "1d", RefreshOptions{Policy: RefreshRequired}); err != nil {
+				t.Errorf("refreshIfNeeded() error = %v", err)
+			}
+		}()
+	}
+
+	// 等待第一个请求到达图表服务，其余调用方加入同一次刷新
+	deadline := time.Now().Add(5 * time.Second)
+	for calls.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("refresh calls = %d, want 1", got)
+	}
+	if _, ok := client.refreshTracker.lastRefresh("AAPL.US", "1d"); !ok {
+		t.Error("shared refresh was not recorded")
+	}
+}
+
+func TestRefreshWaiterCanceled(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}, config.ChartServiceConfig{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := client.refreshIfNeeded(ctx, "AAPL.US", "1d", RefreshOptions{Policy: RefreshRequired})
+	if err == nil {
+		t.Fatal("refreshIfNeeded() with canceled context returned nil error")
+	}
+}
@@ -0,0 +1,61 @@
+package chartservice
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SavedChartImage 图表服务写入共享目录并通过校验的图片
+type SavedChartImage struct {
+	Path   string
+	Type   string
+	Width  int // 关闭图片校验时为0
+	Height int
+}
+
+// RenderChartImageToFile 让图表服务把图片写入path并从磁盘校验，空白或无效图片时重新渲染
+// 校验规则与缓冲模式相同；Content-Type按文件内容检测，不依赖扩展名
+func (c *Client) RenderChartImageToFile(ctx context.Context, symbol, duration, path string) (*SavedChartImage, error) {
+	var saved *SavedChartImage
+	err := c.retryInvalidImage(ctx, symbol, duration, func() (err error) {
+		saved, err = c.saveAndValidate(ctx, symbol, duration, path)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save chart image: %w", err)
+	}
+
+	c.log(ctx).WithFields(logrus.Fields{
+		"symbol":       symbol,
+		"duration":     duration,
+		"shared_path":  path,
+		"image_width":  saved.Width,
+		"image_height": saved.Height,
+		"content_type": saved.Type,
+	}).Info("Chart image saved successfully")
+
+	return saved, nil
+}
+
+func (c *Client) saveAndValidate(ctx context.Context, symbol, duration, path string) (*SavedChartImage, error) {
+	saveResp, err := c.SaveChartImage(ctx, symbol, duration, path)
+	if err != nil {
+		return nil, err
+	}
+	if !saveResp.Success {
+		return nil, fmt.Errorf("chart service failed to save image: %s", saveResp.Message)
+	}
+
+	width, height, contentType, err := c.imageValidator.validateFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = "image/png" // 关闭校验时无法识别的内容按PNG上传
+	}
+
+	return &SavedChartImage{Path: path, Type: contentType, Width: width, Height: height}, nil
+}
@@ -0,0 +1,128 @@
+package chartservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"makeprofit/internal/config"
+)
+
+func TestRenderChartImageToFile(t *testing.T) {
+	valid := encodePNG(t, testImage(200, 150, 0.1))
+	blank := encodePNG(t, testImage(200, 150, 0))
+
+	tests := []struct {
+		name      string
+		images    [][]byte // 每次保存请求写入的内容，超出时重复最后一个
+		failSave  bool
+		wantCalls int32
+		wantErr   bool
+		invalid   bool
+	}{
+		{name: "valid image", images: [][]byte{valid}, wantCalls: 1},
+		{name: "blank then valid", images: [][]byte{blank, valid}, wantCalls: 2},
+		{name: "always blank", images: [][]byte{blank}, wantCalls: 2, wantErr: true, invalid: true},
+		{name: "save reported failure", failSave: true, wantCalls: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "NVDA_us_1d.png")
+
+			var calls atomic.Int32
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				n := calls.Add(1)
+				var req SaveChartRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.Method != http.MethodPost {
+					t.Errorf("unexpected save request %s: %v", r.Method, err)
+				}
+				if tt.failSave {
+					json.NewEncoder(w).Encode(RefreshResponse{Success: false, Message: "disk full"})
+					return
+				}
+				image := tt.images[min(int(n), len(tt.images))-1]
+				if err := os.WriteFile(req.FilePath, image, 0644); err != nil {
+					t.Errorf("WriteFile() error = %v", err)
+				}
+				json.NewEncoder(w).Encode(RefreshResponse{Success: true, Message: "saved"})
+			}, config.ChartServiceConfig{ImageValidation: config.ImageValidationConfig{MaxRetries: 1, RetryDelay: time.Millisecond}})
+
+			saved, err := client.RenderChartImageToFile(context.Background(), "NVDA.US", "1d", path)
+			if calls.Load() != tt.wantCalls {
+				t.Errorf("chart service called %d times, want %d", calls.Load(), tt.wantCalls)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("RenderChartImageToFile() error = nil, want error")
+				}
+				if errors.Is(err, ErrInvalidImage) != tt.invalid {
+					t.Errorf("RenderChartImageToFile() error = %v, invalid image %v", err, tt.invalid)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RenderChartImageToFile() error = %v", err)
+			}
+			if saved.Path != path || saved.Type != "image/png" || saved.Width != 200 || saved.Height != 150 {
+				t.Errorf("RenderChartImageToFile() = %+v", saved)
+			}
+		})
+	}
+}
+
+func TestOpenChartImage(t *testing.T) {
+	valid := encodePNG(t, testImage(200, 150, 0.1))
+
+	tests := []struct {
+		name     string
+		cfg      config.ImageValidationConfig
+		body     []byte
+		header   string
+		wantType string
+		wantErr  bool
+	}{
+		// 按文件头检测类型，不采信错误的Content-Type
+		{name: "png", body: valid, header: "application/octet-stream", wantType: "image/png"},
+		{name: "not an image", body: []byte("<html>error</html>"), wantErr: true},
+		{name: "validation disabled", cfg: config.ImageValidationConfig{Disabled: true}, body: []byte("raw"), header: "image/webp", wantType: "image/webp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if tt.header != "" {
+					w.Header().Set("Content-Type", tt.header)
+				}
+				w.Write(tt.body)
+			}, config.ChartServiceConfig{ImageValidation: tt.cfg})
+
+			stream, err := client.OpenChartImage(context.Background(), "NVDA.US", "1d")
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidImage) {
+					t.Fatalf("OpenChartImage() error = %v, want ErrInvalidImage", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("OpenChartImage() error = %v", err)
+			}
+			defer stream.Body.Close()
+
+			if stream.Type != tt.wantType || stream.Size != int64(len(tt.body)) {
+				t.Errorf("OpenChartImage() type %s size %d, want %s size %d", stream.Type, stream.Size, tt.wantType, len(tt.body))
+			}
+			// 预读的文件头不能丢失
+			data, err := io.ReadAll(stream.Body)
+			if err != nil || !bytes.Equal(data, tt.body) {
+				t.Errorf("stream body = %d bytes, %v; want %d bytes", len(data), err, len(tt.body))
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package chartservice
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 图片传输模式
+const (
+	ImageModeBuffered   = "buffered"
+	ImageModeStream     = "stream"
+	ImageModeSharedPath = "shared_path"
+)
+
+// ChartImageStream 流式图表图片响应，调用方负责关闭Body
+type ChartImageStream struct {
+	Body io.ReadCloser
+	Type string
+	Size int64 // 未知时为-1
+}
+
+// OpenChartImage 获取图表图片但不读入内存，返回的Body可直接用于上传
+// 流式模式下只校验文件头，不做尺寸和空白检测
+func (c *Client) OpenChartImage(ctx context.Context, symbol, duration string) (*ChartImageStream, error) {
+	url := fmt.Sprintf("%s/kline/chart/%s/%s", c.baseURL, symbol, duration)
+
+	c.log(ctx).WithFields(logrus.Fields{
+		"symbol":   symbol,
+		"duration": duration,
+		"url":      url,
+	}).Info("Opening chart image stream")
+
+	ctx, cancel := context.WithTimeout(ctx, c.renderTimeout)
+
+	req, err := c.newRequest(ctx, "GET", url, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		statusErr := newStatusError(resp)
+		resp.Body.Close()
+		cancel()
+		return nil, statusErr
+	}
+
+	// 预读文件头检测图片类型
+	reader := bufio.NewReaderSize(resp.Body, 512)
+	head, _ := reader.Peek(512)
+	detectedType := http.DetectContentType(head)
+	if !c.imageValidator.disabled && !strings.HasPrefix(detectedType, "image/") {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("%w: unexpected content type %s", ErrInvalidImage, detectedType)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if strings.HasPrefix(detectedType, "image/") {
+		contentType = detectedType
+	}
+	if contentType == "" {
+		contentType = "image/png"
+	}
+
+	return &ChartImageStream{
+		Body: &streamBody{Reader: reader, closer: resp.Body, cancel: cancel},
+		Type: contentType,
+		Size: resp.ContentLength,
+	}, nil
+}
+
+// streamBody 关闭时同时释放请求的超时context
+type streamBody struct {
+	io.Reader
+	closer io.Closer
+	cancel context.CancelFunc
+}
+
+func (b *streamBody) Close() error {
+	defer b.cancel()
+	return b.closer.Close()
+}
@@ -1,9 +1,13 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
 )
 
@@ -13,6 +17,16 @@ type Config struct {
 	CDN          CDNConfig          `mapstructure:"cdn"`
 	ChartService ChartServiceConfig `mapstructure:"chart_service"`
 	Logging      LoggingConfig      `mapstructure:"logging"`
+	Auth         AuthConfig         `mapstructure:"auth"`
+	RateLimit    RateLimitConfig    `mapstructure:"rate_limit"`
+	History      HistoryConfig      `mapstructure:"history"`
+	Retention    RetentionConfig    `mapstructure:"retention"`
+	Webhook      WebhookConfig      `mapstructure:"webhook"`
+
+	// 配置内容的哈希，用于识别当前生效的配置版本
+	Revision string `mapstructure:"-"`
+	// 各配置项的生效值和来源
+	Sources []ValueSource `mapstructure:"-" json:"-"`
 }
 
 type ServerConfig struct {
@@ -20,60 +34,308 @@ type ServerConfig struct {
 	Host         string        `mapstructure:"host"`
 	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
 	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+
+	// 可信反向代理的IP或CIDR，只有来自这些地址的 X-Forwarded-For 才用于识别客户端IP
+	// 为空时不信任任何代理，按连接的对端地址限流
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 type S3Config struct {
 	Region          string `mapstructure:"region"`
 	Bucket          string `mapstructure:"bucket"`
 	ImagePrefix     string `mapstructure:"image_prefix"`
-	AccessKeyID     string `mapstructure:"access_key_id"`
-	SecretAccessKey string `mapstructure:"secret_access_key"`
+	AccessKeyID     string `mapstructure:"access_key_id" secret:"true"`
+	SecretAccessKey string `mapstructure:"secret_access_key" secret:"true"`
+
+	// 启用后按SHA-256将内容存放在 objects/sha256/ 下，原有key作为指向该内容的别名
+	ContentAddressed bool `mapstructure:"content_addressed"`
+
+	// 按时间周期设置 Cache-Control，未配置的周期使用 "default"
+	CacheControl map[string]string `mapstructure:"cache_control"`
+
+	// 启用后为对象附加S3标签（kind、market、timeframe及自定义标签），需要 s3:PutObjectTagging 权限
+	Tagging bool              `mapstructure:"tagging"`
+	Tags    map[string]string `mapstructure:"tags"`
+
+	// 单个对象的上传超时，分片上传时为整个对象的超时，默认2分钟
+	UploadTimeout time.Duration   `mapstructure:"upload_timeout"`
+	Multipart     MultipartConfig `mapstructure:"multipart"`
+}
+
+// MultipartConfig 分片上传配置，超过PartSize的对象自动分片并行上传
+type MultipartConfig struct {
+	PartSize    int64  `mapstructure:"part_size"`    // 分片大小（字节），最小5MiB
+	Concurrency int    `mapstructure:"concurrency"`  // 并行上传的分片数
+	Checksum    string `mapstructure:"checksum"`     // 校验算法：crc32c、sha256，为空时使用SDK默认的CRC32
+	MaxAttempts int    `mapstructure:"max_attempts"` // 单个分片请求的最大尝试次数，失败的分片单独重试
 }
 
 type CDNConfig struct {
 	BaseURL string `mapstructure:"base_url"`
+
+	// 返回给客户端的URL类型：public（默认）、s3_presigned、cloudfront_signed、hmac_signed
+	URLMode string        `mapstructure:"url_mode"`
+	URLTTL  time.Duration `mapstructure:"url_ttl"` // 签名URL有效期
+
+	// CloudFront签名URL配置
+	KeyPairID      string `mapstructure:"key_pair_id"`
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+
+	// HMAC签名URL配置，适用于支持secure link的CDN/Nginx
+	HMACSecret string `mapstructure:"hmac_secret" secret:"true"`
+
+	// 覆盖已有key后的CDN缓存失效配置
+	Invalidation InvalidationConfig `mapstructure:"invalidation"`
+}
+
+// InvalidationConfig CDN缓存失效配置
+type InvalidationConfig struct {
+	// none（默认）、purge（覆盖后清除CDN缓存）、version（在返回的URL上追加 ?v=<hash>）
+	Mode string `mapstructure:"mode"`
+
+	// purge模式的提供方：cloudfront、cloudflare、webhook
+	Provider      string        `mapstructure:"provider"`
+	BatchSize     int           `mapstructure:"batch_size"`     // 单次失效请求的最大URL数
+	BatchInterval time.Duration `mapstructure:"batch_interval"` // 攒批时间
+	MinInterval   time.Duration `mapstructure:"min_interval"`   // 两次失效请求的最小间隔
+	Timeout       time.Duration `mapstructure:"timeout"`
+
+	// CloudFront
+	DistributionID string `mapstructure:"distribution_id"`
+
+	// Cloudflare
+	ZoneID   string `mapstructure:"zone_id"`
+	APIToken string `mapstructure:"api_token" secret:"true"`
+
+	// 通用HTTP purge webhook，POST {"urls": [...], "paths": [...]}
+	WebhookURL     string            `mapstructure:"webhook_url"`
+	WebhookHeaders map[string]string `mapstructure:"webhook_headers" secret:"true"`
 }
 
 type ChartServiceConfig struct {
 	BaseURL string `mapstructure:"base_url"`
+
+	// 各类操作的超时时间，未配置时使用 Timeout
+	Timeout        time.Duration `mapstructure:"timeout"`
+	RefreshTimeout time.Duration `mapstructure:"refresh_timeout"`
+	RenderTimeout  time.Duration `mapstructure:"render_timeout"`
+	PanelTimeout   time.Duration `mapstructure:"panel_timeout"`
+
+	// 连接池配置
+	MaxIdleConns        int           `mapstructure:"max_idle_conns"`
+	MaxIdleConnsPerHost int           `mapstructure:"max_idle_conns_per_host"`
+	IdleConnTimeout     time.Duration `mapstructure:"idle_conn_timeout"`
+
+	// 鉴权配置，用于受保护的图表服务
+	BearerToken string            `mapstructure:"bearer_token" secret:"true"`
+	Headers     map[string]string `mapstructure:"headers" secret:"true"`
+
+	TLS ChartServiceTLSConfig `mapstructure:"tls"`
+
+	Refresh RefreshConfig `mapstructure:"refresh"`
+
+	ImageValidation ImageValidationConfig `mapstructure:"image_validation"`
+
+	// 图片传输模式：buffered（默认，读入内存）、stream（直接转发到存储）、
+	// shared_path（图表服务写入共享目录后从磁盘上传，需与图表服务部署在同一主机）
+	ImageMode string `mapstructure:"image_mode"`
+	SharedDir string `mapstructure:"shared_dir"`
+}
+
+// ImageValidationConfig 图表图片校验配置，数值为0时使用默认值
+type ImageValidationConfig struct {
+	Disabled        bool          `mapstructure:"disabled"`
+	MinWidth        int           `mapstructure:"min_width"`
+	MinHeight       int           `mapstructure:"min_height"`
+	MinContentRatio float64       `mapstructure:"min_content_ratio"` // 非背景像素最小占比
+	MaxPixels       int64         `mapstructure:"max_pixels"`        // 完整解码前检查的最大像素数（宽×高）
+	MaxRetries      int           `mapstructure:"max_retries"`       // 空白图片重新渲染次数
+	RetryDelay      time.Duration `mapstructure:"retry_delay"`
+}
+
+// RefreshConfig K线刷新策略配置
+type RefreshConfig struct {
+	Default    RefreshRuleConfig            `mapstructure:"default"`
+	Timeframes map[string]RefreshRuleConfig `mapstructure:"timeframes"` // 按时间框架覆盖默认策略
+}
+
+// RefreshRuleConfig 单条刷新策略
+type RefreshRuleConfig struct {
+	Policy string        `mapstructure:"policy"`  // always, never, if_older_than, required
+	MaxAge time.Duration `mapstructure:"max_age"` // if_older_than 策略下的刷新间隔
+}
+
+// ChartServiceTLSConfig 图表服务TLS/mTLS配置
+type ChartServiceTLSConfig struct {
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+	CAFile             string `mapstructure:"ca_file"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+}
+
+// AuthConfig API Key鉴权配置
+type AuthConfig struct {
+	Enabled    bool           `mapstructure:"enabled"`
+	Header     string         `mapstructure:"header"`      // 默认 X-API-Key
+	QueryParam string         `mapstructure:"query_param"` // 默认 api_key
+	KeysFile   string         `mapstructure:"keys_file"`   // 可选，YAML格式的key列表文件
+	Keys       []APIKeyConfig `mapstructure:"keys"`
+}
+
+// APIKeyConfig 单个API Key配置
+type APIKeyConfig struct {
+	Name    string   `mapstructure:"name"`
+	Key     string   `mapstructure:"key" secret:"true"`
+	Scopes  []string `mapstructure:"scopes"`  // screenshot, data, admin
+	Markets []string `mapstructure:"markets"` // 为空表示允许所有市场
+}
+
+// RateLimitConfig 限流与每日配额配置
+type RateLimitConfig struct {
+	Enabled          bool              `mapstructure:"enabled"`
+	PerKey           TokenBucketConfig `mapstructure:"per_key"`
+	PerIP            TokenBucketConfig `mapstructure:"per_ip"`
+	DailyRenders     int64             `mapstructure:"daily_renders"`      // 每个客户端每日截图次数，0表示不限制
+	DailyUploadBytes int64             `mapstructure:"daily_upload_bytes"` // 每个客户端每日上传字节数，0表示不限制
+	UsageFile        string            `mapstructure:"usage_file"`         // 用量持久化文件，重启后配额不丢失
+	FlushInterval    time.Duration     `mapstructure:"flush_interval"`
+}
+
+// TokenBucketConfig 令牌桶配置，Rate为0表示不限制
+type TokenBucketConfig struct {
+	Rate  float64 `mapstructure:"rate"`  // 每秒补充的令牌数
+	Burst int     `mapstructure:"burst"` // 桶容量
+}
+
+// HistoryConfig 截图历史索引配置
+type HistoryConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Path    string `mapstructure:"path"` // BoltDB文件路径
+}
+
+// RetentionConfig 上传对象的保留策略配置
+type RetentionConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Interval time.Duration `mapstructure:"interval"` // 定期清理间隔，0表示只能通过管理接口触发
+	DryRun   bool          `mapstructure:"dry_run"`  // 只记录将要删除的对象，不实际删除
+	// 按时间框架设置保留时长，未配置的时间框架使用"default"，都未配置则永久保留
+	Rules map[string]time.Duration `mapstructure:"rules"`
+}
+
+// WebhookConfig 截图完成或失败时的webhook通知
+type WebhookConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// 签名密钥，请求级 callback_url 和未单独配置密钥的endpoint使用
+	Secret    string                  `mapstructure:"secret" secret:"true"`
+	Endpoints []WebhookEndpointConfig `mapstructure:"endpoints"`
+
+	// 允许请求通过 callback_url 指定回调地址，只允许CallbackHosts中的主机，且必须解析到公网地址
+	AllowCallbackURL bool     `mapstructure:"allow_callback_url"`
+	CallbackHosts    []string `mapstructure:"callback_hosts"`
+
+	MaxAttempts    int           `mapstructure:"max_attempts"`    // 含首次投递的最大尝试次数
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"` // 首次重试前的等待，之后每次翻倍
+	MaxBackoff     time.Duration `mapstructure:"max_backoff"`
+	Timeout        time.Duration `mapstructure:"timeout"`    // 单次投递的超时
+	QueueSize      int           `mapstructure:"queue_size"` // 同时进行中的投递上限，超出时丢弃并记录
+	LogSize        int           `mapstructure:"log_size"`   // 内存中保留的投递记录条数
+}
+
+// WebhookEndpointConfig 全局webhook地址
+type WebhookEndpointConfig struct {
+	URL    string   `mapstructure:"url"`
+	Secret string   `mapstructure:"secret" secret:"true"` // 为空时使用 webhook.secret
+	Events []string `mapstructure:"events"`               // capture.completed、capture.failed，为空时接收全部事件
 }
 
 type LoggingConfig struct {
 	Level  string `mapstructure:"level"`
 	Format string `mapstructure:"format"`
-	Output string `mapstructure:"output"`
+	// 输出目标：stdout（默认）、stderr、syslog、journald，其他值视为日志文件路径
+	Output   string            `mapstructure:"output"`
+	Rotation LogRotationConfig `mapstructure:"rotation"` // 输出到文件时的轮转配置
+	Syslog   SyslogConfig      `mapstructure:"syslog"`
 }
 
-var globalConfig *Config
+// LogRotationConfig 日志文件按大小和保留时间轮转
+type LogRotationConfig struct {
+	MaxSizeMB  int  `mapstructure:"max_size_mb"`  // 单个文件达到该大小后轮转
+	MaxAgeDays int  `mapstructure:"max_age_days"` // 旧文件保留天数，0表示不按时间清理
+	MaxBackups int  `mapstructure:"max_backups"`  // 旧文件保留个数，0表示不按个数清理
+	Compress   bool `mapstructure:"compress"`     // 使用gzip压缩轮转后的文件
+}
+
+// SyslogConfig syslog输出配置
+type SyslogConfig struct {
+	Network string `mapstructure:"network"` // 为空时使用本机syslog/journald套接字，远程时为udp或tcp
+	Address string `mapstructure:"address"` // 远程syslog地址，如 logs.example.com:514
+	Tag     string `mapstructure:"tag"`
+}
 
+// Load 加载并校验配置文件
+// 每次加载使用独立的viper实例，返回的Config在加载后不再修改，可在多个服务实例间安全共享
 func Load(configPath string) (*Config, error) {
-	viper.SetConfigFile(configPath)
-	viper.SetConfigType("yaml")
+	v := newViper(configPath)
 
-	// 启用环境变量支持
-	viper.AutomaticEnv()
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
 
-	// 绑定环境变量到配置键
-	viper.BindEnv("s3.region", "AWS_REGION")
-	viper.BindEnv("s3.bucket", "AWS_S3_BUCKET")
-	viper.BindEnv("s3.access_key_id", "AWS_ACCESS_KEY_ID")
-	viper.BindEnv("s3.secret_access_key", "AWS_SECRET_ACCESS_KEY")
-	viper.BindEnv("cdn.base_url", "CDN_BASE_URL")
-	viper.BindEnv("chart_service.base_url", "CHART_SERVICE_BASE_URL")
+	return decode(v)
+}
 
-	if err := viper.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+// newViper 创建读取configPath的viper实例，设置默认值和环境变量绑定
+// 优先级：*_FILE 文件 > 环境变量 > 配置文件 > 默认值
+func newViper(configPath string) *viper.Viper {
+	v := viper.New()
+	v.SetConfigFile(configPath)
+	v.SetConfigType("yaml")
+	setDefaults(v)
+
+	// 所有配置项都可通过 SCREENSHOT_ 前缀的环境变量设置
+	bindEnv(v)
+
+	return v
+}
+
+// decode 解析并校验viper中已读取的配置
+func decode(v *viper.Viper) (*Config, error) {
+	fileEnv, err := applyEnv(v)
+	if err != nil {
+		return nil, err
 	}
 
 	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
+	if err := v.Unmarshal(&config); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
-	globalConfig = &config
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	revision, err := json.Marshal(&config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute config revision: %w", err)
+	}
+	sum := sha256.Sum256(revision)
+	config.Revision = hex.EncodeToString(sum[:6])
+	config.Sources = valueSources(v, &config, fileEnv)
+
 	return &config, nil
 }
 
-func Get() *Config {
-	return globalConfig
+// Watch 监听配置文件变化，重新解析并校验后回调
+// 校验失败时回调收到错误，调用方应继续使用旧配置
+func Watch(configPath string, onChange func(*Config, error)) error {
+	v := newViper(configPath)
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	v.OnConfigChange(func(e fsnotify.Event) {
+		onChange(decode(v))
+	})
+	v.WatchConfig()
+	return nil
 }
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestLoadIsolated(t *testing.T) {
+	first, err := Load(writeConfig(t, minimalConfig+"server:\n  port: 8081\n"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	second, err := Load(writeConfig(t, strings.Replace(minimalConfig, "bucket: charts", "bucket: other", 1)))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	// 每次加载使用独立的viper实例，互不影响，也不写入全局viper
+	if first.Server.Port != 8081 || first.S3.Bucket != "charts" {
+		t.Errorf("first config = port %d bucket %s", first.Server.Port, first.S3.Bucket)
+	}
+	if second.Server.Port != 8080 || second.S3.Bucket != "other" {
+		t.Errorf("second config = port %d bucket %s, want the default port", second.Server.Port, second.S3.Bucket)
+	}
+	if viper.IsSet("s3.bucket") || viper.IsSet("server.port") {
+		t.Error("Load() modified the global viper instance")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	if _, err := Load(writeConfig(t, "s3: [")); err == nil || !strings.Contains(err.Error(), "failed to read config file") {
+		t.Errorf("Load() with invalid YAML error = %v", err)
+	}
+	if _, err := Load(writeConfig(t, "server:\n  port: 8080\n")); err == nil {
+		t.Error("Load() without required settings error = nil")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := writeConfig(t, minimalConfig)
+
+	changes := make(chan *Config, 10)
+	errs := make(chan error, 10)
+	err := Watch(path, func(cfg *Config, err error) {
+		if err != nil {
+			errs <- err
+			return
+		}
+		changes <- cfg
+	})
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+
+	waitFor := func(want func(*Config) bool) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case cfg := <-changes:
+				if want(cfg) {
+					return
+				}
+			case <-errs:
+			case <-timeout:
+				t.Fatal("timed out waiting for a config change")
+			}
+		}
+	}
+
+	// 无效的配置通过回调返回错误
+	if err := os.WriteFile(path, []byte("server:\n  port: 0\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the validation error")
+	}
+
+	if err := os.WriteFile(path, []byte(minimalConfig+"logging:\n  level: debug\n"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	waitFor(func(cfg *Config) bool { return cfg.Logging.Level == "debug" })
+}
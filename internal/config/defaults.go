@@ -0,0 +1,97 @@
+package config
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// setDefaults 为所有字段设置默认值，最小配置只需要填写S3的region和bucket
+func setDefaults(v *viper.Viper) {
+	// 服务器
+	v.SetDefault("server.port", 8080)
+	v.SetDefault("server.host", "0.0.0.0")
+	v.SetDefault("server.read_timeout", 30*time.Second)
+	v.SetDefault("server.write_timeout", 30*time.Second)
+
+	// S3
+	v.SetDefault("s3.image_prefix", "screenshot")
+	v.SetDefault("s3.content_addressed", false)
+	v.SetDefault("s3.cache_control", map[string]string{"default": "public, max-age=300"})
+	v.SetDefault("s3.tagging", false)
+	v.SetDefault("s3.upload_timeout", 2*time.Minute)
+	v.SetDefault("s3.multipart.part_size", 8*1024*1024)
+	v.SetDefault("s3.multipart.concurrency", 5)
+	v.SetDefault("s3.multipart.checksum", "crc32c")
+	v.SetDefault("s3.multipart.max_attempts", 3)
+
+	// CDN
+	v.SetDefault("cdn.url_mode", "public")
+	v.SetDefault("cdn.url_ttl", 24*time.Hour)
+	v.SetDefault("cdn.invalidation.mode", "none")
+	v.SetDefault("cdn.invalidation.batch_size", 30)
+	v.SetDefault("cdn.invalidation.batch_interval", 5*time.Second)
+	v.SetDefault("cdn.invalidation.min_interval", 10*time.Second)
+	v.SetDefault("cdn.invalidation.timeout", 30*time.Second)
+
+	// 图表服务
+	v.SetDefault("chart_service.base_url", "http://127.0.0.1:4009")
+	v.SetDefault("chart_service.timeout", 30*time.Second)
+	v.SetDefault("chart_service.refresh_timeout", 30*time.Second)
+	v.SetDefault("chart_service.render_timeout", 30*time.Second)
+	v.SetDefault("chart_service.panel_timeout", 15*time.Second)
+	v.SetDefault("chart_service.max_idle_conns", 100)
+	v.SetDefault("chart_service.max_idle_conns_per_host", 10)
+	v.SetDefault("chart_service.idle_conn_timeout", 90*time.Second)
+	v.SetDefault("chart_service.refresh.default.policy", "always")
+	v.SetDefault("chart_service.image_validation.min_width", 100)
+	v.SetDefault("chart_service.image_validation.min_height", 100)
+	v.SetDefault("chart_service.image_validation.min_content_ratio", 0.005)
+	v.SetDefault("chart_service.image_validation.max_pixels", 40000000)
+	v.SetDefault("chart_service.image_validation.max_retries", 1)
+	v.SetDefault("chart_service.image_validation.retry_delay", time.Second)
+	v.SetDefault("chart_service.image_mode", "buffered")
+
+	// 日志
+	v.SetDefault("logging.level", "info")
+	v.SetDefault("logging.format", "json")
+	v.SetDefault("logging.output", "stdout")
+	v.SetDefault("logging.rotation.max_size_mb", 100)
+	v.SetDefault("logging.rotation.max_age_days", 30)
+	v.SetDefault("logging.rotation.max_backups", 10)
+	v.SetDefault("logging.rotation.compress", true)
+	v.SetDefault("logging.syslog.tag", "screenshot-server")
+
+	// 鉴权
+	v.SetDefault("auth.enabled", false)
+	v.SetDefault("auth.header", "X-API-Key")
+	v.SetDefault("auth.query_param", "api_key")
+
+	// 限流
+	v.SetDefault("rate_limit.enabled", false)
+	v.SetDefault("rate_limit.per_key.rate", 1)
+	v.SetDefault("rate_limit.per_key.burst", 5)
+	v.SetDefault("rate_limit.per_ip.rate", 2)
+	v.SetDefault("rate_limit.per_ip.burst", 10)
+	v.SetDefault("rate_limit.usage_file", "./data/usage.json")
+	v.SetDefault("rate_limit.flush_interval", 30*time.Second)
+
+	// 历史索引
+	v.SetDefault("history.enabled", false)
+	v.SetDefault("history.path", "./data/history.db")
+
+	// 保留策略
+	v.SetDefault("retention.enabled", false)
+	v.SetDefault("retention.interval", 24*time.Hour)
+	v.SetDefault("retention.dry_run", true)
+
+	// webhook通知
+	v.SetDefault("webhook.enabled", false)
+	v.SetDefault("webhook.allow_callback_url", false)
+	v.SetDefault("webhook.max_attempts", 5)
+	v.SetDefault("webhook.initial_backoff", time.Second)
+	v.SetDefault("webhook.max_backoff", time.Minute)
+	v.SetDefault("webhook.timeout", 10*time.Second)
+	v.SetDefault("webhook.queue_size", 100)
+	v.SetDefault("webhook.log_size", 1000)
+}
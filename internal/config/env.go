@@ -0,0 +1,276 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix 环境变量前缀，配置项 chart_service.base_url 对应 SCREENSHOT_CHART_SERVICE_BASE_URL
+const EnvPrefix = "SCREENSHOT"
+
+// fileEnvSuffix 以该后缀结尾的环境变量表示从文件读取配置值，适用于Docker/Kubernetes secrets
+const fileEnvSuffix = "_FILE"
+
+const redacted = "******"
+
+// legacyEnv 兼容旧版本的环境变量名，优先级低于 SCREENSHOT_ 前缀
+var legacyEnv = map[string][]string{
+	"s3.region":                  {"AWS_REGION"},
+	"s3.bucket":                  {"AWS_S3_BUCKET"},
+	"s3.access_key_id":           {"AWS_ACCESS_KEY_ID"},
+	"s3.secret_access_key":       {"AWS_SECRET_ACCESS_KEY"},
+	"cdn.base_url":               {"CDN_BASE_URL"},
+	"chart_service.base_url":     {"CHART_SERVICE_BASE_URL"},
+	"chart_service.bearer_token": {"CHART_SERVICE_BEARER_TOKEN"},
+}
+
+// ValueSource 配置项的生效值及其来源
+type ValueSource struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`  // 敏感配置已脱敏
+	Source string `json:"source"` // default、config、env:<变量名>、file:<变量名>
+}
+
+// configKey 可通过环境变量设置的配置项
+type configKey struct {
+	name       string
+	secret     bool
+	structured bool         // map或slice类型，环境变量值按JSON解析
+	typ        reflect.Type // 字段类型
+	index      []int        // 在Config中的字段路径
+}
+
+// keys Config中所有可通过环境变量设置的配置项
+var keys = configKeys(reflect.TypeOf(Config{}), "", nil)
+
+// configKeys 按mapstructure标签遍历配置结构体，标记 secret:"true" 的字段为敏感配置
+// map和slice类型的配置项整体作为一个配置项，不再展开
+func configKeys(t reflect.Type, prefix string, index []int) []configKey {
+	var result []configKey
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("mapstructure")
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		name := prefix + tag
+		fieldIndex := append(append([]int(nil), index...), i)
+		key := configKey{
+			name:   name,
+			secret: field.Tag.Get("secret") == "true",
+			typ:    field.Type,
+			index:  fieldIndex,
+		}
+		switch field.Type.Kind() {
+		case reflect.Struct:
+			result = append(result, configKeys(field.Type, name+".", fieldIndex)...)
+		case reflect.Map, reflect.Slice:
+			key.structured = true
+			result = append(result, key)
+		default:
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
+// envNames 配置项对应的环境变量名，按优先级排列
+func envNames(key string) []string {
+	name := EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+	return append([]string{name}, legacyEnv[key]...)
+}
+
+// bindEnv 为标量配置项绑定环境变量，map和slice类型的配置项由 applyEnv 解析后设置
+func bindEnv(v *viper.Viper) {
+	for _, key := range keys {
+		if key.structured {
+			continue
+		}
+		v.BindEnv(append([]string{key.name}, envNames(key.name)...)...)
+	}
+}
+
+// applyEnv 读取 <环境变量>_FILE 指向的文件内容作为配置值，优先级高于其他来源；
+// map和slice类型的配置项同样支持直接设置环境变量，值按JSON解析
+// 值通过 v.Set 写入覆盖层，配置文件热更新时这些配置项仍使用环境变量的值，见 EnvOverrides
+// 返回通过文件设置的配置项到所用环境变量名的映射
+func applyEnv(v *viper.Viper) (map[string]string, error) {
+	applied := make(map[string]string)
+	for _, key := range keys {
+		value, name, fromFile, err := envValue(key)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			continue
+		}
+
+		if key.structured {
+			parsed, err := parseStructured(key, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			v.Set(key.name, parsed)
+		} else {
+			v.Set(key.name, value)
+		}
+		if fromFile {
+			applied[key.name] = name
+		}
+	}
+	return applied, nil
+}
+
+// envValue 查找配置项的环境变量值，*_FILE 优先；标量配置项的普通环境变量已由viper绑定，这里只处理文件
+func envValue(key configKey) (value, name string, fromFile bool, err error) {
+	for _, envName := range envNames(key.name) {
+		path := os.Getenv(envName + fileEnvSuffix)
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", "", false, fmt.Errorf("failed to read %s%s: %w", envName, fileEnvSuffix, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), envName + fileEnvSuffix, true, nil
+	}
+
+	if key.structured {
+		if envName := setEnv(key.name); envName != "" {
+			return os.Getenv(envName), envName, false, nil
+		}
+	}
+	return "", "", false, nil
+}
+
+// parseStructured 解析map和slice类型配置项的值：JSON对象或数组，字符串列表也可以用逗号分隔
+func parseStructured(key configKey, value string) (interface{}, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "{") || strings.HasPrefix(value, "[") {
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		return parsed, nil
+	}
+
+	if key.typ.Kind() == reflect.Slice && key.typ.Elem().Kind() == reflect.String {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("%s must be a JSON %s", key.name, key.typ.Kind())
+}
+
+// valueSources 统计每个已设置配置项的生效值和来源
+func valueSources(v *viper.Viper, config *Config, fileEnv map[string]string) []ValueSource {
+	root := reflect.ValueOf(config).Elem()
+
+	var sources []ValueSource
+	for _, key := range keys {
+		if !v.IsSet(key.name) {
+			continue
+		}
+
+		source := "default"
+		if name, ok := fileEnv[key.name]; ok {
+			source = "file:" + name
+		} else if name := setEnv(key.name); name != "" {
+			source = "env:" + name
+		} else if v.InConfig(key.name) {
+			source = "config"
+		}
+
+		var value string
+		if key.structured {
+			value = formatValue(root.FieldByIndex(key.index), key.secret)
+		} else {
+			value = fmt.Sprint(v.Get(key.name))
+			if key.secret && value != "" {
+				value = redacted
+			}
+		}
+
+		sources = append(sources, ValueSource{Key: key.name, Value: value, Source: source})
+	}
+
+	sort.Slice(sources, func(i, j int) bool { return sources[i].Key < sources[j].Key })
+	return sources
+}
+
+// formatValue 格式化map和slice类型的配置值，secret为true或字段标记 secret:"true" 时脱敏
+// 敏感的map只显示key，值脱敏
+func formatValue(value reflect.Value, secret bool) string {
+	switch value.Kind() {
+	case reflect.Struct:
+		var fields []string
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			tag := field.Tag.Get("mapstructure")
+			if tag == "" || tag == "-" || value.Field(i).IsZero() {
+				continue
+			}
+			fields = append(fields, tag+"="+formatValue(value.Field(i), secret || field.Tag.Get("secret") == "true"))
+		}
+		return "{" + strings.Join(fields, " ") + "}"
+	case reflect.Slice:
+		items := make([]string, value.Len())
+		for i := range items {
+			items[i] = formatValue(value.Index(i), secret)
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	case reflect.Map:
+		entries := make([]string, 0, value.Len())
+		for _, k := range value.MapKeys() {
+			entries = append(entries, fmt.Sprint(k.Interface())+"="+formatValue(value.MapIndex(k), secret))
+		}
+		sort.Strings(entries)
+		return "{" + strings.Join(entries, " ") + "}"
+	default:
+		if secret && !value.IsZero() {
+			return redacted
+		}
+		return fmt.Sprint(value.Interface())
+	}
+}
+
+// setEnv 返回为配置项生效的环境变量名，未设置时返回空字符串
+func setEnv(key string) string {
+	for _, name := range envNames(key) {
+		if os.Getenv(name) != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// EnvOverrides 返回由环境变量或 *_FILE 设置的配置项
+// 这些配置项优先于配置文件，热更新时修改配置文件中的对应值不会生效
+func (c *Config) EnvOverrides() []string {
+	var keys []string
+	for _, source := range c.Sources {
+		if strings.HasPrefix(source.Source, "env:") || strings.HasPrefix(source.Source, "file:") {
+			keys = append(keys, source.Key)
+		}
+	}
+	return keys
+}
+
+// WriteSources 输出每个配置项的生效值和来源，敏感配置已脱敏
+func (c *Config) WriteSources(w io.Writer) {
+	for _, source := range c.Sources {
+		fmt.Fprintf(w, "  %-50s %-40s %s\n", source.Key, source.Value, source.Source)
+	}
+}
@@ -0,0 +1,207 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnvNames(t *testing.T) {
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{key: "server.port", want: []string{"SCREENSHOT_SERVER_PORT"}},
+		{key: "cdn.invalidation.mode", want: []string{"SCREENSHOT_CDN_INVALIDATION_MODE"}},
+		{key: "s3.region", want: []string{"SCREENSHOT_S3_REGION", "AWS_REGION"}},
+		{key: "chart_service.bearer_token", want: []string{"SCREENSHOT_CHART_SERVICE_BEARER_TOKEN", "CHART_SERVICE_BEARER_TOKEN"}},
+	}
+	for _, tt := range tests {
+		if got := envNames(tt.key); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("envNames(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestConfigKeys(t *testing.T) {
+	byName := make(map[string]configKey, len(keys))
+	for _, key := range keys {
+		byName[key.name] = key
+	}
+
+	tests := []struct {
+		name       string
+		secret     bool
+		structured bool
+	}{
+		{name: "server.port"},
+		{name: "cdn.invalidation.mode"},
+		{name: "s3.secret_access_key", secret: true},
+		{name: "cdn.hmac_secret", secret: true},
+		{name: "chart_service.headers", secret: true, structured: true},
+		{name: "cdn.invalidation.webhook_headers", secret: true, structured: true},
+		{name: "auth.keys", structured: true},
+		{name: "webhook.endpoints", structured: true},
+		{name: "webhook.callback_hosts", structured: true},
+		{name: "s3.tags", structured: true},
+	}
+	for _, tt := range tests {
+		key, ok := byName[tt.name]
+		if !ok {
+			t.Errorf("config key %s is not bindable", tt.name)
+			continue
+		}
+		if key.secret != tt.secret || key.structured != tt.structured {
+			t.Errorf("%s: secret = %v, structured = %v, want %v, %v", tt.name, key.secret, key.structured, tt.secret, tt.structured)
+		}
+	}
+}
+
+// sourceOf 查找配置项的来源记录
+func sourceOf(t *testing.T, cfg *Config, key string) ValueSource {
+	t.Helper()
+	for _, source := range cfg.Sources {
+		if source.Key == key {
+			return source
+		}
+	}
+	t.Fatalf("no source recorded for %s", key)
+	return ValueSource{}
+}
+
+func TestLoadEnvOverrides(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "aws_secret")
+	if err := os.WriteFile(secretFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	keysFile := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(keysFile, []byte(`[{"name":"ci","key":"k-123","scopes":["screenshot"]}]`), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	t.Setenv("SCREENSHOT_SERVER_PORT", "9090")
+	t.Setenv("AWS_S3_BUCKET", "legacy-bucket")
+	t.Setenv("SCREENSHOT_S3_REGION", "eu-west-1")
+	t.Setenv("AWS_REGION", "ap-east-1") // 旧变量名优先级低于 SCREENSHOT_ 前缀
+	t.Setenv("SCREENSHOT_S3_ACCESS_KEY_ID", "AKIA")
+	t.Setenv("SCREENSHOT_S3_SECRET_ACCESS_KEY", "from-env")
+	t.Setenv("SCREENSHOT_S3_SECRET_ACCESS_KEY_FILE", secretFile) // 文件优先于环境变量
+	t.Setenv("SCREENSHOT_AUTH_ENABLED", "true")
+	t.Setenv("SCREENSHOT_AUTH_KEYS_FILE", keysFile)
+	t.Setenv("SCREENSHOT_CHART_SERVICE_HEADERS", `{"X-Token":"t0ps3cret"}`)
+	t.Setenv("SCREENSHOT_WEBHOOK_CALLBACK_HOSTS", "a.example.com, b.example.com")
+	t.Setenv("SCREENSHOT_S3_TAGS", `{"team":"charts"}`)
+
+	cfg, err := Load(writeConfig(t, minimalConfig))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cfg.Server.Port != 9090 {
+		t.Errorf("server.port = %d, want 9090", cfg.Server.Port)
+	}
+	if cfg.S3.Bucket != "legacy-bucket" || cfg.S3.Region != "eu-west-1" {
+		t.Errorf("s3 = %s/%s, want legacy-bucket/eu-west-1", cfg.S3.Bucket, cfg.S3.Region)
+	}
+	if cfg.S3.SecretAccessKey != "from-file" {
+		t.Errorf("s3.secret_access_key = %q, want value from file", cfg.S3.SecretAccessKey)
+	}
+	if len(cfg.Auth.Keys) != 1 || cfg.Auth.Keys[0].Key != "k-123" || cfg.Auth.Keys[0].Scopes[0] != "screenshot" {
+		t.Errorf("auth.keys = %+v", cfg.Auth.Keys)
+	}
+	if cfg.ChartService.Headers["x-token"] != "t0ps3cret" && cfg.ChartService.Headers["X-Token"] != "t0ps3cret" {
+		t.Errorf("chart_service.headers = %v", cfg.ChartService.Headers)
+	}
+	if strings.Join(cfg.Webhook.CallbackHosts, ",") != "a.example.com,b.example.com" {
+		t.Errorf("webhook.callback_hosts = %v", cfg.Webhook.CallbackHosts)
+	}
+	if cfg.S3.Tags["team"] != "charts" {
+		t.Errorf("s3.tags = %v", cfg.S3.Tags)
+	}
+
+	tests := []struct {
+		key        string
+		wantSource string
+		wantValue  string
+		hidden     string // 不应出现在值中的敏感内容
+	}{
+		{key: "server.port", wantSource: "env:SCREENSHOT_SERVER_PORT", wantValue: "9090"},
+		{key: "s3.bucket", wantSource: "env:AWS_S3_BUCKET", wantValue: "legacy-bucket"},
+		{key: "s3.region", wantSource: "env:SCREENSHOT_S3_REGION", wantValue: "eu-west-1"},
+		{key: "chart_service.base_url", wantSource: "config", wantValue: "http://127.0.0.1:8000"},
+		{key: "logging.format", wantSource: "default"},
+		{key: "s3.secret_access_key", wantSource: "file:SCREENSHOT_S3_SECRET_ACCESS_KEY_FILE", wantValue: redacted, hidden: "from-file"},
+		{key: "auth.keys", wantSource: "file:SCREENSHOT_AUTH_KEYS_FILE", hidden: "k-123"},
+		{key: "chart_service.headers", wantSource: "env:SCREENSHOT_CHART_SERVICE_HEADERS", hidden: "t0ps3cret"},
+		{key: "webhook.callback_hosts", wantSource: "env:SCREENSHOT_WEBHOOK_CALLBACK_HOSTS", wantValue: "[a.example.com b.example.com]"},
+	}
+	// 环境变量设置的配置项在热更新时不随配置文件变化
+	overrides := strings.Join(cfg.EnvOverrides(), ",")
+	for _, key := range []string{"server.port", "s3.secret_access_key", "auth.keys"} {
+		if !strings.Contains(overrides, key) {
+			t.Errorf("EnvOverrides() = %s, missing %s", overrides, key)
+		}
+	}
+	if strings.Contains(overrides, "chart_service.base_url") {
+		t.Errorf("EnvOverrides() = %s, includes a key from the config file", overrides)
+	}
+
+	for _, tt := range tests {
+		source := sourceOf(t, cfg, tt.key)
+		if source.Source != tt.wantSource {
+			t.Errorf("%s source = %s, want %s", tt.key, source.Source, tt.wantSource)
+		}
+		if tt.wantValue != "" && source.Value != tt.wantValue {
+			t.Errorf("%s value = %s, want %s", tt.key, source.Value, tt.wantValue)
+		}
+		if tt.hidden != "" && strings.Contains(source.Value, tt.hidden) {
+			t.Errorf("%s value %q leaks a secret", tt.key, source.Value)
+		}
+	}
+}
+
+func TestLoadStructuredEnvErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   string
+		value string
+	}{
+		{name: "map requires json", env: "SCREENSHOT_S3_TAGS", value: "team=charts"},
+		{name: "invalid json", env: "SCREENSHOT_AUTH_KEYS", value: `[{"name":`},
+		{name: "struct list requires json", env: "SCREENSHOT_WEBHOOK_ENDPOINTS", value: "https://hooks.example.com"},
+		{name: "missing file", env: "SCREENSHOT_AUTH_KEYS_FILE", value: "/nonexistent/keys.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.env, tt.value)
+			_, err := Load(writeConfig(t, minimalConfig))
+			if err == nil {
+				t.Fatalf("Load() with %s=%q returned nil error", tt.env, tt.value)
+			}
+			if name := strings.TrimSuffix(tt.env, fileEnvSuffix); !strings.Contains(err.Error(), name) {
+				t.Errorf("Load() error = %v, want it to name %s", err, name)
+			}
+		})
+	}
+}
+
+func TestFormatValueRedactsNestedSecrets(t *testing.T) {
+	cfg := &Config{}
+	cfg.Webhook.Endpoints = []WebhookEndpointConfig{{URL: "https://hooks.example.com", Secret: "whsec"}}
+	cfg.Auth.Keys = []APIKeyConfig{{Name: "ci", Key: "k-123"}}
+
+	for _, key := range keys {
+		if key.name != "webhook.endpoints" && key.name != "auth.keys" {
+			continue
+		}
+		value := formatValue(reflect.ValueOf(cfg).Elem().FieldByIndex(key.index), key.secret)
+		if strings.Contains(value, "whsec") || strings.Contains(value, "k-123") {
+			t.Errorf("%s formatted as %q, leaks a secret", key.name, value)
+		}
+		if !strings.Contains(value, redacted) {
+			t.Errorf("%s formatted as %q, want redacted marker", key.name, value)
+		}
+	}
+}
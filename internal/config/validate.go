@@ -0,0 +1,364 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 配置模板中的占位值，原样使用说明配置未填写
+var placeholders = map[string]bool{
+	"your-bucket-name":            true,
+	"your-access-key-id":          true,
+	"your-secret-access-key":      true,
+	"https://your-cdn-domain.com": true,
+	"change-me":                   true,
+}
+
+// ValidationError 配置校验失败，包含发现的所有问题
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid config (%d problems):\n  - %s", len(e.Problems), strings.Join(e.Problems, "\n  - "))
+}
+
+// problems 收集校验问题
+type problems []string
+
+func (p *problems) addf(format string, args ...interface{}) {
+	*p = append(*p, fmt.Sprintf(format, args...))
+}
+
+// Validate 校验配置，一次返回所有问题
+func (c *Config) Validate() error {
+	var p problems
+
+	c.validateServer(&p)
+	c.validateS3(&p)
+	c.validateCDN(&p)
+	c.validateChartService(&p)
+	c.validateLogging(&p)
+	c.validateAuth(&p)
+	c.validateRateLimit(&p)
+	c.validateStorage(&p)
+	c.validateWebhook(&p)
+
+	if len(p) > 0 {
+		return &ValidationError{Problems: p}
+	}
+	return nil
+}
+
+// Check 加载并校验配置文件，将结果及各配置项的来源写入w，用于 --check-config 启动参数
+func Check(configPath string, w io.Writer) error {
+	config, err := Load(configPath)
+	if err != nil {
+		fmt.Fprintf(w, "%s: %v\n", configPath, err)
+		return err
+	}
+	fmt.Fprintf(w, "%s: OK\n", configPath)
+	config.WriteSources(w)
+	return nil
+}
+
+func (c *Config) validateServer(p *problems) {
+	if c.Server.Port <= 0 || c.Server.Port > 65535 {
+		p.addf("server.port must be between 1 and 65535, got %d", c.Server.Port)
+	}
+	if c.Server.ReadTimeout < 0 {
+		p.addf("server.read_timeout must not be negative")
+	}
+	if c.Server.WriteTimeout < 0 {
+		p.addf("server.write_timeout must not be negative")
+	}
+	for i, proxy := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			p.addf("server.trusted_proxies[%d] must be an IP address or CIDR, got %q", i, proxy)
+		}
+	}
+}
+
+func (c *Config) validateS3(p *problems) {
+	requireValue(p, "s3.region", c.S3.Region)
+	requireValue(p, "s3.bucket", c.S3.Bucket)
+	rejectPlaceholder(p, "s3.access_key_id", c.S3.AccessKeyID)
+	rejectPlaceholder(p, "s3.secret_access_key", c.S3.SecretAccessKey)
+	if (c.S3.AccessKeyID == "") != (c.S3.SecretAccessKey == "") {
+		p.addf("s3.access_key_id and s3.secret_access_key must be set together")
+	}
+	if c.S3.UploadTimeout < 0 {
+		p.addf("s3.upload_timeout must not be negative")
+	}
+
+	multipart := c.S3.Multipart
+	if multipart.PartSize != 0 && multipart.PartSize < 5*1024*1024 {
+		p.addf("s3.multipart.part_size must be at least 5242880 bytes (5MiB), got %d", multipart.PartSize)
+	}
+	if multipart.Concurrency < 0 {
+		p.addf("s3.multipart.concurrency must not be negative")
+	}
+	requireOneOf(p, "s3.multipart.checksum", multipart.Checksum, "", "crc32c", "sha256")
+}
+
+func (c *Config) validateCDN(p *problems) {
+	cdn := c.CDN
+	if cdn.BaseURL != "" {
+		requireURL(p, "cdn.base_url", cdn.BaseURL)
+	}
+	if cdn.URLTTL < 0 {
+		p.addf("cdn.url_ttl must not be negative")
+	}
+
+	requireOneOf(p, "cdn.url_mode", cdn.URLMode, "", "public", "s3_presigned", "cloudfront_signed", "hmac_signed")
+	switch cdn.URLMode {
+	case "cloudfront_signed":
+		requireValue(p, "cdn.base_url", cdn.BaseURL)
+		requireValue(p, "cdn.key_pair_id", cdn.KeyPairID)
+		requireFile(p, "cdn.private_key_file", cdn.PrivateKeyFile)
+	case "hmac_signed":
+		requireValue(p, "cdn.base_url", cdn.BaseURL)
+		requireValue(p, "cdn.hmac_secret", cdn.HMACSecret)
+	}
+
+	inv := cdn.Invalidation
+	requireOneOf(p, "cdn.invalidation.mode", inv.Mode, "", "none", "purge", "version")
+	if inv.Mode != "purge" {
+		return
+	}
+	requireValue(p, "cdn.base_url", cdn.BaseURL)
+	requireOneOf(p, "cdn.invalidation.provider", inv.Provider, "cloudfront", "cloudflare", "webhook")
+	switch inv.Provider {
+	case "cloudfront":
+		requireValue(p, "cdn.invalidation.distribution_id", inv.DistributionID)
+	case "cloudflare":
+		requireValue(p, "cdn.invalidation.zone_id", inv.ZoneID)
+		requireValue(p, "cdn.invalidation.api_token", inv.APIToken)
+	case "webhook":
+		requireURL(p, "cdn.invalidation.webhook_url", inv.WebhookURL)
+	}
+}
+
+func (c *Config) validateChartService(p *problems) {
+	cs := c.ChartService
+	requireURL(p, "chart_service.base_url", cs.BaseURL)
+
+	if cs.Timeout < 0 || cs.RefreshTimeout < 0 || cs.RenderTimeout < 0 || cs.PanelTimeout < 0 || cs.IdleConnTimeout < 0 {
+		p.addf("chart_service timeouts must not be negative")
+	}
+
+	if (cs.TLS.CertFile == "") != (cs.TLS.KeyFile == "") {
+		p.addf("chart_service.tls.cert_file and chart_service.tls.key_file must be set together")
+	}
+	if cs.TLS.CertFile != "" {
+		requireFile(p, "chart_service.tls.cert_file", cs.TLS.CertFile)
+		requireFile(p, "chart_service.tls.key_file", cs.TLS.KeyFile)
+	}
+	if cs.TLS.CAFile != "" {
+		requireFile(p, "chart_service.tls.ca_file", cs.TLS.CAFile)
+	}
+
+	validateRefreshRule(p, "chart_service.refresh.default", cs.Refresh.Default)
+	for timeframe, rule := range cs.Refresh.Timeframes {
+		validateRefreshRule(p, "chart_service.refresh.timeframes."+timeframe, rule)
+	}
+
+	iv := cs.ImageValidation
+	if iv.MinWidth < 0 || iv.MinHeight < 0 {
+		p.addf("chart_service.image_validation.min_width and min_height must not be negative")
+	}
+	if iv.MinContentRatio < 0 || iv.MinContentRatio > 1 {
+		p.addf("chart_service.image_validation.min_content_ratio must be between 0 and 1, got %g", iv.MinContentRatio)
+	}
+	if iv.MaxRetries < 0 {
+		p.addf("chart_service.image_validation.max_retries must not be negative")
+	}
+	if iv.MaxPixels < 0 {
+		p.addf("chart_service.image_validation.max_pixels must not be negative")
+	}
+
+	requireOneOf(p, "chart_service.image_mode", cs.ImageMode, "", "buffered", "stream", "shared_path")
+	if cs.ImageMode == "shared_path" {
+		requireValue(p, "chart_service.shared_dir", cs.SharedDir)
+	}
+}
+
+func validateRefreshRule(p *problems, key string, rule RefreshRuleConfig) {
+	requireOneOf(p, key+".policy", rule.Policy, "", "always", "never", "if_older_than", "required")
+	if rule.Policy == "if_older_than" && rule.MaxAge <= 0 {
+		p.addf("%s.max_age must be positive for policy if_older_than", key)
+	}
+}
+
+func (c *Config) validateLogging(p *problems) {
+	if _, err := logrus.ParseLevel(c.Logging.Level); err != nil {
+		p.addf("logging.level %q is not a valid level (debug, info, warn, error)", c.Logging.Level)
+	}
+	requireOneOf(p, "logging.format", c.Logging.Format, "json", "text")
+
+	switch c.Logging.Output {
+	case "", "stdout", "stderr", "journald":
+	case "syslog":
+		requireOneOf(p, "logging.syslog.network", c.Logging.Syslog.Network, "", "udp", "tcp", "unix", "unixgram")
+		if c.Logging.Syslog.Network != "" {
+			requireValue(p, "logging.syslog.address", c.Logging.Syslog.Address)
+		}
+	default:
+		rotation := c.Logging.Rotation
+		if rotation.MaxSizeMB < 0 || rotation.MaxAgeDays < 0 || rotation.MaxBackups < 0 {
+			p.addf("logging.rotation values must not be negative")
+		}
+	}
+}
+
+func (c *Config) validateAuth(p *problems) {
+	if !c.Auth.Enabled {
+		return
+	}
+	if len(c.Auth.Keys) == 0 && c.Auth.KeysFile == "" {
+		p.addf("auth.enabled requires auth.keys or auth.keys_file")
+	}
+	if c.Auth.KeysFile != "" {
+		requireFile(p, "auth.keys_file", c.Auth.KeysFile)
+	}
+	for i, key := range c.Auth.Keys {
+		prefix := fmt.Sprintf("auth.keys[%d]", i)
+		requireValue(p, prefix+".key", key.Key)
+		for _, scope := range key.Scopes {
+			requireOneOf(p, prefix+".scopes", scope, "screenshot", "data", "admin")
+		}
+	}
+}
+
+func (c *Config) validateRateLimit(p *problems) {
+	if !c.RateLimit.Enabled {
+		return
+	}
+	validateTokenBucket(p, "rate_limit.per_key", c.RateLimit.PerKey)
+	validateTokenBucket(p, "rate_limit.per_ip", c.RateLimit.PerIP)
+	if c.RateLimit.DailyRenders < 0 || c.RateLimit.DailyUploadBytes < 0 {
+		p.addf("rate_limit.daily_renders and rate_limit.daily_upload_bytes must not be negative")
+	}
+}
+
+func validateTokenBucket(p *problems, key string, bucket TokenBucketConfig) {
+	if bucket.Rate < 0 {
+		p.addf("%s.rate must not be negative", key)
+	}
+	if bucket.Rate > 0 && bucket.Burst < 1 {
+		p.addf("%s.burst must be at least 1", key)
+	}
+}
+
+func (c *Config) validateStorage(p *problems) {
+	if c.History.Enabled {
+		requireValue(p, "history.path", c.History.Path)
+	}
+	if c.Retention.Enabled {
+		if c.Retention.Interval < 0 {
+			p.addf("retention.interval must not be negative")
+		}
+		for timeframe, maxAge := range c.Retention.Rules {
+			if maxAge < 0 {
+				p.addf("retention.rules.%s must not be negative", timeframe)
+			}
+		}
+	}
+}
+
+func (c *Config) validateWebhook(p *problems) {
+	wh := c.Webhook
+	if !wh.Enabled {
+		return
+	}
+	if len(wh.Endpoints) == 0 && !wh.AllowCallbackURL {
+		p.addf("webhook.enabled requires webhook.endpoints or webhook.allow_callback_url")
+	}
+	// 请求级回调和未单独配置密钥的endpoint使用 webhook.secret 签名
+	needsSecret := wh.AllowCallbackURL
+	for i, endpoint := range wh.Endpoints {
+		prefix := fmt.Sprintf("webhook.endpoints[%d]", i)
+		requireURL(p, prefix+".url", endpoint.URL)
+		needsSecret = needsSecret || endpoint.Secret == ""
+		for _, event := range endpoint.Events {
+			requireOneOf(p, prefix+".events", event, "capture.completed", "capture.failed")
+		}
+	}
+	if needsSecret {
+		requireValue(p, "webhook.secret", wh.Secret)
+	}
+	// 不限制主机时任何API Key持有者都能让服务端向任意地址发送请求
+	if wh.AllowCallbackURL && len(wh.CallbackHosts) == 0 {
+		p.addf("webhook.allow_callback_url requires webhook.callback_hosts")
+	}
+	if wh.MaxAttempts < 1 {
+		p.addf("webhook.max_attempts must be at least 1")
+	}
+	if wh.InitialBackoff < 0 || wh.MaxBackoff < 0 || wh.Timeout < 0 {
+		p.addf("webhook timeouts and backoffs must not be negative")
+	}
+	if wh.QueueSize < 1 || wh.LogSize < 1 {
+		p.addf("webhook.queue_size and webhook.log_size must be at least 1")
+	}
+}
+
+// requireValue 检查必填字段，且不能是模板占位值
+func requireValue(p *problems, key, value string) {
+	if value == "" {
+		p.addf("%s is required", key)
+		return
+	}
+	rejectPlaceholder(p, key, value)
+}
+
+// rejectPlaceholder 检查可选字段不是模板占位值
+func rejectPlaceholder(p *problems, key, value string) {
+	if placeholders[value] {
+		p.addf("%s is still the template placeholder %q", key, value)
+	}
+}
+
+// requireURL 检查必填的http(s) URL
+func requireURL(p *problems, key, value string) {
+	if value == "" || placeholders[value] {
+		requireValue(p, key, value)
+		return
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		p.addf("%s must be an absolute http(s) URL, got %q", key, value)
+	}
+}
+
+// requireFile 检查文件存在且可读
+func requireFile(p *problems, key, path string) {
+	if path == "" {
+		p.addf("%s is required", key)
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		p.addf("%s: %v", key, err)
+	}
+}
+
+func requireOneOf(p *problems, key, value string, allowed ...string) {
+	for _, candidate := range allowed {
+		if value == candidate {
+			return
+		}
+	}
+
+	names := make([]string, 0, len(allowed))
+	for _, candidate := range allowed {
+		if candidate != "" {
+			names = append(names, candidate)
+		}
+	}
+	p.addf("%s must be one of %s, got %q", key, strings.Join(names, ", "), value)
+}
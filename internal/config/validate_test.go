@@ -0,0 +1,196 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const minimalConfig = `
+s3:
+  region: us-east-1
+  bucket: charts
+chart_service:
+  base_url: http://127.0.0.1:8000
+`
+
+// writeConfig 写入临时配置文件并返回路径
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path
+}
+
+// validConfig 加载最小配置，所有未填写的配置项使用默认值
+func validConfig(t *testing.T) *Config {
+	t.Helper()
+	cfg, err := Load(writeConfig(t, minimalConfig))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	return cfg
+}
+
+func TestLoadMinimalConfig(t *testing.T) {
+	cfg := validConfig(t)
+	if cfg.Server.Port == 0 || cfg.Logging.Level == "" || cfg.Webhook.MaxAttempts == 0 {
+		t.Errorf("defaults not applied: %+v", cfg)
+	}
+	if cfg.Revision == "" {
+		t.Error("Revision is empty")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*Config)
+		want   []string // 期望出现的问题片段，为空表示校验通过
+	}{
+		{name: "valid", mutate: func(*Config) {}},
+		{name: "port out of range", mutate: func(c *Config) { c.Server.Port = 70000 }, want: []string{"server.port"}},
+		{name: "trusted proxies", mutate: func(c *Config) { c.Server.TrustedProxies = []string{"10.0.0.0/8", "192.0.2.1", "::1"} }},
+		{
+			name:   "invalid trusted proxy",
+			mutate: func(c *Config) { c.Server.TrustedProxies = []string{"10.0.0.0/8", "proxy.internal"} },
+			want:   []string{"server.trusted_proxies[1] must be an IP address or CIDR"},
+		},
+		{
+			name:   "missing bucket and placeholder region",
+			mutate: func(c *Config) { c.S3.Bucket = ""; c.S3.Region = "change-me" },
+			want:   []string{"s3.bucket is required", "s3.region is still the template placeholder"},
+		},
+		{
+			name: "placeholder access keys",
+			mutate: func(c *Config) {
+				c.S3.AccessKeyID = "your-access-key-id"
+				c.S3.SecretAccessKey = "your-secret-access-key"
+			},
+			want: []string{"s3.access_key_id is still the template placeholder", "s3.secret_access_key is still the template placeholder"},
+		},
+		{name: "half of access key pair", mutate: func(c *Config) { c.S3.AccessKeyID = "AKIA" }, want: []string{"must be set together"}},
+		{name: "part size too small", mutate: func(c *Config) { c.S3.Multipart.PartSize = 1024 }, want: []string{"s3.multipart.part_size"}},
+		{name: "unknown checksum", mutate: func(c *Config) { c.S3.Multipart.Checksum = "md5" }, want: []string{"s3.multipart.checksum must be one of crc32c, sha256"}},
+		{name: "relative chart service url", mutate: func(c *Config) { c.ChartService.BaseURL = "localhost:8000" }, want: []string{"chart_service.base_url must be an absolute http(s) URL"}},
+		{
+			name: "if_older_than without max_age",
+			mutate: func(c *Config) {
+				c.ChartService.Refresh.Timeframes = map[string]RefreshRuleConfig{"1d": {Policy: "if_older_than"}}
+			},
+			want: []string{"chart_service.refresh.timeframes.1d.max_age"},
+		},
+		{name: "shared_path without dir", mutate: func(c *Config) { c.ChartService.ImageMode = "shared_path" }, want: []string{"chart_service.shared_dir is required"}},
+		{name: "content ratio above 1", mutate: func(c *Config) { c.ChartService.ImageValidation.MinContentRatio = 2 }, want: []string{"min_content_ratio"}},
+		{name: "negative max pixels", mutate: func(c *Config) { c.ChartService.ImageValidation.MaxPixels = -1 }, want: []string{"max_pixels must not be negative"}},
+		{
+			name:   "cloudfront without key material",
+			mutate: func(c *Config) { c.CDN.URLMode = "cloudfront_signed" },
+			want:   []string{"cdn.base_url is required", "cdn.key_pair_id is required", "cdn.private_key_file is required"},
+		},
+		{
+			name:   "purge without provider",
+			mutate: func(c *Config) { c.CDN.BaseURL = "https://cdn.example.com"; c.CDN.Invalidation.Mode = "purge" },
+			want:   []string{"cdn.invalidation.provider must be one of"},
+		},
+		{name: "bad log level", mutate: func(c *Config) { c.Logging.Level = "loud" }, want: []string{"logging.level"}},
+		{
+			name:   "auth without keys",
+			mutate: func(c *Config) { c.Auth.Enabled = true },
+			want:   []string{"auth.enabled requires auth.keys or auth.keys_file"},
+		},
+		{
+			name: "auth key with unknown scope",
+			mutate: func(c *Config) {
+				c.Auth.Enabled = true
+				c.Auth.Keys = []APIKeyConfig{{Name: "ci", Key: "k", Scopes: []string{"root"}}}
+			},
+			want: []string{"auth.keys[0].scopes must be one of"},
+		},
+		{
+			name:   "rate limit burst",
+			mutate: func(c *Config) { c.RateLimit.Enabled = true; c.RateLimit.PerKey.Rate = 1; c.RateLimit.PerKey.Burst = 0 },
+			want:   []string{"rate_limit.per_key.burst"},
+		},
+		{
+			name: "negative retention",
+			mutate: func(c *Config) {
+				c.Retention.Enabled = true
+				c.Retention.Rules = map[string]time.Duration{"1h": -time.Hour}
+			},
+			want: []string{"retention.rules.1h must not be negative"},
+		},
+		{
+			name:   "webhook without targets",
+			mutate: func(c *Config) { c.Webhook.Enabled = true },
+			want:   []string{"webhook.enabled requires webhook.endpoints or webhook.allow_callback_url"},
+		},
+		{
+			name:   "callback url without hosts or secret",
+			mutate: func(c *Config) { c.Webhook.Enabled = true; c.Webhook.AllowCallbackURL = true },
+			want:   []string{"webhook.secret is required", "webhook.allow_callback_url requires webhook.callback_hosts"},
+		},
+		{
+			name: "endpoint with own secret",
+			mutate: func(c *Config) {
+				c.Webhook.Enabled = true
+				c.Webhook.Endpoints = []WebhookEndpointConfig{{URL: "https://hooks.example.com", Secret: "s"}}
+			},
+		},
+		{
+			name: "endpoint with unknown event",
+			mutate: func(c *Config) {
+				c.Webhook.Enabled = true
+				c.Webhook.Endpoints = []WebhookEndpointConfig{{URL: "https://hooks.example.com", Secret: "s", Events: []string{"capture.started"}}}
+			},
+			want: []string{"webhook.endpoints[0].events must be one of"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig(t)
+			tt.mutate(cfg)
+
+			err := cfg.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Validate() error = %v, want *ValidationError", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() error = %v, want problem containing %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	var out strings.Builder
+	if err := Check(writeConfig(t, minimalConfig), &out); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if !strings.Contains(out.String(), ": OK") || !strings.Contains(out.String(), "s3.bucket") {
+		t.Errorf("Check() output = %q", out.String())
+	}
+
+	out.Reset()
+	if err := Check(writeConfig(t, "server:\n  port: 0\n"), &out); err == nil {
+		t.Error("Check() on an invalid config returned nil error")
+	}
+	if !strings.Contains(out.String(), "s3.bucket is required") {
+		t.Errorf("Check() output = %q, want listed problems", out.String())
+	}
+}
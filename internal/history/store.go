@@ -0,0 +1,305 @@
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var capturesBucket = []byte("captures")
+
+// Record 一次截图的索引记录
+type Record struct {
+	Symbol      string    `json:"symbol"`
+	Market      string    `json:"market"`
+	Timeframe   string    `json:"timeframe"`
+	BucketTime  time.Time `json:"bucket_time"` // 所属时间段的起点，如日线为当天0点
+	CapturedAt  time.Time `json:"captured_at"`
+	ImageKey    string    `json:"image_key"`
+	ImageSize   int64     `json:"image_size"`
+	ImageSHA256 string    `json:"image_sha256"`
+	DataKey     string    `json:"data_key,omitempty"`
+	DataSize    int64     `json:"data_size,omitempty"`
+	DataSHA256  string    `json:"data_sha256,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+	Backend     string    `json:"backend"`
+
+	// 启用内容寻址时当次截图内容的不可变key，不会被之后的截图覆盖
+	ImageContentKey string `json:"image_content_key,omitempty"`
+	DataContentKey  string `json:"data_content_key,omitempty"`
+
+	// 同一时间段内的截图使用相同的S3 key，之后的截图覆盖了该key时为true，
+	// 此时image_key/data_key指向的是较新的内容
+	Overwritten bool `json:"overwritten,omitempty"`
+}
+
+// Query 历史查询条件，零值字段不参与过滤
+type Query struct {
+	Symbol    string
+	Market    string
+	Timeframe string
+	From      time.Time
+	To        time.Time
+	Limit     int
+}
+
+// Store 基于BoltDB的截图历史索引
+// key格式：{market}/{SYMBOL}/{captured_at纳秒，大端序}，同一股票的记录按时间有序
+type Store struct {
+	db *bolt.DB
+}
+
+// Open 打开（不存在时创建）历史索引
+func Open(path string) (*Store, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create history dir: %w", err)
+		}
+	}
+
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history db: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(capturesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize history db: %w", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Close 关闭历史索引
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Add 写入一条截图记录
+func (s *Store) Add(record *Record) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history record: %w", err)
+	}
+
+	key := recordKey(record.Market, record.Symbol, record.CapturedAt)
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(capturesBucket)
+		if err := markOverwritten(bucket, record); err != nil {
+			return err
+		}
+		return bucket.Put(key, value)
+	})
+}
+
+// markOverwritten 将同一时间段内使用相同key的较早记录标记为已被覆盖
+func markOverwritten(bucket *bolt.Bucket, record *Record) error {
+	prefix := symbolPrefix(record.Market, record.Symbol)
+	cursor := bucket.Cursor()
+
+	// 从新记录的位置向前遍历到所属时间段的起点
+	k, v := cursor.Seek(recordKey(record.Market, record.Symbol, record.CapturedAt))
+	if k == nil {
+		k, v = cursor.Last()
+	} else {
+		k, v = cursor.Prev()
+	}
+
+	// 遍历时修改bucket会使游标失效，先收集再统一修改
+	updates := make(map[string][]byte)
+	for ; k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Prev() {
+		var previous Record
+		if err := json.Unmarshal(v, &previous); err != nil {
+			return fmt.Errorf("failed to decode history record: %w", err)
+		}
+		if previous.CapturedAt.Before(record.BucketTime) {
+			break
+		}
+		if previous.ImageKey != record.ImageKey || previous.Overwritten {
+			continue
+		}
+
+		previous.Overwritten = true
+		value, err := json.Marshal(&previous)
+		if err != nil {
+			return fmt.Errorf("failed to marshal history record: %w", err)
+		}
+		updates[string(k)] = value
+	}
+
+	for k, value := range updates {
+		if err := bucket.Put([]byte(k), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prune 删除引用了已删除对象的记录，keys为包含ImagePrefix的完整key
+// 图片（别名或内容对象）被删除时删除整条记录，只有JSON数据被删除时保留记录并清空数据字段，返回受影响的记录数
+func (s *Store) Prune(keys []string) (int, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	deleted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		deleted[key] = true
+	}
+
+	pruned := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(capturesBucket)
+
+		// 遍历时修改bucket会使游标失效，先收集再统一修改
+		var removals [][]byte
+		updates := make(map[string][]byte)
+		err := bucket.ForEach(func(k, v []byte) error {
+			var record Record
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("failed to decode history record: %w", err)
+			}
+
+			switch {
+			case deleted[record.ImageKey], deleted[record.ImageContentKey]:
+				removals = append(removals, bytes.Clone(k))
+			case record.DataKey != "" && (deleted[record.DataKey] || deleted[record.DataContentKey]):
+				record.DataKey, record.DataSize, record.DataSHA256, record.DataContentKey = "", 0, "", ""
+				value, err := json.Marshal(&record)
+				if err != nil {
+					return fmt.Errorf("failed to marshal history record: %w", err)
+				}
+				updates[string(k)] = value
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range removals {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		for k, value := range updates {
+			if err := bucket.Put([]byte(k), value); err != nil {
+				return err
+			}
+		}
+		pruned = len(removals) + len(updates)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune history index: %w", err)
+	}
+	return pruned, nil
+}
+
+// ContentKeys 返回所有记录引用的内容寻址key，保留策略据此保留仍被历史记录使用的内容对象
+func (s *Store) ContentKeys() (map[string]bool, error) {
+	keys := make(map[string]bool)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(capturesBucket).ForEach(func(k, v []byte) error {
+			var record Record
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("failed to decode history record: %w", err)
+			}
+			for _, key := range []string{record.ImageContentKey, record.DataContentKey} {
+				if key != "" {
+					keys[key] = true
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history index: %w", err)
+	}
+	return keys, nil
+}
+
+// Find 按条件查询截图记录，结果按截图时间倒序
+func (s *Store) Find(q Query) ([]Record, error) {
+	if q.Symbol == "" || q.Market == "" {
+		return nil, fmt.Errorf("symbol and market are required")
+	}
+
+	prefix := symbolPrefix(q.Market, q.Symbol)
+	to := q.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+
+	var records []Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(capturesBucket).Cursor()
+
+		// 定位到第一条晚于To的记录，再向前遍历
+		k, v := cursor.Seek(recordKey(q.Market, q.Symbol, to.Add(time.Nanosecond)))
+		if k == nil {
+			k, v = cursor.Last()
+		} else {
+			k, v = cursor.Prev()
+		}
+
+		for ; k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Prev() {
+			var record Record
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("failed to decode history record: %w", err)
+			}
+			if !q.From.IsZero() && record.CapturedAt.Before(q.From) {
+				break
+			}
+			if q.Timeframe != "" && record.Timeframe != q.Timeframe {
+				continue
+			}
+
+			records = append(records, record)
+			if q.Limit > 0 && len(records) >= q.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func symbolPrefix(market, symbol string) []byte {
+	return []byte(strings.ToLower(market) + "/" + strings.ToUpper(symbol) + "/")
+}
+
+func recordKey(market, symbol string, capturedAt time.Time) []byte {
+	key := symbolPrefix(market, symbol)
+	return binary.BigEndian.AppendUint64(key, uint64(capturedAt.UnixNano()))
+}
+
+// BucketTime 计算截图所属时间段的起点，与S3 key的命名规则保持一致
+func BucketTime(timeframe string, t time.Time) time.Time {
+	switch timeframe {
+	case "1h":
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case "1d":
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	case "1wk":
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		offset := (int(day.Weekday()) + 6) % 7 // 周一为一周的开始（ISO周）
+		return day.AddDate(0, 0, -offset)
+	default:
+		return t
+	}
+}
@@ -0,0 +1,227 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := Open(filepath.Join(t.TempDir(), "history", "history.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestStoreFind(t *testing.T) {
+	store := openTestStore(t)
+	base := time.Date(2025, 7, 29, 12, 0, 0, 0, time.UTC)
+
+	// 乱序写入，验证按截图时间倒序返回
+	records := []Record{
+		{Symbol: "NVDA", Market: "us", Timeframe: "1d", CapturedAt: base.Add(2 * time.Hour), ImageKey: "nvda-3"},
+		{Symbol: "NVDA", Market: "us", Timeframe: "1h", CapturedAt: base, ImageKey: "nvda-1"},
+		{Symbol: "NVDA", Market: "us", Timeframe: "1d", CapturedAt: base.Add(time.Hour), ImageKey: "nvda-2"},
+		{Symbol: "NVDA", Market: "us", Timeframe: "1h", CapturedAt: base.Add(3 * time.Hour), ImageKey: "nvda-4"},
+		// 前缀相同的其他股票和市场不应出现在结果中
+		{Symbol: "NVDAX", Market: "us", Timeframe: "1d", CapturedAt: base.Add(time.Hour), ImageKey: "nvdax"},
+		{Symbol: "NVDA", Market: "hk", Timeframe: "1d", CapturedAt: base.Add(time.Hour), ImageKey: "nvda-hk"},
+		{Symbol: "AAPL", Market: "us", Timeframe: "1d", CapturedAt: base.Add(4 * time.Hour), ImageKey: "aapl"},
+	}
+	for i := range records {
+		if err := store.Add(&records[i]); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		query   Query
+		want    []string
+		wantErr bool
+	}{
+		{name: "all newest first", query: Query{Symbol: "NVDA", Market: "us"}, want: []string{"nvda-4", "nvda-3", "nvda-2", "nvda-1"}},
+		{name: "case insensitive", query: Query{Symbol: "nvda", Market: "US"}, want: []string{"nvda-4", "nvda-3", "nvda-2", "nvda-1"}},
+		{name: "limit", query: Query{Symbol: "NVDA", Market: "us", Limit: 2}, want: []string{"nvda-4", "nvda-3"}},
+		{name: "timeframe", query: Query{Symbol: "NVDA", Market: "us", Timeframe: "1d"}, want: []string{"nvda-3", "nvda-2"}},
+		{
+			name:  "time range inclusive",
+			query: Query{Symbol: "NVDA", Market: "us", From: base.Add(time.Hour), To: base.Add(2 * time.Hour)},
+			want:  []string{"nvda-3", "nvda-2"},
+		},
+		{name: "from only", query: Query{Symbol: "NVDA", Market: "us", From: base.Add(150 * time.Minute)}, want: []string{"nvda-4"}},
+		{name: "to before first", query: Query{Symbol: "NVDA", Market: "us", To: base.Add(-time.Hour)}, want: nil},
+		{name: "other market", query: Query{Symbol: "NVDA", Market: "hk"}, want: []string{"nvda-hk"}},
+		{name: "unknown symbol", query: Query{Symbol: "TSLA", Market: "us"}, want: nil},
+		{name: "symbol required", query: Query{Market: "us"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.Find(tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Find() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Find() returned %d records, want %d (%v)", len(got), len(tt.want), tt.want)
+			}
+			for i, record := range got {
+				if record.ImageKey != tt.want[i] {
+					t.Errorf("record %d = %s, want %s", i, record.ImageKey, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStoreAddMarksOverwritten(t *testing.T) {
+	store := openTestStore(t)
+	day := time.Date(2025, 7, 29, 0, 0, 0, 0, time.UTC)
+
+	// 同一天的日线截图共用一个key，前一天和小时线的key不同
+	records := []Record{
+		{Timeframe: "1d", CapturedAt: day.Add(-time.Hour), ImageKey: "screenshots/NVDA_us_1d_20250728.png"},
+		{Timeframe: "1d", CapturedAt: day.Add(9 * time.Hour), ImageKey: "screenshots/NVDA_us_1d_20250729.png"},
+		{Timeframe: "1h", CapturedAt: day.Add(10 * time.Hour), ImageKey: "screenshots/NVDA_us_1h_20250729_10.png"},
+		{Timeframe: "1d", CapturedAt: day.Add(11 * time.Hour), ImageKey: "screenshots/NVDA_us_1d_20250729.png"},
+		{Timeframe: "1d", CapturedAt: day.Add(12 * time.Hour), ImageKey: "screenshots/NVDA_us_1d_20250729.png"},
+	}
+	for i := range records {
+		record := &records[i]
+		record.Symbol, record.Market = "NVDA", "us"
+		record.BucketTime = BucketTime(record.Timeframe, record.CapturedAt)
+		if err := store.Add(record); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	got, err := store.Find(Query{Symbol: "NVDA", Market: "us"})
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	// 倒序：12点、11点、10点(1h)、9点、前一天
+	want := []bool{false, true, false, true, false}
+	if len(got) != len(want) {
+		t.Fatalf("Find() returned %d records, want %d", len(got), len(want))
+	}
+	for i, record := range got {
+		if record.Overwritten != want[i] {
+			t.Errorf("record %s at %v overwritten = %v, want %v", record.ImageKey, record.CapturedAt, record.Overwritten, want[i])
+		}
+	}
+}
+
+func TestStorePrune(t *testing.T) {
+	store := openTestStore(t)
+	base := time.Date(2025, 7, 29, 12, 0, 0, 0, time.UTC)
+
+	for i, keys := range [][2]string{
+		{"screenshots/a.png", "data/a.json"},
+		{"screenshots/b.png", "data/b.json"},
+		{"screenshots/c.png", "data/c.json"},
+	} {
+		record := &Record{
+			Symbol:     "NVDA",
+			Market:     "us",
+			Timeframe:  "1d",
+			CapturedAt: base.Add(time.Duration(i) * time.Hour),
+			ImageKey:   keys[0],
+			DataKey:    keys[1],
+			DataSize:   10,
+			DataSHA256: "abc",
+		}
+		if err := store.Add(record); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	pruned, err := store.Prune([]string{"screenshots/a.png", "data/a.json", "data/b.json", "screenshots/missing.png"})
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if pruned != 2 {
+		t.Errorf("Prune() = %d, want 2", pruned)
+	}
+
+	records, err := store.Find(Query{Symbol: "NVDA", Market: "us"})
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Find() returned %d records, want 2", len(records))
+	}
+	if c := records[0]; c.ImageKey != "screenshots/c.png" || c.DataKey != "data/c.json" {
+		t.Errorf("untouched record = %+v", c)
+	}
+	if b := records[1]; b.ImageKey != "screenshots/b.png" || b.DataKey != "" || b.DataSize != 0 || b.DataSHA256 != "" {
+		t.Errorf("record with deleted data = %+v, want data fields cleared", b)
+	}
+}
+
+func TestStoreContentKeys(t *testing.T) {
+	store := openTestStore(t)
+	base := time.Date(2025, 7, 29, 12, 0, 0, 0, time.UTC)
+
+	records := []Record{
+		{ImageKey: "screenshots/a.png", ImageContentKey: "objects/sha256/aa/aa.png", DataKey: "data/a.json", DataContentKey: "objects/sha256/ab/ab.json"},
+		{ImageKey: "screenshots/a.png", ImageContentKey: "objects/sha256/bb/bb.png"},
+		{ImageKey: "screenshots/b.png"}, // 未启用内容寻址
+	}
+	for i := range records {
+		record := &records[i]
+		record.Symbol, record.Market, record.Timeframe = "NVDA", "us", "1d"
+		record.CapturedAt = base.Add(time.Duration(i) * time.Minute)
+		if err := store.Add(record); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	keys, err := store.ContentKeys()
+	if err != nil {
+		t.Fatalf("ContentKeys() error = %v", err)
+	}
+	if len(keys) != 3 || !keys["objects/sha256/aa/aa.png"] || !keys["objects/sha256/ab/ab.json"] || !keys["objects/sha256/bb/bb.png"] {
+		t.Errorf("ContentKeys() = %v", keys)
+	}
+
+	// 内容对象被删除时删除整条记录，数据内容被删除时清空数据字段
+	pruned, err := store.Prune([]string{"objects/sha256/bb/bb.png", "objects/sha256/ab/ab.json"})
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if pruned != 2 {
+		t.Errorf("Prune() = %d, want 2", pruned)
+	}
+	keys, err = store.ContentKeys()
+	if err != nil {
+		t.Fatalf("ContentKeys() error = %v", err)
+	}
+	if len(keys) != 1 || !keys["objects/sha256/aa/aa.png"] {
+		t.Errorf("ContentKeys() after prune = %v", keys)
+	}
+}
+
+func TestBucketTime(t *testing.T) {
+	// 2025-07-30 是周三
+	at := time.Date(2025, 7, 30, 15, 42, 7, 0, time.UTC)
+	tests := []struct {
+		timeframe string
+		at        time.Time
+		want      time.Time
+	}{
+		{timeframe: "1h", at: at, want: time.Date(2025, 7, 30, 15, 0, 0, 0, time.UTC)},
+		{timeframe: "1d", at: at, want: time.Date(2025, 7, 30, 0, 0, 0, 0, time.UTC)},
+		{timeframe: "1wk", at: at, want: time.Date(2025, 7, 28, 0, 0, 0, 0, time.UTC)},
+		// 周日属于前一个周一开始的一周
+		{timeframe: "1wk", at: time.Date(2025, 8, 3, 9, 0, 0, 0, time.UTC), want: time.Date(2025, 7, 28, 0, 0, 0, 0, time.UTC)},
+		{timeframe: "1wk", at: time.Date(2025, 7, 28, 0, 0, 0, 0, time.UTC), want: time.Date(2025, 7, 28, 0, 0, 0, 0, time.UTC)},
+		{timeframe: "5m", at: at, want: at},
+	}
+	for _, tt := range tests {
+		if got := BucketTime(tt.timeframe, tt.at); !got.Equal(tt.want) {
+			t.Errorf("BucketTime(%q, %v) = %v, want %v", tt.timeframe, tt.at, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// tokenBucket 令牌桶
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// bucketSet 按客户端标识划分的一组令牌桶
+type bucketSet struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+}
+
+func newBucketSet(rate float64, burst int) *bucketSet {
+	s := &bucketSet{buckets: make(map[string]*tokenBucket)}
+	s.setLimits(rate, burst)
+	return s
+}
+
+// setLimits 更新速率和桶容量，已有令牌桶保留当前令牌数
+func (s *bucketSet) setLimits(rate float64, burst int) {
+	if burst <= 0 {
+		burst = int(math.Ceil(rate))
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rate = rate
+	s.burst = float64(burst)
+	for _, b := range s.buckets {
+		b.tokens = math.Min(b.tokens, s.burst)
+	}
+}
+
+// take 尝试取出一个令牌，失败时返回需要等待的时间
+func (s *bucketSet) take(id string, now time.Time) (bool, time.Duration) {
+	if s == nil {
+		return true, 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// rate为0表示不限速
+	if s.rate <= 0 {
+		return true, 0
+	}
+
+	b, ok := s.buckets[id]
+	if !ok {
+		b = &tokenBucket{tokens: s.burst, last: now}
+		s.buckets[id] = b
+	}
+
+	b.tokens = math.Min(s.burst, b.tokens+now.Sub(b.last).Seconds()*s.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / s.rate * float64(time.Second))
+	return false, wait
+}
+
+// prune 清理已经补满且长时间未使用的令牌桶
+func (s *bucketSet) prune(now time.Time, idle time.Duration) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, b := range s.buckets {
+		if now.Sub(b.last) > idle {
+			delete(s.buckets, id)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketSetTake(t *testing.T) {
+	start := time.Date(2025, 7, 29, 12, 0, 0, 0, time.UTC)
+
+	// 每一步相对起点的时间偏移和期望结果
+	type step struct {
+		at       time.Duration
+		wantOK   bool
+		wantWait time.Duration
+	}
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		steps []step
+	}{
+		{
+			name:  "burst then limited",
+			rate:  1,
+			burst: 2,
+			steps: []step{
+				{at: 0, wantOK: true},
+				{at: 0, wantOK: true},
+				{at: 0, wantOK: false, wantWait: time.Second},
+				{at: 500 * time.Millisecond, wantOK: false, wantWait: 500 * time.Millisecond},
+				{at: time.Second, wantOK: true},
+			},
+		},
+		{
+			name:  "refill capped at burst",
+			rate:  10,
+			burst: 1,
+			steps: []step{
+				{at: 0, wantOK: true},
+				{at: time.Hour, wantOK: true},
+				{at: time.Hour, wantOK: false, wantWait: 100 * time.Millisecond},
+			},
+		},
+		{
+			name:  "burst defaults to rate",
+			rate:  2.5,
+			burst: 0,
+			steps: []step{
+				{at: 0, wantOK: true},
+				{at: 0, wantOK: true},
+				{at: 0, wantOK: true},
+				{at: 0, wantOK: false, wantWait: 400 * time.Millisecond},
+			},
+		},
+		{
+			name:  "zero rate is unlimited",
+			rate:  0,
+			burst: 0,
+			steps: []step{
+				{at: 0, wantOK: true},
+				{at: 0, wantOK: true},
+				{at: 0, wantOK: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newBucketSet(tt.rate, tt.burst)
+			for i, st := range tt.steps {
+				ok, wait := s.take("client", start.Add(st.at))
+				if ok != st.wantOK || wait != st.wantWait {
+					t.Errorf("step %d: take() = (%v, %v), want (%v, %v)", i, ok, wait, st.wantOK, st.wantWait)
+				}
+			}
+		})
+	}
+}
+
+func TestBucketSetClientsAreIndependent(t *testing.T) {
+	now := time.Now()
+	s := newBucketSet(1, 1)
+
+	if ok, _ := s.take("a", now); !ok {
+		t.Fatal("first take for a was rejected")
+	}
+	if ok, _ := s.take("a", now); ok {
+		t.Fatal("second take for a was allowed")
+	}
+	if ok, _ := s.take("b", now); !ok {
+		t.Fatal("take for b was rejected by a's bucket")
+	}
+}
+
+func TestBucketSetSetLimits(t *testing.T) {
+	now := time.Now()
+	s := newBucketSet(1, 10)
+	for i := 0; i < 5; i++ {
+		s.take("client", now)
+	}
+
+	// 缩小容量时已有令牌截断到新容量
+	s.setLimits(1, 2)
+	for i, want := range []bool{true, true, false} {
+		if ok, _ := s.take("client", now); ok != want {
+			t.Errorf("take %d after shrinking burst = %v, want %v", i, ok, want)
+		}
+	}
+}
+
+func TestBucketSetPrune(t *testing.T) {
+	now := time.Now()
+	s := newBucketSet(1, 1)
+	s.take("idle", now.Add(-time.Hour))
+	s.take("active", now)
+
+	s.prune(now, 10*time.Minute)
+
+	if _, ok := s.buckets["idle"]; ok {
+		t.Error("idle bucket was not pruned")
+	}
+	if _, ok := s.buckets["active"]; !ok {
+		t.Error("active bucket was pruned")
+	}
+}
+
+func TestNilBucketSet(t *testing.T) {
+	var s *bucketSet
+	if ok, wait := s.take("client", time.Now()); !ok || wait != 0 {
+		t.Errorf("nil take() = (%v, %v), want (true, 0)", ok, wait)
+	}
+	s.prune(time.Now(), time.Minute)
+}
@@ -0,0 +1,205 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"makeprofit/internal/apierror"
+	"makeprofit/internal/auth"
+	"makeprofit/internal/config"
+	"makeprofit/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultFlushInterval = 30 * time.Second
+	bucketIdleTimeout    = 10 * time.Minute
+)
+
+// Limiter 按API Key和IP限流，并统计每日配额
+type Limiter struct {
+	enabled          bool
+	perKey           *bucketSet
+	perIP            *bucketSet
+	dailyRenders     atomic.Int64
+	dailyUploadBytes atomic.Int64
+	usage            *usageStore
+	logger           *logrus.Logger
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewLimiter 创建限流器，启用时在后台定期持久化用量
+func NewLimiter(cfg *config.RateLimitConfig, logger *logrus.Logger) (*Limiter, error) {
+	l := &Limiter{
+		enabled: cfg.Enabled,
+		logger:  logger,
+		stop:    make(chan struct{}),
+	}
+	if !l.enabled {
+		return l, nil
+	}
+
+	l.perKey = newBucketSet(cfg.PerKey.Rate, cfg.PerKey.Burst)
+	l.perIP = newBucketSet(cfg.PerIP.Rate, cfg.PerIP.Burst)
+	l.dailyRenders.Store(cfg.DailyRenders)
+	l.dailyUploadBytes.Store(cfg.DailyUploadBytes)
+
+	usage, err := newUsageStore(cfg.UsageFile)
+	if err != nil {
+		return nil, err
+	}
+	l.usage = usage
+
+	flushInterval := cfg.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+
+	l.wg.Add(1)
+	go l.run(flushInterval)
+
+	return l, nil
+}
+
+func (l *Limiter) run(interval time.Duration) {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			l.perKey.prune(now, bucketIdleTimeout)
+			l.perIP.prune(now, bucketIdleTimeout)
+			if err := l.usage.flush(); err != nil {
+				l.logger.WithError(err).Warn("Failed to persist rate limit usage")
+			}
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// UpdateLimits 热更新速率和每日配额，已有的令牌桶和当日用量保留
+// 启用状态和用量文件的变更需要重启后生效
+func (l *Limiter) UpdateLimits(cfg *config.RateLimitConfig) {
+	if !l.enabled {
+		return
+	}
+	l.perKey.setLimits(cfg.PerKey.Rate, cfg.PerKey.Burst)
+	l.perIP.setLimits(cfg.PerIP.Rate, cfg.PerIP.Burst)
+	l.dailyRenders.Store(cfg.DailyRenders)
+	l.dailyUploadBytes.Store(cfg.DailyUploadBytes)
+}
+
+// Close 停止后台任务并持久化用量
+func (l *Limiter) Close() error {
+	if !l.enabled {
+		return nil
+	}
+	l.stopOnce.Do(func() { close(l.stop) })
+	l.wg.Wait()
+	return l.usage.flush()
+}
+
+// Usage 获取客户端当日用量
+func (l *Limiter) Usage(clientID string) ClientUsage {
+	if !l.enabled {
+		return ClientUsage{}
+	}
+	return l.usage.get(clientID, time.Now())
+}
+
+// IPMiddleware 按客户端IP限流，需放在鉴权中间件之前，无效API Key的请求同样受限
+// 客户端IP取决于 server.trusted_proxies，不信任代理时为连接的对端地址
+func (l *Limiter) IPMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !l.enabled {
+			c.Next()
+			return
+		}
+
+		ip := c.ClientIP()
+		if ok, wait := l.perIP.take(ip, time.Now()); !ok {
+			l.reject(c, "ip:"+ip, wait, "Too many requests from this IP")
+			return
+		}
+		c.Next()
+	}
+}
+
+// Middleware 按API Key限流并检查每日配额，需放在鉴权中间件之后
+// 通过配额检查时预占一次截图，请求失败（状态码>=400）时退还；请求结束后累加本次上传的字节数
+// 失败请求已上传的字节同样计入上传配额
+func (l *Limiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !l.enabled {
+			c.Next()
+			return
+		}
+
+		now := time.Now()
+		clientID := "ip:" + c.ClientIP()
+
+		if key := auth.KeyFromContext(c); key != nil {
+			clientID = "key:" + key.Name
+			if ok, wait := l.perKey.take(key.Name, now); !ok {
+				l.reject(c, clientID, wait, "Too many requests for this API key")
+				return
+			}
+		}
+
+		result, date := l.usage.reserve(clientID, now, l.dailyRenders.Load(), l.dailyUploadBytes.Load())
+		switch result {
+		case quotaRendersExceeded:
+			l.reject(c, clientID, untilNextDay(now), fmt.Sprintf("Daily render quota of %d exceeded", l.dailyRenders.Load()))
+			return
+		case quotaUploadBytesExceeded:
+			l.reject(c, clientID, untilNextDay(now), fmt.Sprintf("Daily upload quota of %d bytes exceeded", l.dailyUploadBytes.Load()))
+			return
+		}
+
+		reqUsage := &requestUsage{}
+		c.Request = c.Request.WithContext(withRequestUsage(c.Request.Context(), reqUsage))
+
+		c.Next()
+
+		succeeded := c.Writer.Status() < http.StatusBadRequest
+		l.usage.settle(clientID, date, time.Now(), succeeded, reqUsage.uploadBytes.Load())
+	}
+}
+
+func (l *Limiter) reject(c *gin.Context, clientID string, retryAfter time.Duration, message string) {
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	utils.LoggerFromContext(c.Request.Context(), l.logger).WithFields(logrus.Fields{
+		"client":      clientID,
+		"retry_after": seconds,
+		"path":        c.Request.URL.Path,
+	}).Warn(message)
+
+	c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+	apierror.Abort(c, apierror.New(apierror.CodeRateLimited, message))
+}
+
+// untilNextDay 距离下一个UTC自然日的时间
+func untilNextDay(now time.Time) time.Duration {
+	utc := now.UTC()
+	next := time.Date(utc.Year(), utc.Month(), utc.Day()+1, 0, 0, 0, 0, time.UTC)
+	return next.Sub(utc)
+}
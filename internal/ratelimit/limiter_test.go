@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"makeprofit/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func TestIPMiddlewareTrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		forwardedFor   []string // 依次发送的 X-Forwarded-For
+		want           []int
+	}{
+		{
+			// 不信任代理时伪造的 X-Forwarded-For 不影响限流
+			name:         "forwarded header ignored",
+			remoteAddr:   "198.51.100.7:40000",
+			forwardedFor: []string{"203.0.113.1", "203.0.113.2"},
+			want:         []int{http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:           "trusted proxy",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.2:40000",
+			forwardedFor:   []string{"203.0.113.1", "203.0.113.2", "203.0.113.1"},
+			want:           []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:           "untrusted peer",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "198.51.100.7:40000",
+			forwardedFor:   []string{"203.0.113.1", "203.0.113.2"},
+			want:           []int{http.StatusOK, http.StatusTooManyRequests},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, err := NewLimiter(&config.RateLimitConfig{
+				Enabled:   true,
+				PerIP:     config.TokenBucketConfig{Rate: 0.001, Burst: 1},
+				UsageFile: filepath.Join(t.TempDir(), "usage.json"),
+			}, logger)
+			if err != nil {
+				t.Fatalf("NewLimiter() error = %v", err)
+			}
+			defer limiter.Close()
+
+			r := gin.New()
+			if err := r.SetTrustedProxies(tt.trustedProxies); err != nil {
+				t.Fatalf("SetTrustedProxies() error = %v", err)
+			}
+			r.GET("/", limiter.IPMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			for i, forwardedFor := range tt.forwardedFor {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.RemoteAddr = tt.remoteAddr
+				req.Header.Set("X-Forwarded-For", forwardedFor)
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				if w.Code != tt.want[i] {
+					t.Errorf("request %d from %s = %d, want %d", i+1, forwardedFor, w.Code, tt.want[i])
+				}
+			}
+		})
+	}
+}
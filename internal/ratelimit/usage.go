@@ -0,0 +1,202 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ClientUsage 单个客户端的当日用量
+type ClientUsage struct {
+	Renders     int64 `json:"renders"`
+	UploadBytes int64 `json:"upload_bytes"`
+}
+
+// usageSnapshot 持久化到文件的用量快照
+type usageSnapshot struct {
+	Date    string                  `json:"date"`
+	Clients map[string]*ClientUsage `json:"clients"`
+}
+
+// usageStore 按自然日（UTC）统计的客户端用量
+type usageStore struct {
+	mu      sync.Mutex
+	path    string
+	date    string
+	clients map[string]*ClientUsage
+	dirty   bool
+}
+
+func newUsageStore(path string) (*usageStore, error) {
+	store := &usageStore{
+		path:    path,
+		date:    usageDate(time.Now()),
+		clients: make(map[string]*ClientUsage),
+	}
+	if path == "" {
+		return store, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage file: %w", err)
+	}
+
+	var snapshot usageSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse usage file: %w", err)
+	}
+
+	// 只恢复当天的用量
+	if snapshot.Date == store.date && snapshot.Clients != nil {
+		store.clients = snapshot.Clients
+	}
+	return store, nil
+}
+
+func usageDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// get 获取客户端当日用量，跨天时自动清零
+func (s *usageStore) get(id string, now time.Time) ClientUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rollover(now)
+	if u, ok := s.clients[id]; ok {
+		return *u
+	}
+	return ClientUsage{}
+}
+
+// quotaResult 配额检查结果
+type quotaResult int
+
+const (
+	quotaOK quotaResult = iota
+	quotaRendersExceeded
+	quotaUploadBytesExceeded
+)
+
+// reserve 检查客户端当日配额，未超出时预占一次截图；检查和预占在同一把锁内完成，
+// 并发请求不会同时通过最后一个名额。限额为0表示不限制。返回预占所在的日期，用于 settle
+func (s *usageStore) reserve(id string, now time.Time, dailyRenders, dailyUploadBytes int64) (quotaResult, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rollover(now)
+	u, ok := s.clients[id]
+	if !ok {
+		u = &ClientUsage{}
+		s.clients[id] = u
+	}
+	if dailyRenders > 0 && u.Renders >= dailyRenders {
+		return quotaRendersExceeded, s.date
+	}
+	if dailyUploadBytes > 0 && u.UploadBytes >= dailyUploadBytes {
+		return quotaUploadBytesExceeded, s.date
+	}
+	u.Renders++
+	s.dirty = true
+	return quotaOK, s.date
+}
+
+// settle 请求结束后结算：累加上传字节数，失败的请求退还预占的截图次数
+// 预占后已跨天时当日用量已清零，不再退还
+func (s *usageStore) settle(id, date string, now time.Time, succeeded bool, uploadBytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rollover(now)
+	u, ok := s.clients[id]
+	if !ok {
+		u = &ClientUsage{}
+		s.clients[id] = u
+	}
+	if !succeeded && date == s.date && u.Renders > 0 {
+		u.Renders--
+	}
+	u.UploadBytes += uploadBytes
+	s.dirty = true
+}
+
+func (s *usageStore) rollover(now time.Time) {
+	if date := usageDate(now); date != s.date {
+		s.date = date
+		s.clients = make(map[string]*ClientUsage)
+		s.dirty = true
+	}
+}
+
+// flush 将用量写入文件，先写临时文件再重命名保证原子性；写入失败时保留dirty标记，下次重试
+func (s *usageStore) flush() (err error) {
+	s.mu.Lock()
+	if s.path == "" || !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(usageSnapshot{Date: s.date, Clients: s.clients})
+	s.dirty = false
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			s.mu.Lock()
+			s.dirty = true
+			s.mu.Unlock()
+		}
+	}()
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create usage directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".usage-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to create usage temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write usage file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write usage file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace usage file: %w", err)
+	}
+	return nil
+}
+
+// requestUsage 单个请求内累计的上传字节数
+type requestUsage struct {
+	uploadBytes atomic.Int64
+}
+
+type usageContextKey struct{}
+
+func withRequestUsage(ctx context.Context, u *requestUsage) context.Context {
+	return context.WithValue(ctx, usageContextKey{}, u)
+}
+
+// AddUploadBytes 记录当前请求上传到存储的字节数，用于每日上传配额统计
+func AddUploadBytes(ctx context.Context, n int64) {
+	if u, ok := ctx.Value(usageContextKey{}).(*requestUsage); ok && n > 0 {
+		u.uploadBytes.Add(n)
+	}
+}
@@ -0,0 +1,203 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestUsageStoreReserve(t *testing.T) {
+	now := time.Date(2025, 7, 29, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name             string
+		usage            ClientUsage
+		dailyRenders     int64
+		dailyUploadBytes int64
+		want             quotaResult
+		wantRenders      int64
+	}{
+		{name: "unlimited", usage: ClientUsage{Renders: 1000}, want: quotaOK, wantRenders: 1001},
+		{name: "under render quota", usage: ClientUsage{Renders: 9}, dailyRenders: 10, want: quotaOK, wantRenders: 10},
+		{name: "render quota reached", usage: ClientUsage{Renders: 10}, dailyRenders: 10, want: quotaRendersExceeded, wantRenders: 10},
+		{
+			name:             "upload quota reached",
+			usage:            ClientUsage{Renders: 1, UploadBytes: 100},
+			dailyUploadBytes: 100,
+			want:             quotaUploadBytesExceeded,
+			wantRenders:      1,
+		},
+		{
+			name:             "under upload quota",
+			usage:            ClientUsage{UploadBytes: 99},
+			dailyUploadBytes: 100,
+			want:             quotaOK,
+			wantRenders:      1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newUsageStore("")
+			s.date = usageDate(now)
+			usage := tt.usage
+			s.clients["key:ci"] = &usage
+
+			got, date := s.reserve("key:ci", now, tt.dailyRenders, tt.dailyUploadBytes)
+			if got != tt.want {
+				t.Errorf("reserve() = %v, want %v", got, tt.want)
+			}
+			if date != "2025-07-29" {
+				t.Errorf("reserve() date = %q, want 2025-07-29", date)
+			}
+			if renders := s.get("key:ci", now).Renders; renders != tt.wantRenders {
+				t.Errorf("renders = %d, want %d", renders, tt.wantRenders)
+			}
+		})
+	}
+}
+
+func TestUsageStoreReserveConcurrent(t *testing.T) {
+	s, _ := newUsageStore("")
+	now := time.Now()
+
+	const quota = 10
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if result, _ := s.reserve("key:ci", now, quota, 0); result == quotaOK {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := allowed.Load(); got != quota {
+		t.Errorf("allowed = %d, want %d", got, quota)
+	}
+}
+
+func TestUsageStoreSettle(t *testing.T) {
+	day := time.Date(2025, 7, 29, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		settleAt  time.Time
+		succeeded bool
+		bytes     int64
+		want      ClientUsage
+	}{
+		{name: "success keeps render", settleAt: day, succeeded: true, bytes: 100, want: ClientUsage{Renders: 1, UploadBytes: 100}},
+		{name: "failure refunds render", settleAt: day, succeeded: false, bytes: 40, want: ClientUsage{Renders: 0, UploadBytes: 40}},
+		// 跨天后用量已清零，失败请求不再退还
+		{name: "failure after rollover", settleAt: day.Add(24 * time.Hour), succeeded: false, bytes: 40, want: ClientUsage{UploadBytes: 40}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newUsageStore("")
+			s.date = usageDate(day)
+
+			_, date := s.reserve("key:ci", day, 0, 0)
+			s.settle("key:ci", date, tt.settleAt, tt.succeeded, tt.bytes)
+
+			if got := s.get("key:ci", tt.settleAt); got != tt.want {
+				t.Errorf("usage = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUsageStoreRollover(t *testing.T) {
+	day := time.Date(2025, 7, 29, 23, 59, 0, 0, time.UTC)
+	s, _ := newUsageStore("")
+	s.date = usageDate(day)
+
+	s.reserve("key:ci", day, 0, 0)
+	if got := s.get("key:ci", day.Add(2*time.Minute)); got != (ClientUsage{}) {
+		t.Errorf("usage after UTC midnight = %+v, want zero", got)
+	}
+}
+
+func TestUsageStoreFlush(t *testing.T) {
+	// 用量文件所在目录不存在时自动创建
+	path := filepath.Join(t.TempDir(), "state", "usage.json")
+	s, err := newUsageStore(path)
+	if err != nil {
+		t.Fatalf("newUsageStore() error = %v", err)
+	}
+	now := time.Now()
+	_, date := s.reserve("key:ci", now, 0, 0)
+	s.settle("key:ci", date, now, true, 512)
+
+	if err := s.flush(); err != nil {
+		t.Fatalf("flush() error = %v", err)
+	}
+
+	reloaded, err := newUsageStore(path)
+	if err != nil {
+		t.Fatalf("newUsageStore() reload error = %v", err)
+	}
+	if got, want := reloaded.get("key:ci", now), (ClientUsage{Renders: 1, UploadBytes: 512}); got != want {
+		t.Errorf("reloaded usage = %+v, want %+v", got, want)
+	}
+}
+
+func TestUsageStoreFlushRetriesAfterFailure(t *testing.T) {
+	dir := t.TempDir()
+	// 用普通文件占住父目录，使写入失败
+	blocker := filepath.Join(dir, "blocker")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	s, _ := newUsageStore("")
+	s.path = filepath.Join(blocker, "usage.json")
+	s.reserve("key:ci", time.Now(), 0, 0)
+
+	if err := s.flush(); err == nil {
+		t.Fatal("flush() into a file path succeeded")
+	}
+	if !s.dirty {
+		t.Fatal("failed flush cleared the dirty flag")
+	}
+
+	// 路径恢复可写后，下一次flush写入之前的用量
+	s.path = filepath.Join(dir, "usage.json")
+	if err := s.flush(); err != nil {
+		t.Fatalf("flush() retry error = %v", err)
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	var snapshot usageSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if u := snapshot.Clients["key:ci"]; u == nil || u.Renders != 1 {
+		t.Errorf("persisted usage = %+v, want 1 render", u)
+	}
+}
+
+func TestUntilNextDay(t *testing.T) {
+	tests := []struct {
+		now  time.Time
+		want time.Duration
+	}{
+		{now: time.Date(2025, 7, 29, 0, 0, 0, 0, time.UTC), want: 24 * time.Hour},
+		{now: time.Date(2025, 7, 29, 23, 30, 0, 0, time.UTC), want: 30 * time.Minute},
+		// 非UTC时区按UTC自然日计算
+		{now: time.Date(2025, 7, 29, 8, 0, 0, 0, time.FixedZone("UTC+8", 8*3600)), want: 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := untilNextDay(tt.now); got != tt.want {
+			t.Errorf("untilNextDay(%v) = %v, want %v", tt.now, got, tt.want)
+		}
+	}
+}
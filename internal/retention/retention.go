@@ -0,0 +1,318 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"makeprofit/internal/config"
+	"makeprofit/internal/s3"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 需要清理的对象目录（不含ImagePrefix）
+var prefixes = []string{"screenshots/", "data/"}
+
+// contentGracePeriod 内容对象上传后到别名复制完成前还没有引用，较新的内容对象不清理
+const contentGracePeriod = time.Hour
+
+// referenceWorkers 并发读取别名元数据的数量
+const referenceWorkers = 8
+
+// timeframePattern 匹配文件名中的时间框架段，如 1h、1d、1wk、5m、1mo
+var timeframePattern = regexp.MustCompile(`^\d+(m|h|d|wk|mo|y)$`)
+
+// Storage 保留策略依赖的存储操作
+type Storage interface {
+	ListAll(ctx context.Context, prefix, startAfter, stopAfter string) ([]s3.ObjectInfo, error)
+	DeleteObjects(ctx context.Context, keys []string) error
+	AliasContentKey(ctx context.Context, fullKey string) (string, error)
+}
+
+// Index 需要与存储同步清理的索引，如截图历史
+type Index interface {
+	Prune(keys []string) (int, error)
+	// ContentKeys 索引中仍在引用的内容寻址key，这些内容对象不会作为无引用对象清理
+	ContentKeys() (map[string]bool, error)
+}
+
+// Report 一次清理的结果
+type Report struct {
+	DryRun   bool      `json:"dry_run"`
+	Scanned  int       `json:"scanned"`
+	Expired  int       `json:"expired"`
+	Orphaned int       `json:"orphaned"` // 不再被引用的内容寻址对象
+	Deleted  int       `json:"deleted"`
+	Pruned   int       `json:"pruned"` // 同步删除或更新的索引记录
+	Keys     []string  `json:"keys,omitempty"`
+	Started  time.Time `json:"started"`
+	Duration string    `json:"duration"`
+}
+
+// Manager 按时间框架清理过期对象
+type Manager struct {
+	storage  Storage
+	index    Index // 可选，为nil时不同步清理索引
+	rules    map[string]time.Duration
+	interval time.Duration
+	dryRun   bool
+	logger   *logrus.Logger
+
+	// 同一时间只允许一次清理
+	running sync.Mutex
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewManager 创建保留策略管理器，index为nil时只清理存储
+func NewManager(cfg *config.RetentionConfig, storage Storage, index Index, logger *logrus.Logger) (*Manager, error) {
+	for timeframe, maxAge := range cfg.Rules {
+		if maxAge < 0 {
+			return nil, fmt.Errorf("retention rule for %s must not be negative", timeframe)
+		}
+	}
+
+	return &Manager{
+		storage:  storage,
+		index:    index,
+		rules:    cfg.Rules,
+		interval: cfg.Interval,
+		dryRun:   cfg.DryRun,
+		logger:   logger,
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+// Start 启动定期清理，interval为0时不启动
+func (m *Manager) Start() {
+	if m.interval <= 0 {
+		return
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := m.Run(context.Background(), m.dryRun); err != nil {
+					m.logger.WithError(err).Error("Retention run failed")
+				}
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close 停止定期清理
+func (m *Manager) Close() {
+	m.stopOnce.Do(func() { close(m.stop) })
+	m.wg.Wait()
+}
+
+// DryRunDefault 配置中的默认dry-run设置
+func (m *Manager) DryRunDefault() bool {
+	return m.dryRun
+}
+
+// Run 执行一次清理，dryRun为true时只统计不删除
+func (m *Manager) Run(ctx context.Context, dryRun bool) (*Report, error) {
+	if !m.running.TryLock() {
+		return nil, fmt.Errorf("retention run already in progress")
+	}
+	defer m.running.Unlock()
+
+	report := &Report{DryRun: dryRun, Started: time.Now()}
+
+	var expired, kept []string
+	for _, prefix := range prefixes {
+		objects, err := m.storage.ListAll(ctx, prefix, "", "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+		}
+
+		for _, obj := range objects {
+			report.Scanned++
+
+			timeframe := objectTimeframe(obj.Key)
+			maxAge, ok := m.maxAge(timeframe)
+			if !ok || report.Started.Sub(obj.LastModified) <= maxAge {
+				kept = append(kept, obj.Key)
+				continue
+			}
+
+			expired = append(expired, obj.Key)
+			m.logger.WithFields(logrus.Fields{
+				"key":           obj.Key,
+				"timeframe":     timeframe,
+				"last_modified": obj.LastModified.Format(time.RFC3339),
+				"dry_run":       dryRun,
+			}).Info("Object expired by retention policy")
+		}
+	}
+
+	orphaned, err := m.orphanedContent(ctx, kept, report.Started, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	report.Expired = len(expired)
+	report.Orphaned = len(orphaned)
+	report.Keys = append(expired, orphaned...)
+
+	if !dryRun && len(report.Keys) > 0 {
+		if err := m.storage.DeleteObjects(ctx, report.Keys); err != nil {
+			return nil, err
+		}
+		report.Deleted = len(report.Keys)
+
+		// 索引清理失败只记录日志，不影响已完成的删除
+		if m.index != nil {
+			pruned, err := m.index.Prune(report.Keys)
+			if err != nil {
+				m.logger.WithError(err).Error("Failed to prune index after retention run")
+			}
+			report.Pruned = pruned
+		}
+	}
+
+	report.Duration = time.Since(report.Started).String()
+	m.logger.WithFields(logrus.Fields{
+		"dry_run":  dryRun,
+		"scanned":  report.Scanned,
+		"expired":  report.Expired,
+		"orphaned": report.Orphaned,
+		"deleted":  report.Deleted,
+		"pruned":   report.Pruned,
+		"duration": report.Duration,
+	}).Info("Retention run completed")
+
+	return report, nil
+}
+
+// orphanedContent 找出不再被任何保留的别名或索引记录引用的内容寻址对象
+// 别名是内容的完整副本，删除内容对象不影响别名，但会使响应中的content_cdn_url和历史记录的URL失效，因此只清理无引用的内容
+func (m *Manager) orphanedContent(ctx context.Context, aliases []string, now time.Time, dryRun bool) ([]string, error) {
+	objects, err := m.storage.ListAll(ctx, s3.ContentPrefix, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", s3.ContentPrefix, err)
+	}
+	if len(objects) == 0 {
+		// 未启用内容寻址，不需要读取别名元数据
+		return nil, nil
+	}
+
+	referenced, err := m.references(ctx, aliases)
+	if err != nil {
+		return nil, err
+	}
+	if m.index != nil {
+		indexed, err := m.index.ContentKeys()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index content keys: %w", err)
+		}
+		for key := range indexed {
+			referenced[key] = true
+		}
+	}
+
+	var orphaned []string
+	for _, obj := range objects {
+		if referenced[obj.Key] || now.Sub(obj.LastModified) < contentGracePeriod {
+			continue
+		}
+
+		orphaned = append(orphaned, obj.Key)
+		m.logger.WithFields(logrus.Fields{
+			"key":           obj.Key,
+			"last_modified": obj.LastModified.Format(time.RFC3339),
+			"dry_run":       dryRun,
+		}).Info("Content object no longer referenced")
+	}
+	return orphaned, nil
+}
+
+// references 并发读取别名指向的内容key，任一读取失败时返回错误，避免误删仍被引用的内容
+func (m *Manager) references(ctx context.Context, aliases []string) (map[string]bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu         sync.Mutex
+		wg         sync.WaitGroup
+		firstErr   error
+		referenced = make(map[string]bool)
+		keys       = make(chan string)
+	)
+	for i := 0; i < referenceWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keys {
+				contentKey, err := m.storage.AliasContentKey(ctx, key)
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				if contentKey != "" {
+					referenced[contentKey] = true
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+send:
+	for _, key := range aliases {
+		select {
+		case keys <- key:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(keys)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, fmt.Errorf("failed to read alias metadata: %w", firstErr)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return referenced, nil
+}
+
+// maxAge 获取时间框架的保留时长，ok为false表示永久保留
+func (m *Manager) maxAge(timeframe string) (time.Duration, bool) {
+	maxAge, ok := m.rules[timeframe]
+	if !ok {
+		maxAge, ok = m.rules["default"]
+	}
+	return maxAge, ok && maxAge > 0
+}
+
+// objectTimeframe 从对象文件名（{symbol}_{market}_{timeframe}_...）中解析时间框架
+func objectTimeframe(key string) string {
+	base := path.Base(key)
+	parts := strings.Split(strings.TrimSuffix(base, path.Ext(base)), "_")
+	for i := 2; i < len(parts); i++ {
+		if timeframePattern.MatchString(parts[i]) {
+			return parts[i]
+		}
+	}
+	return ""
+}
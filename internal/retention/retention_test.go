@@ -0,0 +1,235 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"makeprofit/internal/config"
+	"makeprofit/internal/s3"
+
+	"github.com/sirupsen/logrus"
+)
+
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// fakeStorage 内存中的存储，aliases记录别名指向的内容key
+type fakeStorage struct {
+	objects  []s3.ObjectInfo
+	aliases  map[string]string
+	aliasErr error
+	deleted  []string
+}
+
+func (f *fakeStorage) ListAll(_ context.Context, prefix, _, _ string) ([]s3.ObjectInfo, error) {
+	var result []s3.ObjectInfo
+	for _, obj := range f.objects {
+		if strings.HasPrefix(obj.Key, prefix) {
+			result = append(result, obj)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeStorage) DeleteObjects(_ context.Context, keys []string) error {
+	f.deleted = append(f.deleted, keys...)
+	return nil
+}
+
+func (f *fakeStorage) AliasContentKey(_ context.Context, key string) (string, error) {
+	if f.aliasErr != nil {
+		return "", f.aliasErr
+	}
+	return f.aliases[key], nil
+}
+
+type fakeIndex struct {
+	pruned      []string
+	contentKeys map[string]bool
+}
+
+func (f *fakeIndex) Prune(keys []string) (int, error) {
+	f.pruned = append(f.pruned, keys...)
+	return len(keys), nil
+}
+
+func (f *fakeIndex) ContentKeys() (map[string]bool, error) {
+	return f.contentKeys, nil
+}
+
+func TestObjectTimeframe(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "screenshots/NVDA_us_1d_20250729_120000.png", want: "1d"},
+		{key: "data/NVDA_us_1h_20250729_120000.json", want: "1h"},
+		{key: "screenshots/AAPL_us_5m_20250729.png", want: "5m"},
+		{key: "screenshots/AAPL_us_1wk_20250729.png", want: "1wk"},
+		{key: "screenshots/AAPL_us_1mo_20250729.png", want: "1mo"},
+		{key: "screenshots/AAPL_us_1y_20250729.png", want: "1y"},
+		{key: "prefix/screenshots/0700_hk_1d_20250729.png", want: "1d"},
+		// 股票代码和市场段不参与匹配
+		{key: "screenshots/1d_us_20250729.png", want: ""},
+		{key: "screenshots/NVDA_us_20250729.png", want: ""},
+		{key: "screenshots/NVDA_us_daily_20250729.png", want: ""},
+		{key: "screenshots/notes.txt", want: ""},
+	}
+	for _, tt := range tests {
+		if got := objectTimeframe(tt.key); got != tt.want {
+			t.Errorf("objectTimeframe(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestManagerMaxAge(t *testing.T) {
+	tests := []struct {
+		name      string
+		rules     map[string]time.Duration
+		timeframe string
+		want      time.Duration
+		wantOK    bool
+	}{
+		{name: "no rules", timeframe: "1d"},
+		{name: "timeframe rule", rules: map[string]time.Duration{"1d": time.Hour}, timeframe: "1d", want: time.Hour, wantOK: true},
+		{name: "default rule", rules: map[string]time.Duration{"default": time.Minute}, timeframe: "1h", want: time.Minute, wantOK: true},
+		{
+			name:      "timeframe overrides default",
+			rules:     map[string]time.Duration{"default": time.Minute, "1d": time.Hour},
+			timeframe: "1d",
+			want:      time.Hour,
+			wantOK:    true,
+		},
+		// 0表示该时间框架永久保留，不回退到default
+		{name: "zero keeps forever", rules: map[string]time.Duration{"default": time.Minute, "1d": 0}, timeframe: "1d"},
+		{name: "unknown timeframe uses default", rules: map[string]time.Duration{"default": time.Minute}, timeframe: "", want: time.Minute, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Manager{rules: tt.rules}
+			got, ok := m.maxAge(tt.timeframe)
+			if ok != tt.wantOK || (ok && got != tt.want) {
+				t.Errorf("maxAge(%q) = (%v, %v), want (%v, %v)", tt.timeframe, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestNewManagerRejectsNegativeRules(t *testing.T) {
+	cfg := &config.RetentionConfig{Rules: map[string]time.Duration{"1d": -time.Hour}}
+	if _, err := NewManager(cfg, &fakeStorage{}, nil, testLogger()); err == nil {
+		t.Error("NewManager() with a negative rule returned nil error")
+	}
+}
+
+func TestManagerRun(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	storage := &fakeStorage{
+		objects: []s3.ObjectInfo{
+			{Key: "screenshots/NVDA_us_1h_1.png", LastModified: old},
+			{Key: "screenshots/NVDA_us_1d_1.png", LastModified: old},
+			{Key: "data/NVDA_us_1h_1.json", LastModified: old},
+			{Key: "data/NVDA_us_1h_2.json", LastModified: now},
+			{Key: "objects/sha256/aa/aa11.png", LastModified: old}, // 被保留的1d截图引用
+			{Key: "objects/sha256/bb/bb22.png", LastModified: old}, // 只被过期截图引用
+			{Key: "objects/sha256/cc/cc33.png", LastModified: now}, // 刚上传，尚未复制别名
+		},
+		aliases: map[string]string{
+			"screenshots/NVDA_us_1d_1.png": "objects/sha256/aa/aa11.png",
+			"screenshots/NVDA_us_1h_1.png": "objects/sha256/bb/bb22.png",
+		},
+	}
+	cfg := &config.RetentionConfig{Rules: map[string]time.Duration{"1h": 24 * time.Hour}}
+
+	t.Run("dry run", func(t *testing.T) {
+		storage.deleted = nil
+		index := &fakeIndex{}
+		m, err := NewManager(cfg, storage, index, testLogger())
+		if err != nil {
+			t.Fatalf("NewManager() error = %v", err)
+		}
+
+		report, err := m.Run(context.Background(), true)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if report.Scanned != 4 || report.Expired != 2 || report.Orphaned != 1 || report.Deleted != 0 {
+			t.Errorf("report = %+v, want scanned 4, expired 2, orphaned 1, deleted 0", report)
+		}
+		if len(storage.deleted) != 0 || len(index.pruned) != 0 {
+			t.Errorf("dry run deleted %v and pruned %v", storage.deleted, index.pruned)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		storage.deleted = nil
+		index := &fakeIndex{}
+		m, err := NewManager(cfg, storage, index, testLogger())
+		if err != nil {
+			t.Fatalf("NewManager() error = %v", err)
+		}
+
+		report, err := m.Run(context.Background(), false)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+
+		want := []string{"data/NVDA_us_1h_1.json", "objects/sha256/bb/bb22.png", "screenshots/NVDA_us_1h_1.png"}
+		sort.Strings(storage.deleted)
+		if strings.Join(storage.deleted, ",") != strings.Join(want, ",") {
+			t.Errorf("deleted = %v, want %v", storage.deleted, want)
+		}
+		if report.Deleted != len(want) || report.Pruned != len(want) || len(index.pruned) != len(want) {
+			t.Errorf("report = %+v, pruned %v", report, index.pruned)
+		}
+	})
+
+	t.Run("index references keep content", func(t *testing.T) {
+		storage.deleted = nil
+		// 历史记录仍引用被覆盖的截图内容
+		index := &fakeIndex{contentKeys: map[string]bool{"objects/sha256/bb/bb22.png": true}}
+		m, err := NewManager(cfg, storage, index, testLogger())
+		if err != nil {
+			t.Fatalf("NewManager() error = %v", err)
+		}
+
+		report, err := m.Run(context.Background(), false)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if report.Orphaned != 0 {
+			t.Errorf("orphaned = %d, want 0", report.Orphaned)
+		}
+		for _, key := range storage.deleted {
+			if strings.HasPrefix(key, s3.ContentPrefix) {
+				t.Errorf("deleted content %s still referenced by the index", key)
+			}
+		}
+	})
+
+	t.Run("alias read failure keeps content", func(t *testing.T) {
+		storage.deleted = nil
+		storage.aliasErr = errors.New("access denied")
+		defer func() { storage.aliasErr = nil }()
+
+		m, err := NewManager(cfg, storage, nil, testLogger())
+		if err != nil {
+			t.Fatalf("NewManager() error = %v", err)
+		}
+		if _, err := m.Run(context.Background(), false); err == nil {
+			t.Error("Run() with unreadable alias metadata returned nil error")
+		}
+		if len(storage.deleted) != 0 {
+			t.Errorf("deleted = %v after failed reference check", storage.deleted)
+		}
+	})
+}
@@ -3,27 +3,34 @@ package s3
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"makeprofit/internal/config"
+	"makeprofit/pkg/utils"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/sirupsen/logrus"
 )
 
+const defaultUploadTimeout = 2 * time.Minute
+
 // Client S3客户端
 type Client struct {
-	s3Client *s3.Client
-	config   *config.S3Config
-	logger   *logrus.Logger
+	s3Client      *s3.Client
+	uploader      *manager.Uploader
+	uploadTimeout time.Duration
+	checksum      types.ChecksumAlgorithm
+	config        *config.S3Config
+	logger        *logrus.Logger
 }
 
 // NewClient 创建新的S3客户端
-func NewClient(cfg *config.S3Config) (*Client, error) {
-	logger := logrus.New()
-
+func NewClient(cfg *config.S3Config, logger *logrus.Logger) (*Client, error) {
 	// 加载AWS配置
 	var err error
 	var awsCfg aws.Config
@@ -56,14 +63,48 @@ func NewClient(cfg *config.S3Config) (*Client, error) {
 		o.ClientLogMode = 0 // 禁用客户端日志以减少噪音
 	})
 
+	uploader, err := newUploader(s3Client, &cfg.Multipart)
+	if err != nil {
+		return nil, err
+	}
+	checksum, _ := checksumAlgorithm(cfg.Multipart.Checksum)
+
+	uploadTimeout := cfg.UploadTimeout
+	if uploadTimeout <= 0 {
+		uploadTimeout = defaultUploadTimeout
+	}
+
 	return &Client{
-		s3Client: s3Client,
-		config:   cfg,
-		logger:   logger,
+		s3Client:      s3Client,
+		uploader:      uploader,
+		uploadTimeout: uploadTimeout,
+		checksum:      checksum,
+		config:        cfg,
+		logger:        logger,
 	}, nil
 }
 
+// log 返回带请求ID的日志
+func (c *Client) log(ctx context.Context) *logrus.Entry {
+	return utils.LoggerFromContext(ctx, c.logger)
+}
+
 // GetConfig 获取S3配置
 func (c *Client) GetConfig() *config.S3Config {
 	return c.config
 }
+
+// PresignGetURL 生成带有效期的预签名下载URL，适用于私有bucket
+func (c *Client) PresignGetURL(ctx context.Context, s3Key string, ttl time.Duration) (string, error) {
+	presignClient := s3.NewPresignClient(c.s3Client)
+
+	req, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.config.Bucket),
+		Key:    aws.String(s3Key),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign S3 URL: %w", err)
+	}
+
+	return req.URL, nil
+}
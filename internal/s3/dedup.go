@@ -0,0 +1,215 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/sirupsen/logrus"
+)
+
+// 对象元数据中记录内容哈希和内容key的字段
+const (
+	metaSHA256     = "sha256"
+	metaContentKey = "content-key"
+)
+
+// ContentPrefix 内容寻址对象所在目录（不含ImagePrefix）
+const ContentPrefix = "objects/sha256/"
+
+// ContentKey 内容寻址key（不含ImagePrefix），格式：objects/sha256/{前两位}/{hash}{ext}
+func ContentKey(sha256Hex, ext string) string {
+	return fmt.Sprintf("%s%s/%s%s", ContentPrefix, sha256Hex[:2], sha256Hex, ext)
+}
+
+// AliasContentKey 读取别名指向的内容key（含ImagePrefix），不是别名或对象不存在时返回空
+func (c *Client) AliasContentKey(ctx context.Context, fullKey string) (string, error) {
+	meta, err := c.headMetadata(ctx, fullKey)
+	if err != nil {
+		return "", err
+	}
+	return meta[metaContentKey], nil
+}
+
+// ObjectSHA256 读取上传时写入的内容SHA256元数据，对象不存在或未记录哈希时返回空
+func (c *Client) ObjectSHA256(ctx context.Context, fullKey string) (string, error) {
+	meta, err := c.headMetadata(ctx, fullKey)
+	if err != nil {
+		return "", err
+	}
+	return meta[metaSHA256], nil
+}
+
+// UploadDeduplicated 按内容哈希去重上传
+// 内容保存在不可变的内容寻址key下，已存在时跳过上传；s3Key作为别名通过服务端复制指向该内容，
+// 别名已指向相同内容时不做任何写入
+// opts应用于别名；内容对象使用不可变缓存策略，并继承opts中的元数据和标签
+func (c *Client) UploadDeduplicated(ctx context.Context, body io.ReadSeeker, s3Key, contentType string, opts *UploadOptions) (*UploadResult, error) {
+	size := readerSize(body)
+	if size < 0 {
+		return nil, fmt.Errorf("failed to determine upload size")
+	}
+
+	hashed, sum, err := hashingBody(body)
+	if err != nil {
+		return nil, err
+	}
+	sha := sum()
+
+	aliasKey := c.fullKey(s3Key)
+	contentKey := c.fullKey(ContentKey(sha, path.Ext(s3Key)))
+
+	result := &UploadResult{
+		URL: fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s",
+			c.config.Bucket, c.config.Region, aliasKey),
+		Key:        aliasKey,
+		ContentKey: contentKey,
+		Size:       size,
+		SHA256:     sha,
+		Uploaded:   time.Now(),
+	}
+
+	// HEAD、上传和复制共用同一个上传超时
+	ctx, cancel := context.WithTimeout(ctx, c.uploadTimeout)
+	defer cancel()
+
+	// 别名已经指向相同内容
+	aliasMeta, err := c.headMetadata(ctx, aliasKey)
+	if err != nil {
+		return nil, err
+	}
+	if aliasMeta != nil && aliasMeta[metaSHA256] == sha {
+		result.Unchanged = true
+		c.log(ctx).WithFields(logrus.Fields{
+			"s3_key": aliasKey,
+			"sha256": sha,
+		}).Info("Content unchanged, skipping upload")
+		return result, nil
+	}
+
+	result.Replaced = aliasMeta != nil
+
+	// 内容不存在时上传
+	contentMeta, err := c.headMetadata(ctx, contentKey)
+	if err != nil {
+		return nil, err
+	}
+	putContent := func() error {
+		input := &s3.PutObjectInput{
+			Bucket:        aws.String(c.config.Bucket),
+			Key:           aws.String(contentKey),
+			Body:          hashed,
+			ContentLength: aws.Int64(size),
+			ContentType:   aws.String(contentType),
+			Metadata:      map[string]string{metaSHA256: sha},
+		}
+		contentOpts := UploadOptions{CacheControl: ImmutableCacheControl}
+		if opts != nil {
+			contentOpts.Metadata = opts.Metadata
+			contentOpts.Tags = opts.Tags
+		}
+		contentOpts.applyPut(input)
+
+		if err := c.putObject(ctx, input); err != nil {
+			return fmt.Errorf("failed to upload content to S3: %w", err)
+		}
+		return nil
+	}
+	if contentMeta == nil {
+		if err := putContent(); err != nil {
+			return nil, err
+		}
+	}
+
+	// 更新别名
+	copyInput := &s3.CopyObjectInput{
+		Bucket:            aws.String(c.config.Bucket),
+		Key:               aws.String(aliasKey),
+		CopySource:        aws.String(copySource(c.config.Bucket, contentKey)),
+		ContentType:       aws.String(contentType),
+		MetadataDirective: types.MetadataDirectiveReplace,
+		Metadata: map[string]string{
+			metaSHA256:     sha,
+			metaContentKey: contentKey,
+		},
+	}
+	opts.applyCopy(copyInput)
+
+	_, err = c.s3Client.CopyObject(ctx, copyInput)
+	if err != nil && contentMeta != nil && isNotFound(err) {
+		// 内容对象在检查之后被保留策略清理，重新上传后再复制
+		if err := putContent(); err != nil {
+			return nil, err
+		}
+		_, err = c.s3Client.CopyObject(ctx, copyInput)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update alias %s: %w", aliasKey, err)
+	}
+
+	c.log(ctx).WithFields(logrus.Fields{
+		"s3_key":          aliasKey,
+		"content_key":     contentKey,
+		"sha256":          sha,
+		"size":            size,
+		"content_existed": contentMeta != nil,
+	}).Info("Content-addressed upload completed")
+
+	return result, nil
+}
+
+// copySource CopyObject的源对象，S3要求key经过URL编码，保留路径分隔符
+func copySource(bucket, fullKey string) string {
+	segments := strings.Split(fullKey, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return bucket + "/" + strings.Join(segments, "/")
+}
+
+// headMetadata 获取对象元数据，对象不存在时返回nil
+func (c *Client) headMetadata(ctx context.Context, fullKey string) (map[string]string, error) {
+	output, err := c.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(c.config.Bucket),
+		Key:    aws.String(fullKey),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to head object %s: %w", fullKey, err)
+	}
+	if output.Metadata == nil {
+		return map[string]string{}, nil
+	}
+	return output.Metadata, nil
+}
+
+// isNotFound 判断S3错误是否表示对象不存在
+func isNotFound(err error) bool {
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return true
+	}
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return true
+	}
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusNotFound {
+		return true
+	}
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "NotFound"
+}
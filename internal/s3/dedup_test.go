@@ -0,0 +1,116 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"makeprofit/internal/config"
+)
+
+func TestContentKey(t *testing.T) {
+	got := ContentKey("ab12cd", ".png")
+	if got != "objects/sha256/ab/ab12cd.png" {
+		t.Errorf("ContentKey() = %s", got)
+	}
+}
+
+func TestUploadDeduplicated(t *testing.T) {
+	first := []byte("chart image v1")
+	second := []byte("chart image v2")
+	sum := func(data []byte) string {
+		digest := sha256.Sum256(data)
+		return hex.EncodeToString(digest[:])
+	}
+	const alias = "screenshots/NVDA_us_1d_20260102.png"
+
+	fake := newFakeS3(t)
+	client := newTestClient(t, fake, config.S3Config{ImagePrefix: "screenshot", ContentAddressed: true})
+	upload := func(data []byte, key string) *UploadResult {
+		t.Helper()
+		result, err := client.UploadDeduplicated(context.Background(), bytes.NewReader(data), key, "image/png", nil)
+		if err != nil {
+			t.Fatalf("UploadDeduplicated(%s) error = %v", key, err)
+		}
+		return result
+	}
+
+	// 首次上传：写入内容对象，别名复制自内容对象
+	result := upload(first, alias)
+	contentKey := "screenshot/" + ContentKey(sum(first), ".png")
+	if result.Key != "screenshot/"+alias || result.ContentKey != contentKey || result.SHA256 != sum(first) || result.Size != int64(len(first)) {
+		t.Errorf("first upload = %+v", result)
+	}
+	if result.Unchanged || result.Replaced {
+		t.Errorf("first upload unchanged=%v replaced=%v, want both false", result.Unchanged, result.Replaced)
+	}
+	content := fake.object(contentKey)
+	if content == nil || !bytes.Equal(content.body, first) {
+		t.Fatalf("content object %s was not uploaded", contentKey)
+	}
+	if got := content.header.Get("Cache-Control"); got != ImmutableCacheControl {
+		t.Errorf("content Cache-Control = %q, want %q", got, ImmutableCacheControl)
+	}
+	aliasObj := fake.object("screenshot/" + alias)
+	if aliasObj == nil || !bytes.Equal(aliasObj.body, first) {
+		t.Fatal("alias was not copied from the content object")
+	}
+	if aliasObj.header.Get("X-Amz-Meta-Content-Key") != contentKey || aliasObj.header.Get("X-Amz-Meta-Sha256") != sum(first) {
+		t.Errorf("alias metadata = %v", aliasObj.header)
+	}
+	if key, err := client.AliasContentKey(context.Background(), "screenshot/"+alias); err != nil || key != contentKey {
+		t.Errorf("AliasContentKey() = %q, %v; want %q", key, err, contentKey)
+	}
+
+	// 相同内容：不做任何写入
+	puts, copies := fake.count("PUT"), fake.count("COPY")
+	if result := upload(first, alias); !result.Unchanged {
+		t.Errorf("repeated upload unchanged = false")
+	}
+	if fake.count("PUT") != puts || fake.count("COPY") != copies {
+		t.Errorf("repeated upload wrote objects: %d puts, %d copies", fake.count("PUT")-puts, fake.count("COPY")-copies)
+	}
+
+	// 相同内容的新别名：只复制，不重新上传内容
+	if result := upload(first, "screenshots/NVDA_us_1d_20260103.png"); result.Unchanged || result.ContentKey != contentKey {
+		t.Errorf("new alias = %+v", result)
+	}
+	if fake.count("PUT") != puts || fake.count("COPY") != copies+1 {
+		t.Errorf("new alias: %d puts, %d copies, want 0 and 1", fake.count("PUT")-puts, fake.count("COPY")-copies)
+	}
+
+	// 别名内容变化：上传新内容对象并覆盖别名，旧内容对象保留
+	result = upload(second, alias)
+	if !result.Replaced || result.Unchanged || result.SHA256 != sum(second) {
+		t.Errorf("changed content = %+v", result)
+	}
+	if aliasObj := fake.object("screenshot/" + alias); aliasObj == nil || !bytes.Equal(aliasObj.body, second) {
+		t.Error("alias does not point to the new content")
+	}
+	if fake.object(contentKey) == nil {
+		t.Error("previous content object was removed")
+	}
+}
+
+func TestUploadDeduplicatedReusesContent(t *testing.T) {
+	data := []byte("chart image")
+	digest := sha256.Sum256(data)
+	contentKey := ContentKey(hex.EncodeToString(digest[:]), ".png")
+
+	fake := newFakeS3(t)
+	client := newTestClient(t, fake, config.S3Config{ContentAddressed: true})
+
+	// 内容对象存在时跳过上传
+	fake.put(contentKey, data, map[string]string{"sha256": hex.EncodeToString(digest[:])})
+	if _, err := client.UploadDeduplicated(context.Background(), bytes.NewReader(data), "screenshots/a.png", "image/png", nil); err != nil {
+		t.Fatalf("UploadDeduplicated() error = %v", err)
+	}
+	if n := fake.count("PUT"); n != 0 {
+		t.Errorf("existing content uploaded again: %d puts", n)
+	}
+	if obj := fake.object("screenshots/a.png"); obj == nil || !bytes.Equal(obj.body, data) {
+		t.Error("alias was not created from the existing content")
+	}
+}
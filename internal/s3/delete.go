@@ -0,0 +1,48 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/sirupsen/logrus"
+)
+
+// DeleteObjects 每次请求允许删除的最大对象数
+const maxDeleteBatch = 1000
+
+// DeleteObjects 批量删除对象，keys为包含ImagePrefix的完整key
+func (c *Client) DeleteObjects(ctx context.Context, keys []string) error {
+	for start := 0; start < len(keys); start += maxDeleteBatch {
+		end := min(start+maxDeleteBatch, len(keys))
+
+		objects := make([]types.ObjectIdentifier, 0, end-start)
+		for _, key := range keys[start:end] {
+			objects = append(objects, types.ObjectIdentifier{Key: aws.String(key)})
+		}
+
+		output, err := c.s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(c.config.Bucket),
+			Delete: &types.Delete{
+				Objects: objects,
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete objects: %w", err)
+		}
+		if len(output.Errors) > 0 {
+			first := output.Errors[0]
+			return fmt.Errorf("failed to delete %d objects, first error on %s: %s",
+				len(output.Errors), aws.ToString(first.Key), aws.ToString(first.Message))
+		}
+
+		c.log(ctx).WithFields(logrus.Fields{
+			"count": len(objects),
+		}).Info("Objects deleted from S3")
+	}
+
+	return nil
+}
@@ -0,0 +1,382 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"makeprofit/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+const testBucket = "test-bucket"
+
+// fakeObject 内存中的S3对象
+type fakeObject struct {
+	body    []byte
+	header  http.Header // Content-Type、Cache-Control、x-amz-meta-*、x-amz-tagging
+	partial bool        // 分片上传中尚未完成
+}
+
+// fakeS3 内存S3服务，支持测试用到的PutObject、HeadObject、CopyObject、ListObjectsV2、
+// DeleteObjects和分片上传
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string]*fakeObject
+	uploads  map[string]map[int][]byte // uploadID -> 分片
+	requests []string                  // 按顺序记录的操作，如 "PUT key"
+	failPart int                       // 该编号的分片上传返回500，0表示不失败
+	server   *httptest.Server
+}
+
+func newFakeS3(t *testing.T) *fakeS3 {
+	t.Helper()
+	f := &fakeS3{
+		objects: make(map[string]*fakeObject),
+		uploads: make(map[string]map[int][]byte),
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// newTestClient 创建连接到fakeS3的客户端
+func newTestClient(t *testing.T, f *fakeS3, cfg config.S3Config) *Client {
+	t.Helper()
+	t.Setenv("AWS_ENDPOINT_URL_S3", f.server.URL)
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	cfg.Region = "us-east-1"
+	cfg.Bucket = testBucket
+	cfg.AccessKeyID = "AKIDEXAMPLE"
+	cfg.SecretAccessKey = "secret"
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	client, err := NewClient(&cfg, logger)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return client
+}
+
+// put 直接写入对象，用于准备测试数据
+func (f *fakeS3) put(key string, body []byte, meta map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	header := http.Header{}
+	for k, v := range meta {
+		header.Set("X-Amz-Meta-"+k, v)
+	}
+	f.objects[key] = &fakeObject{body: body, header: header}
+}
+
+// object 返回已完成上传的对象
+func (f *fakeS3) object(key string) *fakeObject {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj := f.objects[key]
+	if obj == nil || obj.partial {
+		return nil
+	}
+	return obj
+}
+
+// count 统计指定操作的次数，如 "PUT"、"COPY"、"UploadPart"
+func (f *fakeS3) count(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, req := range f.requests {
+		if strings.HasPrefix(req, op+" ") {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *fakeS3) record(op, key string) {
+	f.mu.Lock()
+	f.requests = append(f.requests, op+" "+key)
+	f.mu.Unlock()
+}
+
+func (f *fakeS3) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/"+testBucket)
+	key := strings.TrimPrefix(path, "/")
+	query := r.URL.Query()
+
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, query)
+	case key == "" && r.Method == http.MethodPost && query.Has("delete"):
+		f.deleteObjects(w, r)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.createMultipart(w, r, key)
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		f.uploadPart(w, r, query)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		f.completeMultipart(w, key, query)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		f.record("AbortMultipartUpload", key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		f.copyObject(w, r, key)
+	case r.Method == http.MethodPut:
+		f.putObject(w, r, key)
+	case r.Method == http.MethodHead:
+		f.headObject(w, key)
+	default:
+		http.Error(w, "unsupported request", http.StatusNotImplemented)
+	}
+}
+
+// objectHeader 提取需要保存的对象属性
+func objectHeader(r *http.Request) http.Header {
+	header := http.Header{}
+	for name, values := range r.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-meta-") || lower == "content-type" || lower == "cache-control" || lower == "x-amz-tagging" {
+			header[name] = values
+		}
+	}
+	return header
+}
+
+// readBody 读取请求体，按需解码aws-chunked编码
+func readBody(r *http.Request) ([]byte, error) {
+	if !strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") {
+		return io.ReadAll(r.Body)
+	}
+
+	var body bytes.Buffer
+	reader := bufio.NewReader(r.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chunk size %q", line)
+		}
+		if size == 0 {
+			return body.Bytes(), nil
+		}
+		if _, err := io.CopyN(&body, reader, size); err != nil {
+			return nil, err
+		}
+		if _, err := reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (f *fakeS3) putObject(w http.ResponseWriter, r *http.Request, key string) {
+	body, err := readBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.record("PUT", key)
+
+	f.mu.Lock()
+	f.objects[key] = &fakeObject{body: body, header: objectHeader(r)}
+	f.mu.Unlock()
+	w.Header().Set("ETag", `"etag"`)
+}
+
+func (f *fakeS3) headObject(w http.ResponseWriter, key string) {
+	f.record("HEAD", key)
+	obj := f.object(key)
+	if obj == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	for name, values := range obj.header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(obj.body)))
+}
+
+func (f *fakeS3) copyObject(w http.ResponseWriter, r *http.Request, key string) {
+	source, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sourceKey := strings.TrimPrefix(strings.TrimPrefix(source, "/"), testBucket+"/")
+	f.record("COPY", key)
+
+	src := f.object(sourceKey)
+	if src == nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+		return
+	}
+
+	header := objectHeader(r)
+	if r.Header.Get("X-Amz-Metadata-Directive") != "REPLACE" {
+		header = src.header.Clone()
+	} else if r.Header.Get("X-Amz-Tagging-Directive") != "REPLACE" {
+		header.Del("X-Amz-Tagging")
+		if tagging := src.header.Get("X-Amz-Tagging"); tagging != "" {
+			header.Set("X-Amz-Tagging", tagging)
+		}
+	}
+
+	f.mu.Lock()
+	f.objects[key] = &fakeObject{body: append([]byte(nil), src.body...), header: header}
+	f.mu.Unlock()
+	fmt.Fprint(w, `<CopyObjectResult><ETag>"etag"</ETag></CopyObjectResult>`)
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, query url.Values) {
+	f.record("LIST", query.Get("prefix"))
+
+	f.mu.Lock()
+	var keys []string
+	for key, obj := range f.objects {
+		if !obj.partial && strings.HasPrefix(key, query.Get("prefix")) && key > query.Get("start-after") {
+			keys = append(keys, key)
+		}
+	}
+	sizes := make(map[string]int, len(keys))
+	for _, key := range keys {
+		sizes[key] = len(f.objects[key].body)
+	}
+	f.mu.Unlock()
+	sort.Strings(keys)
+
+	// continuation-token 为上一页最后一个key
+	if token := query.Get("continuation-token"); token != "" {
+		i := sort.SearchStrings(keys, token)
+		if i < len(keys) && keys[i] == token {
+			i++
+		}
+		keys = keys[i:]
+	}
+	maxKeys := 1000
+	if value := query.Get("max-keys"); value != "" {
+		maxKeys, _ = strconv.Atoi(value)
+	}
+	truncated := len(keys) > maxKeys
+	if truncated {
+		keys = keys[:maxKeys]
+	}
+
+	var out bytes.Buffer
+	out.WriteString(`<ListBucketResult>`)
+	for _, key := range keys {
+		fmt.Fprintf(&out, `<Contents><Key>%s</Key><Size>%d</Size><LastModified>2026-01-02T03:04:05.000Z</LastModified><ETag>"etag"</ETag></Contents>`,
+			xmlEscape(key), sizes[key])
+	}
+	fmt.Fprintf(&out, `<KeyCount>%d</KeyCount><IsTruncated>%t</IsTruncated>`, len(keys), truncated)
+	if truncated {
+		fmt.Fprintf(&out, `<NextContinuationToken>%s</NextContinuationToken>`, xmlEscape(keys[len(keys)-1]))
+	}
+	out.WriteString(`</ListBucketResult>`)
+	w.Write(out.Bytes())
+}
+
+func (f *fakeS3) deleteObjects(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Objects []struct {
+			Key string `xml:"Key"`
+		} `xml:"Object"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	for _, obj := range input.Objects {
+		f.requests = append(f.requests, "DELETE "+obj.Key)
+		delete(f.objects, obj.Key)
+	}
+	f.mu.Unlock()
+	fmt.Fprint(w, `<DeleteResult></DeleteResult>`)
+}
+
+func (f *fakeS3) createMultipart(w http.ResponseWriter, r *http.Request, key string) {
+	f.record("CreateMultipartUpload", key)
+
+	f.mu.Lock()
+	uploadID := fmt.Sprintf("upload-%d", len(f.uploads)+1)
+	f.uploads[uploadID] = make(map[int][]byte)
+	f.objects[key] = &fakeObject{header: objectHeader(r), partial: true}
+	f.mu.Unlock()
+	fmt.Fprintf(w, `<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>`,
+		testBucket, xmlEscape(key), uploadID)
+}
+
+func (f *fakeS3) uploadPart(w http.ResponseWriter, r *http.Request, query url.Values) {
+	body, err := readBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	number, _ := strconv.Atoi(query.Get("partNumber"))
+	f.record("UploadPart", query.Get("uploadId"))
+
+	f.mu.Lock()
+	if number == f.failPart {
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `<Error><Code>InternalError</Code><Message>part failed</Message></Error>`)
+		return
+	}
+	parts, ok := f.uploads[query.Get("uploadId")]
+	if ok {
+		parts[number] = body
+	}
+	f.mu.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("ETag", fmt.Sprintf(`"part-%d"`, number))
+}
+
+func (f *fakeS3) completeMultipart(w http.ResponseWriter, key string, query url.Values) {
+	f.record("CompleteMultipartUpload", key)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts, ok := f.uploads[query.Get("uploadId")]
+	obj := f.objects[key]
+	if !ok || obj == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	numbers := make([]int, 0, len(parts))
+	for number := range parts {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	for _, number := range numbers {
+		obj.body = append(obj.body, parts[number]...)
+	}
+	obj.partial = false
+	delete(f.uploads, query.Get("uploadId"))
+	fmt.Fprintf(w, `<CompleteMultipartUploadResult><Key>%s</Key><ETag>"etag"</ETag></CompleteMultipartUploadResult>`, xmlEscape(key))
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
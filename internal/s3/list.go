@@ -0,0 +1,121 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ObjectInfo S3对象信息
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	ETag         string    `json:"etag,omitempty"`
+}
+
+// ListOptions 列举对象的参数，Prefix和StartAfter不含ImagePrefix
+type ListOptions struct {
+	Prefix            string
+	StartAfter        string
+	ContinuationToken string
+	MaxKeys           int32
+}
+
+// ListResult 一页列举结果
+type ListResult struct {
+	Objects               []ObjectInfo
+	NextContinuationToken string
+	IsTruncated           bool
+}
+
+// ListObjects 使用ListObjectsV2列举一页对象，返回的Key包含ImagePrefix
+func (c *Client) ListObjects(ctx context.Context, opts ListOptions) (*ListResult, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(c.config.Bucket),
+		Prefix: aws.String(c.fullKey(opts.Prefix)),
+	}
+	if opts.StartAfter != "" {
+		input.StartAfter = aws.String(c.fullKey(opts.StartAfter))
+	}
+	if opts.ContinuationToken != "" {
+		input.ContinuationToken = aws.String(opts.ContinuationToken)
+	}
+	if opts.MaxKeys > 0 {
+		input.MaxKeys = aws.Int32(opts.MaxKeys)
+	}
+
+	output, err := c.s3Client.ListObjectsV2(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	result := &ListResult{
+		Objects:     make([]ObjectInfo, 0, len(output.Contents)),
+		IsTruncated: aws.ToBool(output.IsTruncated),
+	}
+	if output.NextContinuationToken != nil {
+		result.NextContinuationToken = *output.NextContinuationToken
+	}
+	for _, obj := range output.Contents {
+		result.Objects = append(result.Objects, ObjectInfo{
+			Key:          aws.ToString(obj.Key),
+			Size:         aws.ToInt64(obj.Size),
+			LastModified: aws.ToTime(obj.LastModified),
+			ETag:         strings.Trim(aws.ToString(obj.ETag), `"`),
+		})
+	}
+
+	return result, nil
+}
+
+// ListAll 列举前缀下的所有对象，StartAfter之后、直到key超过stopAfter为止（stopAfter为空表示不限制）
+func (c *Client) ListAll(ctx context.Context, prefix, startAfter, stopAfter string) ([]ObjectInfo, error) {
+	fullStop := ""
+	if stopAfter != "" {
+		fullStop = c.fullKey(stopAfter)
+	}
+
+	var objects []ObjectInfo
+	opts := ListOptions{Prefix: prefix, StartAfter: startAfter}
+	for {
+		page, err := c.ListObjects(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range page.Objects {
+			if fullStop != "" && obj.Key > fullStop {
+				return objects, nil
+			}
+			objects = append(objects, obj)
+		}
+
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, nil
+		}
+		opts.ContinuationToken = page.NextContinuationToken
+	}
+}
+
+// fullKey 拼接ImagePrefix，保留前缀末尾的分隔符
+func (c *Client) fullKey(key string) string {
+	full := path.Join(c.config.ImagePrefix, key)
+	if strings.HasSuffix(key, "/") && !strings.HasSuffix(full, "/") {
+		full += "/"
+	}
+	return full
+}
+
+// StripPrefix 去掉key中的ImagePrefix
+func (c *Client) StripPrefix(fullKey string) string {
+	if c.config.ImagePrefix == "" {
+		return fullKey
+	}
+	return strings.TrimPrefix(fullKey, strings.TrimSuffix(c.config.ImagePrefix, "/")+"/")
+}
@@ -0,0 +1,115 @@
+package s3
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"makeprofit/internal/config"
+)
+
+func TestListObjectsPages(t *testing.T) {
+	fake := newFakeS3(t)
+	for _, key := range []string{
+		"screenshot/screenshots/NVDA_us_1d_20260101.png",
+		"screenshot/screenshots/NVDA_us_1d_20260102.png",
+		"screenshot/screenshots/NVDA_us_1d_20260103.png",
+		"screenshot/screenshots/NVDA_us_1h_20260103_10.png",
+		"screenshot/screenshots/NVDAX_us_1d_20260101.png",
+	} {
+		fake.put(key, []byte("png"), nil)
+	}
+	client := newTestClient(t, fake, config.S3Config{ImagePrefix: "screenshot"})
+
+	var keys []string
+	opts := ListOptions{Prefix: "screenshots/NVDA_us_1d_", MaxKeys: 2}
+	for pages := 1; ; pages++ {
+		page, err := client.ListObjects(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("ListObjects() error = %v", err)
+		}
+		for _, obj := range page.Objects {
+			keys = append(keys, client.StripPrefix(obj.Key))
+			if obj.Size != 3 || obj.ETag != "etag" || obj.LastModified.IsZero() {
+				t.Errorf("object %s = %+v", obj.Key, obj)
+			}
+		}
+		if !page.IsTruncated {
+			if pages != 2 {
+				t.Errorf("listed %d pages, want 2", pages)
+			}
+			break
+		}
+		opts.ContinuationToken = page.NextContinuationToken
+	}
+
+	want := "screenshots/NVDA_us_1d_20260101.png,screenshots/NVDA_us_1d_20260102.png,screenshots/NVDA_us_1d_20260103.png"
+	if got := strings.Join(keys, ","); got != want {
+		t.Errorf("listed keys = %s, want %s", got, want)
+	}
+}
+
+func TestListAllRange(t *testing.T) {
+	fake := newFakeS3(t)
+	for _, key := range []string{
+		"screenshot/data/NVDA_us_1d_20260101.json",
+		"screenshot/data/NVDA_us_1d_20260102.json",
+		"screenshot/data/NVDA_us_1d_20260103.json",
+		"screenshot/data/NVDA_us_1d_20260104.json",
+	} {
+		fake.put(key, []byte("{}"), nil)
+	}
+	client := newTestClient(t, fake, config.S3Config{ImagePrefix: "screenshot"})
+
+	tests := []struct {
+		name       string
+		startAfter string
+		stopAfter  string
+		want       []string
+	}{
+		{name: "all", want: []string{"20260101", "20260102", "20260103", "20260104"}},
+		// 与 handleArtifacts 一致：从第一张图片的文件名之后开始，到最后一张图片的 .json 为止
+		{
+			name:       "range of a page",
+			startAfter: "data/NVDA_us_1d_20260102",
+			stopAfter:  "data/NVDA_us_1d_20260103.json",
+			want:       []string{"20260102", "20260103"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, err := client.ListAll(context.Background(), "data/NVDA_us_1d_", tt.startAfter, tt.stopAfter)
+			if err != nil {
+				t.Fatalf("ListAll() error = %v", err)
+			}
+			var got []string
+			for _, obj := range objects {
+				got = append(got, strings.TrimSuffix(strings.TrimPrefix(obj.Key, "screenshot/data/NVDA_us_1d_"), ".json"))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ListAll() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFullKeyAndStripPrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		key    string
+		full   string
+	}{
+		{prefix: "screenshot", key: "screenshots/", full: "screenshot/screenshots/"},
+		{prefix: "screenshot/", key: "data/NVDA.json", full: "screenshot/data/NVDA.json"},
+		{prefix: "", key: "screenshots/NVDA.png", full: "screenshots/NVDA.png"},
+	}
+	for _, tt := range tests {
+		client := &Client{config: &config.S3Config{ImagePrefix: tt.prefix}}
+		if got := client.fullKey(tt.key); got != tt.full {
+			t.Errorf("fullKey(%q) with prefix %q = %q, want %q", tt.key, tt.prefix, got, tt.full)
+		}
+		if got := client.StripPrefix(tt.full); got != tt.key {
+			t.Errorf("StripPrefix(%q) with prefix %q = %q, want %q", tt.full, tt.prefix, got, tt.key)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+
+	"makeprofit/internal/config"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// 上传校验算法
+const (
+	ChecksumCRC32C = "crc32c"
+	ChecksumSHA256 = "sha256"
+)
+
+// newUploader 创建分片上传器，小于分片大小的对象仍使用单次PutObject
+func newUploader(client *s3.Client, cfg *config.MultipartConfig) (*manager.Uploader, error) {
+	if cfg.PartSize != 0 && cfg.PartSize < manager.MinUploadPartSize {
+		return nil, fmt.Errorf("s3.multipart.part_size must be at least %d bytes", manager.MinUploadPartSize)
+	}
+	if _, err := checksumAlgorithm(cfg.Checksum); err != nil {
+		return nil, err
+	}
+
+	return manager.NewUploader(client, func(u *manager.Uploader) {
+		if cfg.PartSize > 0 {
+			u.PartSize = cfg.PartSize
+		}
+		if cfg.Concurrency > 0 {
+			u.Concurrency = cfg.Concurrency
+		}
+		// 上传失败时中止分片上传，避免残留未完成的分片产生存储费用
+		u.LeavePartsOnError = false
+		if cfg.MaxAttempts > 0 {
+			u.ClientOptions = append(u.ClientOptions, func(o *s3.Options) {
+				o.RetryMaxAttempts = cfg.MaxAttempts
+			})
+		}
+	}), nil
+}
+
+// checksumAlgorithm 解析配置的校验算法
+func checksumAlgorithm(name string) (types.ChecksumAlgorithm, error) {
+	switch name {
+	case "":
+		return "", nil
+	case ChecksumCRC32C:
+		return types.ChecksumAlgorithmCrc32c, nil
+	case ChecksumSHA256:
+		return types.ChecksumAlgorithmSha256, nil
+	default:
+		return "", fmt.Errorf("unknown s3.multipart.checksum %q", name)
+	}
+}
+
+// putObject 通过分片上传器上传对象，S3按配置的校验算法校验每个分片
+func (c *Client) putObject(ctx context.Context, input *s3.PutObjectInput) error {
+	uploadCtx, cancel := context.WithTimeout(ctx, c.uploadTimeout)
+	defer cancel()
+
+	if c.checksum != "" {
+		input.ChecksumAlgorithm = c.checksum
+	}
+
+	_, err := c.uploader.Upload(uploadCtx, input)
+	return err
+}
@@ -0,0 +1,123 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"makeprofit/internal/config"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func TestChecksumAlgorithm(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    types.ChecksumAlgorithm
+		wantErr bool
+	}{
+		{name: "", want: ""},
+		{name: ChecksumCRC32C, want: types.ChecksumAlgorithmCrc32c},
+		{name: ChecksumSHA256, want: types.ChecksumAlgorithmSha256},
+		{name: "md5", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := checksumAlgorithm(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("checksumAlgorithm(%q) = %q, %v; want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestNewUploaderRejectsSmallParts(t *testing.T) {
+	_, err := newUploader(nil, &config.MultipartConfig{PartSize: 1 << 20})
+	if err == nil || !strings.Contains(err.Error(), "s3.multipart.part_size must be at least") {
+		t.Errorf("newUploader() error = %v", err)
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	// 11MiB，按5MiB分片为3片
+	data := bytes.Repeat([]byte("0123456789abcdef"), (11<<20)/16)
+
+	tests := []struct {
+		name      string
+		reader    func() io.Reader
+		checksum  string
+		wantParts int
+	}{
+		{name: "known size", reader: func() io.Reader { return bytes.NewReader(data) }, checksum: ChecksumCRC32C, wantParts: 3},
+		{name: "unknown size", reader: func() io.Reader { return io.MultiReader(bytes.NewReader(data)) }, checksum: ChecksumSHA256, wantParts: 3},
+		// 小于分片大小时使用单次PutObject
+		{name: "single part", reader: func() io.Reader { return bytes.NewReader(data[:1024]) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			client := newTestClient(t, fake, config.S3Config{Multipart: config.MultipartConfig{
+				PartSize:    manager.MinUploadPartSize,
+				Concurrency: 2,
+				Checksum:    tt.checksum,
+			}})
+
+			result, err := client.UploadReader(context.Background(), tt.reader(), "screenshots/large.png", "image/png", nil)
+			if err != nil {
+				t.Fatalf("UploadReader() error = %v", err)
+			}
+
+			if got := fake.count("UploadPart"); got != tt.wantParts {
+				t.Errorf("uploaded %d parts, want %d", got, tt.wantParts)
+			}
+			if tt.wantParts > 0 && fake.count("CompleteMultipartUpload") != 1 {
+				t.Error("multipart upload was not completed")
+			}
+			if tt.wantParts == 0 && fake.count("PUT") != 1 {
+				t.Errorf("small object sent %d PutObject requests, want 1", fake.count("PUT"))
+			}
+
+			obj := fake.object(result.Key)
+			if obj == nil {
+				t.Fatalf("object %s was not uploaded", result.Key)
+			}
+			want := data
+			if tt.wantParts == 0 {
+				want = data[:1024]
+			}
+			if !bytes.Equal(obj.body, want) || result.Size != int64(len(want)) {
+				t.Errorf("uploaded %d bytes (result size %d), want %d", len(obj.body), result.Size, len(want))
+			}
+			if obj.header.Get("Content-Type") != "image/png" {
+				t.Errorf("Content-Type = %q", obj.header.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestMultipartUploadAbortsOnFailure(t *testing.T) {
+	fake := newFakeS3(t)
+	fake.failPart = 2
+	client := newTestClient(t, fake, config.S3Config{Multipart: config.MultipartConfig{
+		PartSize:    manager.MinUploadPartSize,
+		Concurrency: 1,
+		MaxAttempts: 1,
+	}})
+
+	data := bytes.Repeat([]byte("x"), 11<<20)
+	if _, err := client.UploadReader(context.Background(), bytes.NewReader(data), "screenshots/large.png", "image/png", nil); err == nil {
+		t.Fatal("UploadReader() error = nil, want part failure")
+	}
+
+	// 失败的分片不重试，上传被中止，不留下未完成的分片
+	if got := fake.count("UploadPart"); got > 3 {
+		t.Errorf("uploaded %d parts, want no retries", got)
+	}
+	if fake.count("AbortMultipartUpload") != 1 || fake.count("CompleteMultipartUpload") != 0 {
+		t.Errorf("requests after failure: abort %d, complete %d", fake.count("AbortMultipartUpload"), fake.count("CompleteMultipartUpload"))
+	}
+	if fake.object("screenshots/large.png") != nil {
+		t.Error("failed upload left a visible object")
+	}
+}
@@ -0,0 +1,119 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"makeprofit/internal/config"
+)
+
+func TestUploadOptionsTagging(t *testing.T) {
+	tests := []struct {
+		tags map[string]string
+		want string
+	}{
+		{tags: nil, want: ""},
+		{tags: map[string]string{"timeframe": "1d", "kind": "screenshot"}, want: "kind=screenshot&timeframe=1d"},
+		{tags: map[string]string{"team": "charts & data", "market": "us"}, want: "market=us&team=charts+%26+data"},
+	}
+	for _, tt := range tests {
+		opts := &UploadOptions{Tags: tt.tags}
+		if got := opts.tagging(); got != tt.want {
+			t.Errorf("tagging(%v) = %q, want %q", tt.tags, got, tt.want)
+		}
+	}
+}
+
+func TestUploadWithOptions(t *testing.T) {
+	opts := &UploadOptions{
+		CacheControl: "public, max-age=600",
+		Metadata:     map[string]string{"Symbol": "NVDA", "timeframe": "1d"},
+		Tags:         map[string]string{"kind": "screenshot", "market": "us"},
+	}
+
+	t.Run("put", func(t *testing.T) {
+		fake := newFakeS3(t)
+		client := newTestClient(t, fake, config.S3Config{})
+
+		result, err := client.UploadReader(context.Background(), bytes.NewReader([]byte("png")), "screenshots/NVDA_us_1d.png", "image/png", opts)
+		if err != nil {
+			t.Fatalf("UploadReader() error = %v", err)
+		}
+		obj := fake.object(result.Key)
+		if obj == nil {
+			t.Fatalf("object %s was not uploaded", result.Key)
+		}
+		if got := obj.header.Get("Cache-Control"); got != "public, max-age=600" {
+			t.Errorf("Cache-Control = %q", got)
+		}
+		if obj.header.Get("X-Amz-Meta-Symbol") != "NVDA" || obj.header.Get("X-Amz-Meta-Timeframe") != "1d" {
+			t.Errorf("metadata = %v", obj.header)
+		}
+		if got := obj.header.Get("X-Amz-Tagging"); got != "kind=screenshot&market=us" {
+			t.Errorf("tagging = %q", got)
+		}
+	})
+
+	// 内容寻址：内容对象使用不可变缓存策略，别名使用配置的缓存策略，两者都带标签
+	t.Run("content addressed", func(t *testing.T) {
+		fake := newFakeS3(t)
+		client := newTestClient(t, fake, config.S3Config{ContentAddressed: true})
+
+		result, err := client.UploadDeduplicated(context.Background(), bytes.NewReader([]byte("png")), "screenshots/NVDA_us_1d.png", "image/png", opts)
+		if err != nil {
+			t.Fatalf("UploadDeduplicated() error = %v", err)
+		}
+		content, alias := fake.object(result.ContentKey), fake.object(result.Key)
+		if content == nil || alias == nil {
+			t.Fatalf("content %v, alias %v", content != nil, alias != nil)
+		}
+		if got := content.header.Get("Cache-Control"); got != ImmutableCacheControl {
+			t.Errorf("content Cache-Control = %q", got)
+		}
+		if got := alias.header.Get("Cache-Control"); got != "public, max-age=600" {
+			t.Errorf("alias Cache-Control = %q", got)
+		}
+		for name, obj := range map[string]*fakeObject{"content": content, "alias": alias} {
+			if obj.header.Get("X-Amz-Tagging") != "kind=screenshot&market=us" || obj.header.Get("X-Amz-Meta-Symbol") != "NVDA" {
+				t.Errorf("%s header = %v", name, obj.header)
+			}
+		}
+		// 别名替换元数据后仍记录内容哈希
+		if alias.header.Get("X-Amz-Meta-Sha256") != result.SHA256 {
+			t.Errorf("alias sha256 metadata = %q, want %s", alias.header.Get("X-Amz-Meta-Sha256"), result.SHA256)
+		}
+	})
+}
+
+func TestUploadCheckExisting(t *testing.T) {
+	fake := newFakeS3(t)
+	client := newTestClient(t, fake, config.S3Config{})
+	opts := &UploadOptions{CheckExisting: true}
+
+	upload := func() *UploadResult {
+		t.Helper()
+		result, err := client.UploadReader(context.Background(), bytes.NewReader([]byte("png")), "screenshots/NVDA_us_1d.png", "image/png", opts)
+		if err != nil {
+			t.Fatalf("UploadReader() error = %v", err)
+		}
+		return result
+	}
+
+	// 首次写入的key不需要清除CDN缓存，覆盖时需要
+	if upload().Replaced {
+		t.Error("first upload replaced = true")
+	}
+	if !upload().Replaced {
+		t.Error("second upload replaced = false")
+	}
+
+	// 未要求检查时不发送HEAD请求
+	heads := fake.count("HEAD")
+	if _, err := client.UploadReader(context.Background(), bytes.NewReader([]byte("png")), "screenshots/NVDA_us_1d.png", "image/png", nil); err != nil {
+		t.Fatalf("UploadReader() error = %v", err)
+	}
+	if fake.count("HEAD") != heads {
+		t.Error("upload without CheckExisting sent a HEAD request")
+	}
+}
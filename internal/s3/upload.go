@@ -2,6 +2,8 @@ package s3
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
@@ -18,7 +20,40 @@ type UploadResult struct {
 	URL      string    `json:"url"`
 	Key      string    `json:"key"`
 	Size     int64     `json:"size"`
+	SHA256   string    `json:"sha256"`
 	Uploaded time.Time `json:"uploaded"`
+
+	// 内容寻址上传时的不可变key，以及别名是否已指向相同内容（未发生写入）
+	ContentKey string `json:"content_key,omitempty"`
+	Unchanged  bool   `json:"unchanged,omitempty"`
+
+	// 是否覆盖了已存在的对象，内容寻址上传或设置了 UploadOptions.CheckExisting 时可知
+	Replaced bool `json:"replaced,omitempty"`
+}
+
+// hashingBody 计算上传内容的SHA-256
+// 可Seek的内容先完整读取计算再回到原位置，不可Seek的内容在上传过程中边读边算
+func hashingBody(body io.Reader) (io.Reader, func() string, error) {
+	hasher := sha256.New()
+	sum := func() string { return hex.EncodeToString(hasher.Sum(nil)) }
+
+	seeker, ok := body.(io.ReadSeeker)
+	if !ok {
+		return io.TeeReader(body, hasher), sum, nil
+	}
+
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to seek upload content: %w", err)
+	}
+	if _, err := io.Copy(hasher, seeker); err != nil {
+		return nil, nil, fmt.Errorf("failed to hash upload content: %w", err)
+	}
+	if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+		return nil, nil, fmt.Errorf("failed to seek upload content: %w", err)
+	}
+	digest := sum()
+	return seeker, func() string { return digest }, nil
 }
 
 // UploadFile 上传文件到S3
@@ -56,22 +91,23 @@ func (c *Client) UploadFile(ctx context.Context, localPath, s3Key string) (*Uplo
 		contentType = "image/svg+xml"
 	}
 
-	// 创建带超时的上下文
-	uploadCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
-	defer cancel()
+	body, sum, err := hashingBody(file)
+	if err != nil {
+		return nil, err
+	}
 
-	// 上传文件到S3
-	_, err = c.s3Client.PutObject(uploadCtx, &s3.PutObjectInput{
+	// 上传文件到S3，大文件自动分片
+	err = c.putObject(ctx, &s3.PutObjectInput{
 		Bucket:      aws.String(c.config.Bucket),
 		Key:         aws.String(fullKey),
-		Body:        file,
+		Body:        body,
 		ContentType: aws.String(contentType),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to upload file to S3: %w", err)
 	}
 
-	c.logger.WithFields(logrus.Fields{
+	c.log(ctx).WithFields(logrus.Fields{
 		"local_path":   localPath,
 		"s3_key":       fullKey,
 		"size":         fileInfo.Size(),
@@ -86,82 +122,116 @@ func (c *Client) UploadFile(ctx context.Context, localPath, s3Key string) (*Uplo
 		URL:      s3URL,
 		Key:      fullKey,
 		Size:     fileInfo.Size(),
+		SHA256:   sum(),
 		Uploaded: time.Now(),
 	}, nil
 }
 
-// UploadScreenshot 上传截图文件
-func (c *Client) UploadScreenshot(ctx context.Context, localPath, symbol, market, timeframe string) (*UploadResult, error) {
-	// 根据时间框架生成文件名
-	var s3Key string
+// ScreenshotKey 根据时间框架生成截图的S3 key（不含ImagePrefix）
+func ScreenshotKey(symbol, market, timeframe string) string {
 	now := time.Now()
 
 	switch timeframe {
 	case "1d":
 		// 日线：同一天内一支股票只有一张，格式：{symbol}_{market}_1d_{date}.png
-		s3Key = fmt.Sprintf("screenshots/%s_%s_1d_%s.png", symbol, market, now.Format("20060102"))
+		return fmt.Sprintf("screenshots/%s_%s_1d_%s.png", symbol, market, now.Format("20060102"))
 	case "1h":
 		// 小时线：根据市场开市时间生成，格式：{symbol}_{market}_1h_{date}_{hour}.png
-		s3Key = fmt.Sprintf("screenshots/%s_%s_1h_%s_%02d.png", symbol, market, now.Format("20060102"), now.Hour())
+		return fmt.Sprintf("screenshots/%s_%s_1h_%s_%02d.png", symbol, market, now.Format("20060102"), now.Hour())
 	case "1wk":
 		// 周线：同一周内一支股票只有一张，格式：{symbol}_{market}_1wk_{year}_{week}.png
 		year, week := now.ISOWeek()
-		s3Key = fmt.Sprintf("screenshots/%s_%s_1wk_%d_%02d.png", symbol, market, year, week)
+		return fmt.Sprintf("screenshots/%s_%s_1wk_%d_%02d.png", symbol, market, year, week)
 	default:
 		// 其他时间框架使用时间戳（保持向后兼容）
 		timestamp := now.Format("20060102_150405")
-		s3Key = fmt.Sprintf("screenshots/%s_%s_%s_%s.png", symbol, market, timeframe, timestamp)
+		return fmt.Sprintf("screenshots/%s_%s_%s_%s.png", symbol, market, timeframe, timestamp)
 	}
-
-	return c.UploadFile(ctx, localPath, s3Key)
 }
 
-// UploadJSONData 上传JSON数据文件
-func (c *Client) UploadJSONData(ctx context.Context, localPath, symbol, market, timeframe string) (*UploadResult, error) {
-	// 根据时间框架生成文件名
-	var s3Key string
+// JSONDataKey 根据时间框架生成JSON数据的S3 key（不含ImagePrefix）
+func JSONDataKey(symbol, market, timeframe string) string {
 	now := time.Now()
 
 	switch timeframe {
 	case "1d":
 		// 日线：同一天内一支股票只有一张，格式：{symbol}_{market}_1d_{date}.json
-		s3Key = fmt.Sprintf("data/%s_%s_1d_%s.json", symbol, market, now.Format("20060102"))
+		return fmt.Sprintf("data/%s_%s_1d_%s.json", symbol, market, now.Format("20060102"))
 	case "1h":
 		// 小时线：根据市场开市时间生成，格式：{symbol}_{market}_1h_{date}_{hour}.json
-		s3Key = fmt.Sprintf("data/%s_%s_1h_%s_%02d.json", symbol, market, now.Format("20060102"), now.Hour())
+		return fmt.Sprintf("data/%s_%s_1h_%s_%02d.json", symbol, market, now.Format("20060102"), now.Hour())
 	case "1wk":
 		// 周线：同一周内一支股票只有一张，格式：{symbol}_{market}_1wk_{year}_{week}.json
 		year, week := now.ISOWeek()
-		s3Key = fmt.Sprintf("data/%s_%s_1wk_%d_%02d.json", symbol, market, year, week)
+		return fmt.Sprintf("data/%s_%s_1wk_%d_%02d.json", symbol, market, year, week)
 	default:
 		// 其他时间框架使用时间戳（保持向后兼容）
 		timestamp := now.Format("20060102_150405")
-		s3Key = fmt.Sprintf("data/%s_%s_%s_%s.json", symbol, market, timeframe, timestamp)
+		return fmt.Sprintf("data/%s_%s_%s_%s.json", symbol, market, timeframe, timestamp)
 	}
+}
 
-	return c.UploadFile(ctx, localPath, s3Key)
+// UploadScreenshot 上传截图文件
+func (c *Client) UploadScreenshot(ctx context.Context, localPath, symbol, market, timeframe string) (*UploadResult, error) {
+	return c.UploadFile(ctx, localPath, ScreenshotKey(symbol, market, timeframe))
 }
 
-// UploadReader 上传Reader内容到S3
-func (c *Client) UploadReader(ctx context.Context, reader io.Reader, s3Key, contentType string) (*UploadResult, error) {
+// UploadJSONData 上传JSON数据文件
+func (c *Client) UploadJSONData(ctx context.Context, localPath, symbol, market, timeframe string) (*UploadResult, error) {
+	return c.UploadFile(ctx, localPath, JSONDataKey(symbol, market, timeframe))
+}
+
+// UploadStream 将流式内容直接上传到S3，size为-1表示长度未知
+// 长度未知时按分片大小逐段缓冲上传，不需要把整个内容读入内存
+func (c *Client) UploadStream(ctx context.Context, body io.Reader, size int64, s3Key, contentType string, opts *UploadOptions) (*UploadResult, error) {
+	body, sum, err := hashingBody(body)
+	if err != nil {
+		return nil, err
+	}
+	counter := &countingReader{reader: body}
+
 	// 构建完整的S3 key
 	fullKey := filepath.Join(c.config.ImagePrefix, s3Key)
 
-	// 上传内容到S3
-	_, err := c.s3Client.PutObject(ctx, &s3.PutObjectInput{
+	input := &s3.PutObjectInput{
 		Bucket:      aws.String(c.config.Bucket),
 		Key:         aws.String(fullKey),
-		Body:        reader,
+		Body:        counter,
 		ContentType: aws.String(contentType),
-	})
+	}
+	if size >= 0 {
+		input.ContentLength = aws.Int64(size)
+	}
+	// 可Seek的内容在上传前已算出哈希，可以写入元数据
+	if _, seekable := body.(io.Seeker); seekable {
+		input.Body = body
+		input.Metadata = map[string]string{metaSHA256: sum()}
+	}
+	opts.applyPut(input)
+
+	replaced := false
+	if opts != nil && opts.CheckExisting {
+		meta, err := c.headMetadata(ctx, fullKey)
+		if err != nil {
+			// 无法确定时按已存在处理，宁可多清除一次缓存
+			c.log(ctx).WithError(err).WithField("s3_key", fullKey).Warn("Failed to check existing object")
+		}
+		replaced = err != nil || meta != nil
+	}
+
+	err = c.putObject(ctx, input)
 	if err != nil {
-		return nil, fmt.Errorf("failed to upload content to S3: %w", err)
+		return nil, fmt.Errorf("failed to upload stream to S3: %w", err)
+	}
+	if size < 0 {
+		size = counter.n
 	}
 
-	c.logger.WithFields(logrus.Fields{
+	c.log(ctx).WithFields(logrus.Fields{
 		"s3_key":       fullKey,
+		"size":         size,
 		"content_type": contentType,
-	}).Info("Content uploaded to S3 successfully")
+	}).Info("Stream uploaded to S3 successfully")
 
 	// 构建S3 URL
 	s3URL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s",
@@ -170,7 +240,50 @@ func (c *Client) UploadReader(ctx context.Context, reader io.Reader, s3Key, cont
 	return &UploadResult{
 		URL:      s3URL,
 		Key:      fullKey,
-		Size:     0, // 无法确定大小
+		Size:     size,
+		SHA256:   sum(),
 		Uploaded: time.Now(),
+		Replaced: replaced,
 	}, nil
 }
+
+// countingReader 统计长度未知的内容实际上传的字节数
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// UploadReader 上传Reader内容到S3
+// 能确定长度的Reader（如bytes.Reader、文件）会设置ContentLength
+func (c *Client) UploadReader(ctx context.Context, reader io.Reader, s3Key, contentType string, opts *UploadOptions) (*UploadResult, error) {
+	return c.UploadStream(ctx, reader, readerSize(reader), s3Key, contentType, opts)
+}
+
+// readerSize 获取Reader剩余内容的长度，无法确定时返回-1
+func readerSize(reader io.Reader) int64 {
+	switch r := reader.(type) {
+	case interface{ Len() int }:
+		return int64(r.Len())
+	case io.Seeker:
+		current, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		end, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return -1
+		}
+		if _, err := r.Seek(current, io.SeekStart); err != nil {
+			return -1
+		}
+		return end - current
+	default:
+		return -1
+	}
+}
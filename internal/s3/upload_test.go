@@ -0,0 +1,88 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"makeprofit/internal/config"
+)
+
+func TestReaderSize(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "chart.png"))
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString("0123456789"); err != nil {
+		t.Fatalf("WriteString() error = %v", err)
+	}
+	// 从文件中间开始上传时只计算剩余部分
+	if _, err := file.Seek(4, io.SeekStart); err != nil {
+		t.Fatalf("Seek() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		reader io.Reader
+		want   int64
+	}{
+		{name: "bytes reader", reader: bytes.NewReader([]byte("hello")), want: 5},
+		{name: "bytes buffer", reader: bytes.NewBufferString("hello!"), want: 6},
+		{name: "file", reader: file, want: 6},
+		{name: "unknown", reader: io.MultiReader(strings.NewReader("hello")), want: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readerSize(tt.reader); got != tt.want {
+				t.Errorf("readerSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// 计算长度后保持原读取位置
+	rest, err := io.ReadAll(file)
+	if err != nil || string(rest) != "456789" {
+		t.Errorf("file position moved, read %q, %v", rest, err)
+	}
+}
+
+func TestUploadReader(t *testing.T) {
+	tests := []struct {
+		name     string
+		reader   io.Reader
+		wantSize int64
+	}{
+		{name: "known size", reader: bytes.NewReader([]byte(`{"close":[1,2,3]}`)), wantSize: 17},
+		{name: "unknown size", reader: io.MultiReader(strings.NewReader(`{"close":`), strings.NewReader(`[1,2,3]}`)), wantSize: 17},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeS3(t)
+			client := newTestClient(t, fake, config.S3Config{ImagePrefix: "screenshot"})
+
+			result, err := client.UploadReader(context.Background(), tt.reader, "data/NVDA_us_1d_20260102.json", "application/json", nil)
+			if err != nil {
+				t.Fatalf("UploadReader() error = %v", err)
+			}
+
+			if result.Key != "screenshot/data/NVDA_us_1d_20260102.json" || result.Size != tt.wantSize {
+				t.Errorf("UploadReader() = key %s size %d, want size %d", result.Key, result.Size, tt.wantSize)
+			}
+			obj := fake.object(result.Key)
+			if obj == nil {
+				t.Fatalf("object %s was not uploaded", result.Key)
+			}
+			if string(obj.body) != `{"close":[1,2,3]}` {
+				t.Errorf("uploaded body = %q", obj.body)
+			}
+			if got := obj.header.Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package screenshot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"makeprofit/internal/apierror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// retentionRunTimeout 手动触发的清理最长执行时间
+const retentionRunTimeout = 30 * time.Minute
+
+// handleRetentionRun POST /api/v1/admin/retention/run?dry_run=true
+// 手动触发一次保留策略清理，未指定dry_run时使用配置中的默认值
+func (s *Service) handleRetentionRun(c *gin.Context) {
+	if s.retention == nil {
+		apierror.Abort(c, apierror.New(apierror.CodeNotFound, "Retention is not enabled"))
+		return
+	}
+
+	dryRun := s.retention.DryRunDefault()
+	if value := c.Query("dry_run"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			apierror.Abort(c, apierror.New(apierror.CodeInvalidRequest, fmt.Sprintf("Invalid dry_run: %s", value)))
+			return
+		}
+		dryRun = parsed
+	}
+
+	// 清理不随客户端断开或写超时取消，避免在删除对象后、同步历史索引前中止
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), retentionRunTimeout)
+	defer cancel()
+
+	report, err := s.retention.Run(ctx, dryRun)
+	if err != nil {
+		s.log(c.Request.Context()).WithError(err).Error("Retention run failed")
+		apierror.Abort(c, apierror.Wrap(apierror.CodeInternal, "Retention run failed", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"message":   "Retention run completed",
+		"report":    report,
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
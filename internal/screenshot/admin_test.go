@@ -0,0 +1,76 @@
+package screenshot
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"makeprofit/internal/config"
+	"makeprofit/internal/retention"
+	"makeprofit/internal/s3"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// retentionStorage 记录删除对象时上下文是否已取消
+type retentionStorage struct {
+	objects     []s3.ObjectInfo
+	deleted     []string
+	canceledErr error
+}
+
+func (f *retentionStorage) ListAll(_ context.Context, prefix, _, _ string) ([]s3.ObjectInfo, error) {
+	var result []s3.ObjectInfo
+	for _, obj := range f.objects {
+		if strings.HasPrefix(obj.Key, prefix) {
+			result = append(result, obj)
+		}
+	}
+	return result, nil
+}
+
+func (f *retentionStorage) DeleteObjects(ctx context.Context, keys []string) error {
+	f.canceledErr = ctx.Err()
+	f.deleted = append(f.deleted, keys...)
+	return nil
+}
+
+func (f *retentionStorage) AliasContentKey(context.Context, string) (string, error) {
+	return "", nil
+}
+
+func TestHandleRetentionRunOutlivesRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	storage := &retentionStorage{objects: []s3.ObjectInfo{
+		{Key: "screenshots/NVDA_us_1h_20250729_10.png", LastModified: time.Now().Add(-48 * time.Hour)},
+	}}
+	manager, err := retention.NewManager(&config.RetentionConfig{Rules: map[string]time.Duration{"1h": time.Hour}}, storage, nil, logger)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	s := &Service{retention: manager, logger: logger}
+
+	// 客户端在清理完成前已经断开
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/admin/retention/run?dry_run=false", nil).WithContext(ctx)
+
+	s.handleRetentionRun(c)
+
+	if len(storage.deleted) != 1 {
+		t.Fatalf("deleted = %v, want the expired screenshot", storage.deleted)
+	}
+	if storage.canceledErr != nil {
+		t.Errorf("DeleteObjects() ran with a canceled context: %v", storage.canceledErr)
+	}
+}
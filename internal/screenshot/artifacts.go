@@ -0,0 +1,216 @@
+package screenshot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"makeprofit/internal/apierror"
+	"makeprofit/internal/auth"
+	"makeprofit/internal/s3"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultArtifactsLimit = 50
+	maxArtifactsLimit     = 1000
+
+	// artifactVersionWorkers 并发读取对象哈希元数据的数量
+	artifactVersionWorkers = 8
+)
+
+// ArtifactObject 存储中的单个对象
+type ArtifactObject struct {
+	Key          string    `json:"key"`
+	CDNURL       string    `json:"cdn_url"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// Artifact 同一次截图的图片与JSON数据
+type Artifact struct {
+	Name      string          `json:"name"`
+	Timeframe string          `json:"timeframe"`
+	Image     *ArtifactObject `json:"image,omitempty"`
+	Data      *ArtifactObject `json:"data,omitempty"`
+}
+
+// ArtifactsResponse 存储列举响应
+type ArtifactsResponse struct {
+	Success   bool       `json:"success"`
+	Message   string     `json:"message"`
+	Symbol    string     `json:"symbol,omitempty"`
+	Market    string     `json:"market,omitempty"`
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+	NextToken string     `json:"next_token,omitempty"` // 传入continuation_token获取下一页
+	Timestamp string     `json:"timestamp"`
+}
+
+// handleArtifacts GET /api/v1/artifacts/:market/:symbol?timeframe=1d&limit=50&continuation_token=...
+// 按截图分页列举存储中的对象，并把同名的JSON数据与图片配对
+func (s *Service) handleArtifacts(c *gin.Context) {
+	market := c.Param("market")
+	symbol := c.Param("symbol")
+	timeframe := c.Query("timeframe")
+
+	if !auth.MarketAllowed(c, market) {
+		apierror.Abort(c, marketForbidden(market))
+		return
+	}
+
+	limit := defaultArtifactsLimit
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			apierror.Abort(c, apierror.New(apierror.CodeInvalidRequest, fmt.Sprintf("Invalid limit: %s", value)))
+			return
+		}
+		limit = min(n, maxArtifactsLimit)
+	}
+
+	// 文件名前缀：{symbol}_{market}_[{timeframe}_]
+	namePrefix := fmt.Sprintf("%s_%s_", symbol, market)
+	if timeframe != "" {
+		namePrefix += timeframe + "_"
+	}
+
+	ctx := c.Request.Context()
+	page, err := s.s3Client.ListObjects(ctx, s3.ListOptions{
+		Prefix:            "screenshots/" + namePrefix,
+		ContinuationToken: c.Query("continuation_token"),
+		MaxKeys:           int32(limit),
+	})
+	if err != nil {
+		s.log(c.Request.Context()).WithError(err).Error("Failed to list screenshots")
+		apierror.Abort(c, apierror.Wrap(apierror.CodeStorageFailure, "Failed to list artifacts", err))
+		return
+	}
+
+	artifacts := make(map[string]*Artifact)
+	artifactFor := func(name string) *Artifact {
+		a, ok := artifacts[name]
+		if !ok {
+			a = &Artifact{Name: name, Timeframe: artifactTimeframe(name, symbol, market)}
+			artifacts[name] = a
+		}
+		return a
+	}
+
+	// 只列举与本页图片同一范围内的JSON数据
+	var dataObjects []s3.ObjectInfo
+	if len(page.Objects) > 0 {
+		first := artifactName(page.Objects[0].Key)
+		last := artifactName(page.Objects[len(page.Objects)-1].Key)
+
+		dataObjects, err = s.s3Client.ListAll(ctx, "data/"+namePrefix, "data/"+first, "data/"+last+".json")
+		if err != nil {
+			s.log(c.Request.Context()).WithError(err).Warn("Failed to list JSON data, returning images only")
+		}
+	}
+
+	versions := s.objectVersions(ctx, slices.Concat(page.Objects, dataObjects))
+	for _, obj := range page.Objects {
+		artifactFor(artifactName(obj.Key)).Image = s.artifactObject(c, obj, versions[obj.Key])
+	}
+	for _, obj := range dataObjects {
+		artifactFor(artifactName(obj.Key)).Data = s.artifactObject(c, obj, versions[obj.Key])
+	}
+
+	names := make([]string, 0, len(artifacts))
+	for name := range artifacts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]Artifact, 0, len(names))
+	for _, name := range names {
+		result = append(result, *artifacts[name])
+	}
+
+	response := ArtifactsResponse{
+		Success:   true,
+		Message:   "Artifacts listed successfully",
+		Symbol:    symbol,
+		Market:    market,
+		Artifacts: result,
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+	if page.IsTruncated {
+		response.NextToken = page.NextContinuationToken
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (s *Service) artifactObject(c *gin.Context, obj s3.ObjectInfo, version string) *ArtifactObject {
+	cdnURL, _ := s.generateCDNURL(c.Request.Context(), obj.Key, version)
+	return &ArtifactObject{
+		Key:          obj.Key,
+		CDNURL:       cdnURL,
+		Size:         obj.Size,
+		LastModified: obj.LastModified,
+	}
+}
+
+// objectVersions 读取对象的SHA256元数据作为URL版本号，与截图接口返回的URL保持一致，
+// 避免同一对象在CDN上缓存两份。未启用version模式时不读取；没有记录哈希的对象使用ETag
+func (s *Service) objectVersions(ctx context.Context, objects []s3.ObjectInfo) map[string]string {
+	if len(objects) == 0 || !s.current(ctx).urls.Versioned() {
+		return nil
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		versions = make(map[string]string, len(objects))
+		queue    = make(chan s3.ObjectInfo)
+	)
+	for i := 0; i < min(artifactVersionWorkers, len(objects)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range queue {
+				version, err := s.s3Client.ObjectSHA256(ctx, obj.Key)
+				if err != nil {
+					s.log(ctx).WithError(err).WithField("s3_key", obj.Key).Warn("Failed to read object hash, using ETag as URL version")
+				}
+				if version == "" {
+					version = obj.ETag
+				}
+
+				mu.Lock()
+				versions[obj.Key] = version
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, obj := range objects {
+		queue <- obj
+	}
+	close(queue)
+	wg.Wait()
+
+	return versions
+}
+
+// artifactName 去掉目录和扩展名，如 screenshot/screenshots/NVDA_us_1d_20250729.png -> NVDA_us_1d_20250729
+func artifactName(key string) string {
+	base := path.Base(key)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+// artifactTimeframe 从文件名中解析时间框架
+func artifactTimeframe(name, symbol, market string) string {
+	rest := strings.TrimPrefix(name, fmt.Sprintf("%s_%s_", symbol, market))
+	timeframe, _, _ := strings.Cut(rest, "_")
+	return timeframe
+}
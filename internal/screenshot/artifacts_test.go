@@ -0,0 +1,29 @@
+package screenshot
+
+import "testing"
+
+func TestArtifactName(t *testing.T) {
+	tests := []struct {
+		key           string
+		symbol        string
+		market        string
+		wantName      string
+		wantTimeframe string
+	}{
+		{key: "screenshot/screenshots/NVDA_us_1d_20250729.png", symbol: "NVDA", market: "us", wantName: "NVDA_us_1d_20250729", wantTimeframe: "1d"},
+		{key: "screenshot/data/NVDA_us_1d_20250729.json", symbol: "NVDA", market: "us", wantName: "NVDA_us_1d_20250729", wantTimeframe: "1d"},
+		{key: "screenshots/NVDA_us_1h_20250729_10.png", symbol: "NVDA", market: "us", wantName: "NVDA_us_1h_20250729_10", wantTimeframe: "1h"},
+		// 代码中含下划线时按 symbol_market_ 前缀截取
+		{key: "screenshots/BRK_B_us_1wk_2025_31.png", symbol: "BRK_B", market: "us", wantName: "BRK_B_us_1wk_2025_31", wantTimeframe: "1wk"},
+		{key: "screenshots/0700.HK_hk_5m_20250729_093000.png", symbol: "0700.HK", market: "hk", wantName: "0700.HK_hk_5m_20250729_093000", wantTimeframe: "5m"},
+	}
+	for _, tt := range tests {
+		name := artifactName(tt.key)
+		if name != tt.wantName {
+			t.Errorf("artifactName(%q) = %q, want %q", tt.key, name, tt.wantName)
+		}
+		if got := artifactTimeframe(name, tt.symbol, tt.market); got != tt.wantTimeframe {
+			t.Errorf("artifactTimeframe(%q) = %q, want %q", name, got, tt.wantTimeframe)
+		}
+	}
+}
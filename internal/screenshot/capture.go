@@ -0,0 +1,238 @@
+package screenshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"makeprofit/internal/chartservice"
+	"makeprofit/internal/config"
+	"makeprofit/internal/ratelimit"
+	"makeprofit/internal/s3"
+
+	"github.com/sirupsen/logrus"
+)
+
+// renderedImage 图表服务渲染出的图片，尚未上传
+type renderedImage struct {
+	body        io.Reader // 缓冲和共享目录模式下为io.ReadSeeker，可去重和计算哈希
+	size        int64     // 未知时为-1
+	contentType string
+	width       int // 流式模式或关闭图片校验时为0
+	height      int
+	close       func() // 释放连接或临时文件
+}
+
+// renderImage 按配置的图片传输模式获取图表图片
+func (s *Service) renderImage(ctx context.Context, req *ScreenshotRequest, formattedSymbol string) (*renderedImage, error) {
+	switch s.current(ctx).config.ChartService.ImageMode {
+	case chartservice.ImageModeStream:
+		return s.renderImageStream(ctx, req, formattedSymbol)
+	case chartservice.ImageModeSharedPath:
+		return s.renderImageSharedPath(ctx, req, formattedSymbol)
+	default:
+		return s.renderImageBuffered(ctx, req, formattedSymbol)
+	}
+}
+
+// renderImageBuffered 将图片完整读入内存并校验
+func (s *Service) renderImageBuffered(ctx context.Context, req *ScreenshotRequest, formattedSymbol string) (*renderedImage, error) {
+	chartImage, err := s.current(ctx).chartService.RenderChartImage(ctx, formattedSymbol, req.Timeframe)
+	if err != nil {
+		return nil, err
+	}
+
+	// 直接从内存上传，不经过临时文件
+	return &renderedImage{
+		body:        bytes.NewReader(chartImage.Data),
+		size:        int64(len(chartImage.Data)),
+		contentType: chartImage.Type,
+		width:       chartImage.Width,
+		height:      chartImage.Height,
+		close:       func() {},
+	}, nil
+}
+
+// renderImageStream 打开图表服务的响应体，上传时直接转发到S3，不在本地缓存图片
+func (s *Service) renderImageStream(ctx context.Context, req *ScreenshotRequest, formattedSymbol string) (*renderedImage, error) {
+	stream, err := s.current(ctx).chartService.OpenChartImage(ctx, formattedSymbol, req.Timeframe)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chart image: %w", err)
+	}
+
+	return &renderedImage{
+		body:        stream.Body,
+		size:        stream.Size,
+		contentType: stream.Type,
+		close:       func() { stream.Body.Close() },
+	}, nil
+}
+
+// renderImageSharedPath 让图表服务把图片写入共享目录，校验后上传时从磁盘读取
+func (s *Service) renderImageSharedPath(ctx context.Context, req *ScreenshotRequest, formattedSymbol string) (*renderedImage, error) {
+	comps := s.current(ctx)
+
+	// 预先创建唯一文件名，避免并发请求互相覆盖
+	file, err := os.CreateTemp(comps.config.ChartService.SharedDir, fmt.Sprintf("%s_%s_%s_*.png", req.Symbol, req.Market, req.Timeframe))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file in shared dir: %w", err)
+	}
+	sharedPath := file.Name()
+	file.Close()
+
+	remove := func() {
+		if err := os.Remove(sharedPath); err != nil && !os.IsNotExist(err) {
+			s.log(ctx).WithError(err).Warn("Failed to remove shared chart image")
+		}
+	}
+
+	saved, err := comps.chartService.RenderChartImageToFile(ctx, formattedSymbol, req.Timeframe, sharedPath)
+	if err != nil {
+		remove()
+		return nil, err
+	}
+
+	imageFile, err := os.Open(sharedPath)
+	if err != nil {
+		remove()
+		return nil, fmt.Errorf("failed to open shared chart image: %w", err)
+	}
+
+	size := int64(-1)
+	if info, err := imageFile.Stat(); err == nil {
+		size = info.Size()
+	}
+
+	return &renderedImage{
+		body:        imageFile,
+		size:        size,
+		contentType: saved.Type,
+		width:       saved.Width,
+		height:      saved.Height,
+		close: func() {
+			imageFile.Close()
+			remove()
+		},
+	}, nil
+}
+
+// uploadImage 上传渲染出的图片，可回退读取的内容走去重上传，流式内容直接转发
+func (s *Service) uploadImage(ctx context.Context, req *ScreenshotRequest, image *renderedImage, metadata map[string]string) (*s3.UploadResult, error) {
+	s3Key := s3.ScreenshotKey(req.Symbol, req.Market, req.Timeframe)
+	opts := s.uploadOptions(ctx, req, "screenshot", metadata)
+
+	if body, ok := image.body.(io.ReadSeeker); ok {
+		return s.uploadContent(ctx, body, s3Key, image.contentType, opts)
+	}
+
+	uploadResult, err := s.s3Client.UploadStream(ctx, image.body, image.size, s3Key, image.contentType, opts)
+	if err != nil {
+		return nil, err
+	}
+	ratelimit.AddUploadBytes(ctx, uploadResult.Size)
+	noteArtifact(ctx, uploadResult)
+	s.invalidate(uploadResult)
+	return uploadResult, nil
+}
+
+// uploadContent 上传可确定长度的内容，启用内容寻址时按SHA-256去重
+func (s *Service) uploadContent(ctx context.Context, body io.ReadSeeker, s3Key, contentType string, opts *s3.UploadOptions) (*s3.UploadResult, error) {
+	var (
+		result *s3.UploadResult
+		err    error
+	)
+	if s.current(ctx).config.S3.ContentAddressed {
+		result, err = s.s3Client.UploadDeduplicated(ctx, body, s3Key, contentType, opts)
+	} else {
+		result, err = s.s3Client.UploadReader(ctx, body, s3Key, contentType, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 内容未变化时没有实际上传，不计入上传配额
+	if !result.Unchanged {
+		ratelimit.AddUploadBytes(ctx, result.Size)
+	}
+	noteArtifact(ctx, result)
+	s.invalidate(result)
+	return result, nil
+}
+
+// invalidate 覆盖已有key后清除CDN缓存，首次写入的key不会被CDN缓存过，不需要清除
+// 启用purge时上传前会检查key是否已存在（见 uploadOptions），内容未变化时也不清除
+func (s *Service) invalidate(result *s3.UploadResult) {
+	if s.invalidator == nil || result.Unchanged || !result.Replaced {
+		return
+	}
+	s.invalidator.Invalidate(result.Key)
+}
+
+// uploadOptions 构造对象的缓存策略和标签，metadata由post_process阶段生成，可为nil
+func (s *Service) uploadOptions(ctx context.Context, req *ScreenshotRequest, kind string, metadata map[string]string) *s3.UploadOptions {
+	cfg := s.current(ctx).config
+	opts := &s3.UploadOptions{
+		CacheControl: cacheControl(&cfg.S3, req.Timeframe),
+		Metadata:     metadata,
+		// 只有覆盖已有key时才需要清除CDN缓存
+		CheckExisting: s.invalidator != nil,
+	}
+
+	if cfg.S3.Tagging {
+		opts.Tags = make(map[string]string, len(cfg.S3.Tags)+3)
+		for key, value := range cfg.S3.Tags {
+			opts.Tags[key] = value
+		}
+		opts.Tags["kind"] = kind
+		opts.Tags["market"] = req.Market
+		opts.Tags["timeframe"] = req.Timeframe
+	}
+
+	return opts
+}
+
+// artifactMetadata 截图和数据对象共用的描述性元数据
+func (s *Service) artifactMetadata(ctx context.Context, req *ScreenshotRequest, capturedAt time.Time) map[string]string {
+	return map[string]string{
+		"symbol":      req.Symbol,
+		"market":      req.Market,
+		"timeframe":   req.Timeframe,
+		"captured-at": capturedAt.UTC().Format(time.RFC3339),
+		"backend":     s.current(ctx).config.ChartService.BaseURL,
+	}
+}
+
+// cacheControl 按时间周期查找 Cache-Control，未配置时回退到 "default"
+func cacheControl(cfg *config.S3Config, timeframe string) string {
+	if value, ok := cfg.CacheControl[timeframe]; ok {
+		return value
+	}
+	return cfg.CacheControl["default"]
+}
+
+// uploadPanelData 将面板数据序列化为JSON并从内存上传到S3
+func (s *Service) uploadPanelData(ctx context.Context, req *ScreenshotRequest, panelData *chartservice.PanelData, metadata map[string]string) (*s3.UploadResult, error) {
+	jsonData, err := json.Marshal(panelData.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON data: %w", err)
+	}
+
+	jsonResult, err := s.uploadContent(ctx, bytes.NewReader(jsonData), s3.JSONDataKey(req.Symbol, req.Market, req.Timeframe), "application/json", s.uploadOptions(ctx, req, "data", metadata))
+	if err != nil {
+		return nil, err
+	}
+
+	s.log(ctx).WithFields(logrus.Fields{
+		"symbol":    req.Symbol,
+		"market":    req.Market,
+		"timeframe": req.Timeframe,
+		"json_key":  jsonResult.Key,
+		"size":      jsonResult.Size,
+	}).Info("JSON data uploaded successfully")
+
+	return jsonResult, nil
+}
@@ -0,0 +1,34 @@
+package screenshot
+
+import (
+	"testing"
+
+	"makeprofit/internal/config"
+)
+
+func TestCacheControl(t *testing.T) {
+	cfg := &config.S3Config{CacheControl: map[string]string{
+		"default": "public, max-age=300",
+		"1h":      "public, max-age=60",
+		"1wk":     "",
+	}}
+
+	tests := []struct {
+		timeframe string
+		want      string
+	}{
+		{timeframe: "1h", want: "public, max-age=60"},
+		{timeframe: "1d", want: "public, max-age=300"},
+		// 显式配置为空表示不设置，不回退到default
+		{timeframe: "1wk", want: ""},
+	}
+	for _, tt := range tests {
+		if got := cacheControl(cfg, tt.timeframe); got != tt.want {
+			t.Errorf("cacheControl(%s) = %q, want %q", tt.timeframe, got, tt.want)
+		}
+	}
+
+	if got := cacheControl(&config.S3Config{}, "1d"); got != "" {
+		t.Errorf("cacheControl() without config = %q, want empty", got)
+	}
+}
@@ -0,0 +1,77 @@
+package screenshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+
+	"makeprofit/internal/apierror"
+	"makeprofit/internal/chartservice"
+)
+
+// captureError 将截图失败映射为带错误码的错误
+// 已带错误码的（如S3上传失败）保留原错误码，其余按图表服务错误分类
+func captureError(err error) *apierror.Error {
+	code := upstreamCode(err)
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		code = apiErr.Code
+	}
+	return apierror.Wrap(code, "Failed to capture screenshot", err)
+}
+
+// invalidRequest 请求参数错误，校验错误只描述调用方的输入，可以原样返回
+func invalidRequest(err error) *apierror.Error {
+	return apierror.New(apierror.CodeInvalidRequest, "Invalid request: "+err.Error())
+}
+
+// storageError 包装S3读写失败
+func storageError(message string, err error) *apierror.Error {
+	return apierror.Wrap(apierror.CodeStorageFailure, message, err)
+}
+
+// upstreamCode 按图表服务错误的类型选择错误码
+func upstreamCode(err error) apierror.Code {
+	var statusErr *chartservice.StatusError
+	var pathErr *fs.PathError
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &statusErr):
+		switch statusErr.StatusCode {
+		case http.StatusNotFound:
+			return apierror.CodeSymbolNotFound
+		case http.StatusBadGateway, http.StatusServiceUnavailable:
+			return apierror.CodeUpstreamUnavailable
+		case http.StatusGatewayTimeout:
+			return apierror.CodeUpstreamTimeout
+		default:
+			return apierror.CodeUpstreamError
+		}
+	case errors.Is(err, context.Canceled):
+		// 客户端断开导致请求被取消
+		return apierror.CodeCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return apierror.CodeUpstreamTimeout
+	case errors.Is(err, chartservice.ErrInvalidImage):
+		return apierror.CodeUpstreamError
+	case errors.As(err, &pathErr):
+		// 共享目录读写失败
+		return apierror.CodeInternal
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return apierror.CodeUpstreamTimeout
+		}
+		return apierror.CodeUpstreamUnavailable
+	default:
+		return apierror.CodeUpstreamError
+	}
+}
+
+// marketForbidden API Key无权访问该市场
+func marketForbidden(market string) *apierror.Error {
+	return apierror.New(apierror.CodeForbidden, fmt.Sprintf("API key is not allowed to access market %s", market))
+}
@@ -0,0 +1,121 @@
+package screenshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"makeprofit/internal/apierror"
+	"makeprofit/internal/chartservice"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+// timeoutError 模拟net.Error超时
+type timeoutError struct{ timeout bool }
+
+func (e timeoutError) Error() string   { return "dial tcp 10.0.0.1:8000: i/o timeout" }
+func (e timeoutError) Timeout() bool   { return e.timeout }
+func (e timeoutError) Temporary() bool { return false }
+
+func TestCaptureError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want apierror.Code
+	}{
+		{name: "unknown symbol", err: &chartservice.StatusError{StatusCode: http.StatusNotFound}, want: apierror.CodeSymbolNotFound},
+		{name: "bad gateway", err: &chartservice.StatusError{StatusCode: http.StatusBadGateway}, want: apierror.CodeUpstreamUnavailable},
+		{name: "gateway timeout", err: &chartservice.StatusError{StatusCode: http.StatusGatewayTimeout}, want: apierror.CodeUpstreamTimeout},
+		{name: "server error", err: fmt.Errorf("refresh: %w", &chartservice.StatusError{StatusCode: 500}), want: apierror.CodeUpstreamError},
+		{name: "invalid image", err: fmt.Errorf("%w: image looks blank", chartservice.ErrInvalidImage), want: apierror.CodeUpstreamError},
+		{name: "deadline", err: context.DeadlineExceeded, want: apierror.CodeUpstreamTimeout},
+		{name: "canceled", err: context.Canceled, want: apierror.CodeCanceled},
+		{name: "network timeout", err: timeoutError{timeout: true}, want: apierror.CodeUpstreamTimeout},
+		{name: "connection refused", err: timeoutError{}, want: apierror.CodeUpstreamUnavailable},
+		{name: "shared dir", err: &fs.PathError{Op: "open", Path: "/shared/x.png", Err: os.ErrPermission}, want: apierror.CodeInternal},
+		{name: "storage keeps its code", err: storageError("failed to upload screenshot to S3", errors.New("AccessDenied")), want: apierror.CodeStorageFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := captureError(tt.err)
+			if got.Code != tt.want {
+				t.Errorf("captureError() code = %s, want %s", got.Code, tt.want)
+			}
+			if !errors.Is(got, tt.err) {
+				t.Errorf("captureError() does not wrap %v", tt.err)
+			}
+			if strings.Contains(got.Message, tt.err.Error()) {
+				t.Errorf("captureError() message %q exposes the underlying error", got.Message)
+			}
+		})
+	}
+}
+
+func TestScreenshotRequestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		req  ScreenshotRequest
+		want apierror.Code // 为空表示校验通过
+	}{
+		{name: "valid", req: ScreenshotRequest{Symbol: "NVDA", Market: "us", Timeframe: "1d"}},
+		{name: "index symbol", req: ScreenshotRequest{Symbol: "^GSPC", Market: "us", Timeframe: "1wk"}},
+		{name: "hk suffix", req: ScreenshotRequest{Symbol: "0700.HK", Market: "hk", Timeframe: "5m"}},
+		{name: "symbol with slash", req: ScreenshotRequest{Symbol: "NVDA/../x", Market: "us", Timeframe: "1d"}, want: apierror.CodeInvalidSymbol},
+		{name: "symbol too long", req: ScreenshotRequest{Symbol: strings.Repeat("A", 33), Market: "us", Timeframe: "1d"}, want: apierror.CodeInvalidSymbol},
+		{name: "market traversal", req: ScreenshotRequest{Symbol: "NVDA", Market: "../us", Timeframe: "1d"}, want: apierror.CodeInvalidRequest},
+		{name: "market with slash", req: ScreenshotRequest{Symbol: "NVDA", Market: "us/hk", Timeframe: "1d"}, want: apierror.CodeInvalidRequest},
+		{name: "market too long", req: ScreenshotRequest{Symbol: "NVDA", Market: strings.Repeat("x", 9), Timeframe: "1d"}, want: apierror.CodeInvalidRequest},
+		{name: "empty market", req: ScreenshotRequest{Symbol: "NVDA", Timeframe: "1d"}, want: apierror.CodeInvalidRequest},
+		{name: "timeframe word", req: ScreenshotRequest{Symbol: "NVDA", Market: "us", Timeframe: "daily"}, want: apierror.CodeInvalidRequest},
+		{name: "timeframe traversal", req: ScreenshotRequest{Symbol: "NVDA", Market: "us", Timeframe: "1d/.."}, want: apierror.CodeInvalidRequest},
+		{name: "timeframe too long", req: ScreenshotRequest{Symbol: "NVDA", Market: "us", Timeframe: "10000d"}, want: apierror.CodeInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("validate() error = %v", err)
+				}
+				return
+			}
+			if got := apierror.From(err); err == nil || got.Code != tt.want {
+				t.Errorf("validate() error = %v, want code %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessLogRecordsErrorCode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger, hook := test.NewNullLogger()
+	s := &Service{logger: logger}
+
+	r := gin.New()
+	r.Use(s.accessLog())
+	r.GET("/", func(c *gin.Context) {
+		apierror.Abort(c, apierror.Wrap(apierror.CodeUpstreamUnavailable, "Chart service unavailable", errors.New("dial tcp: connection refused")))
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	// 响应只有通用message，错误原因只写入访问日志
+	if strings.Contains(w.Body.String(), "connection refused") {
+		t.Errorf("response %q exposes the underlying error", w.Body.String())
+	}
+	entry := hook.LastEntry()
+	if entry == nil || entry.Data["error_code"] != string(apierror.CodeUpstreamUnavailable) {
+		t.Fatalf("access log = %v, want error_code %s", entry, apierror.CodeUpstreamUnavailable)
+	}
+	if err, _ := entry.Data["error"].(string); !strings.Contains(err, "connection refused") {
+		t.Errorf("access log error = %v, want the underlying error", entry.Data["error"])
+	}
+}
@@ -0,0 +1,174 @@
+package screenshot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"makeprofit/internal/apierror"
+	"makeprofit/internal/auth"
+	"makeprofit/internal/history"
+	"makeprofit/internal/s3"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// HistoryEntry 历史截图条目
+type HistoryEntry struct {
+	history.Record
+	CDNURL     string `json:"cdn_url"`
+	DataCDNURL string `json:"data_cdn_url,omitempty"`
+}
+
+// HistoryResponse 历史查询响应
+type HistoryResponse struct {
+	Success   bool           `json:"success"`
+	Message   string         `json:"message"`
+	Count     int            `json:"count"`
+	Captures  []HistoryEntry `json:"captures"`
+	Timestamp string         `json:"timestamp"`
+}
+
+// recordCapture 将截图结果写入历史索引，失败只记录日志
+func (s *Service) recordCapture(ctx context.Context, req *ScreenshotRequest, image, data *s3.UploadResult, start time.Time) {
+	if s.history == nil {
+		return
+	}
+
+	record := &history.Record{
+		Symbol:          req.Symbol,
+		Market:          req.Market,
+		Timeframe:       req.Timeframe,
+		BucketTime:      history.BucketTime(req.Timeframe, start),
+		CapturedAt:      start,
+		ImageKey:        image.Key,
+		ImageSize:       image.Size,
+		ImageSHA256:     image.SHA256,
+		ImageContentKey: image.ContentKey,
+		DurationMs:      time.Since(start).Milliseconds(),
+		Backend:         s.current(ctx).config.ChartService.BaseURL,
+	}
+	if data != nil {
+		record.DataKey = data.Key
+		record.DataSize = data.Size
+		record.DataSHA256 = data.SHA256
+		record.DataContentKey = data.ContentKey
+	}
+
+	if err := s.history.Add(record); err != nil {
+		s.log(ctx).WithError(err).Warn("Failed to record capture in history index")
+	}
+}
+
+// handleHistory GET /api/v1/history?symbol=NVDA&market=us&timeframe=1d&from=...&to=...&limit=100
+func (s *Service) handleHistory(c *gin.Context) {
+	if s.history == nil {
+		apierror.Abort(c, apierror.New(apierror.CodeNotFound, "History index is not enabled"))
+		return
+	}
+
+	query, err := historyQueryFromParams(c)
+	if err != nil {
+		apierror.Abort(c, apierror.New(apierror.CodeInvalidRequest, err.Error()))
+		return
+	}
+
+	if !auth.MarketAllowed(c, query.Market) {
+		apierror.Abort(c, marketForbidden(query.Market))
+		return
+	}
+
+	records, err := s.history.Find(*query)
+	if err != nil {
+		s.log(c.Request.Context()).WithError(err).Error("Failed to query history index")
+		apierror.Abort(c, apierror.Wrap(apierror.CodeInternal, "Failed to query history", err))
+		return
+	}
+
+	entries := make([]HistoryEntry, 0, len(records))
+	for _, record := range records {
+		entry := HistoryEntry{Record: record}
+		entry.CDNURL = s.historyURL(c.Request.Context(), record.ImageKey, record.ImageContentKey, record.ImageSHA256)
+		if record.DataKey != "" {
+			entry.DataCDNURL = s.historyURL(c.Request.Context(), record.DataKey, record.DataContentKey, record.DataSHA256)
+		}
+		entries = append(entries, entry)
+	}
+
+	c.JSON(http.StatusOK, HistoryResponse{
+		Success:   true,
+		Message:   "History retrieved successfully",
+		Count:     len(entries),
+		Captures:  entries,
+		Timestamp: time.Now().Format(time.RFC3339),
+	})
+}
+
+// historyURL 优先使用内容寻址key生成URL，指向当次截图的内容而不是该时间段最新的截图
+func (s *Service) historyURL(ctx context.Context, key, contentKey, sha256 string) string {
+	if contentKey != "" {
+		url, _ := s.generateCDNURL(ctx, contentKey, "")
+		return url
+	}
+	url, _ := s.generateCDNURL(ctx, key, sha256)
+	return url
+}
+
+// historyQueryFromParams 解析历史查询参数，from/to支持RFC3339或YYYY-MM-DD
+func historyQueryFromParams(c *gin.Context) (*history.Query, error) {
+	query := &history.Query{
+		Symbol:    c.Query("symbol"),
+		Market:    c.Query("market"),
+		Timeframe: c.Query("timeframe"),
+		Limit:     defaultHistoryLimit,
+	}
+	if query.Symbol == "" || query.Market == "" {
+		return nil, fmt.Errorf("Missing required parameters: symbol, market")
+	}
+
+	var err error
+	if query.From, err = parseHistoryTime(c.Query("from"), false); err != nil {
+		return nil, fmt.Errorf("Invalid from: %v", err)
+	}
+	if query.To, err = parseHistoryTime(c.Query("to"), true); err != nil {
+		return nil, fmt.Errorf("Invalid to: %v", err)
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil || query.Limit <= 0 {
+			return nil, fmt.Errorf("Invalid limit: %s", limit)
+		}
+		if query.Limit > maxHistoryLimit {
+			query.Limit = maxHistoryLimit
+		}
+	}
+
+	return query, nil
+}
+
+// parseHistoryTime 解析时间参数，日期格式的to表示当天结束
+func parseHistoryTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected RFC3339 or YYYY-MM-DD, got %q", value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, nil
+}
@@ -0,0 +1,137 @@
+package screenshot
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"makeprofit/internal/apierror"
+	"makeprofit/internal/s3"
+	"makeprofit/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// maxRequestIDLength 调用方传入的请求ID最大长度，超长或含非法字符时重新生成
+const maxRequestIDLength = 128
+
+const (
+	cacheHit  = "hit"  // 存储中已有相同内容，未实际上传
+	cacheMiss = "miss" // 上传了新内容
+)
+
+// accessRecord 请求处理过程中记录的产物，请求结束后写入访问日志
+type accessRecord struct {
+	mu        sync.Mutex
+	keys      []string
+	unchanged int
+}
+
+type accessRecordKey struct{}
+
+// requestID 中间件，读取或生成X-Request-ID，写回响应头，并将带request_id的日志放入请求上下文
+func (s *Service) requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(utils.RequestIDHeader)
+		if !validRequestID(id) {
+			id = utils.NewRequestID()
+		}
+		c.Header(utils.RequestIDHeader, id)
+
+		ctx := utils.WithRequestID(c.Request.Context(), id)
+		ctx = utils.WithLogger(ctx, s.logger.WithField("request_id", id))
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// validRequestID 只接受可安全写入日志和请求头的ID
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// accessLog 中间件，每个请求结束后输出一行结构化访问日志
+func (s *Service) accessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		record := &accessRecord{}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), accessRecordKey{}, record))
+
+		c.Next()
+
+		path := c.FullPath()
+		if path == "" {
+			path = c.Request.URL.Path
+		}
+		fields := logrus.Fields{
+			"method":     c.Request.Method,
+			"path":       path,
+			"status":     c.Writer.Status(),
+			"latency_ms": time.Since(start).Milliseconds(),
+			"client_ip":  c.ClientIP(),
+			"bytes":      c.Writer.Size(),
+		}
+
+		if code := c.GetString(apierror.ContextKey); code != "" {
+			fields["error_code"] = code
+		}
+		if err := c.Errors.Last(); err != nil {
+			// 错误原因只写入日志，响应中只有通用的message
+			fields["error"] = err.Error()
+		}
+
+		record.mu.Lock()
+		if len(record.keys) > 0 {
+			fields["artifact_keys"] = record.keys
+			fields["cache_status"] = cacheMiss
+			if record.unchanged == len(record.keys) {
+				fields["cache_status"] = cacheHit
+			}
+		}
+		record.mu.Unlock()
+
+		entry := s.log(c.Request.Context()).WithFields(fields)
+		switch status := c.Writer.Status(); {
+		case status >= 500:
+			entry.Error("HTTP request")
+		case status >= 400:
+			entry.Warn("HTTP request")
+		case path == "/health":
+			// 健康检查频繁，降为debug级别
+			entry.Debug("HTTP request")
+		default:
+			entry.Info("HTTP request")
+		}
+	}
+}
+
+// noteArtifact 记录本次请求写入的对象，用于访问日志
+func noteArtifact(ctx context.Context, result *s3.UploadResult) {
+	record, ok := ctx.Value(accessRecordKey{}).(*accessRecord)
+	if !ok {
+		return
+	}
+	record.mu.Lock()
+	defer record.mu.Unlock()
+	record.keys = append(record.keys, result.Key)
+	if result.Unchanged {
+		record.unchanged++
+	}
+}
+
+// log 返回带请求ID的日志，不在请求中时使用服务日志
+func (s *Service) log(ctx context.Context) *logrus.Entry {
+	return utils.LoggerFromContext(ctx, s.logger)
+}
@@ -0,0 +1,173 @@
+package screenshot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"makeprofit/internal/s3"
+	"makeprofit/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestValidRequestID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{id: "3f2a9c1e-7b4d-4e8f-9a10-5c6d7e8f9a0b", want: true},
+		{id: "job_42:retry.1", want: true},
+		{id: "", want: false},
+		{id: "with space", want: false},
+		{id: "line\nbreak", want: false},
+		{id: strings.Repeat("a", maxRequestIDLength), want: true},
+		{id: strings.Repeat("a", maxRequestIDLength+1), want: false},
+	}
+	for _, tt := range tests {
+		if got := validRequestID(tt.id); got != tt.want {
+			t.Errorf("validRequestID(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		header   string
+		wantSame bool
+	}{
+		{name: "caller id is kept", header: "caller-123", wantSame: true},
+		{name: "missing id is generated"},
+		{name: "unsafe id is replaced", header: "bad id\r\nX-Injected: 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, hook := test.NewNullLogger()
+			s := &Service{logger: logger}
+
+			var ctxID string
+			r := gin.New()
+			r.GET("/", s.requestID(), func(c *gin.Context) {
+				ctxID = utils.RequestID(c.Request.Context())
+				s.log(c.Request.Context()).Info("handling")
+				c.Status(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(utils.RequestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			id := w.Header().Get(utils.RequestIDHeader)
+			if tt.wantSame && id != tt.header {
+				t.Errorf("response id = %q, want %q", id, tt.header)
+			}
+			if !tt.wantSame && (id == tt.header || !validRequestID(id)) {
+				t.Errorf("response id = %q, want a generated id", id)
+			}
+			if ctxID != id {
+				t.Errorf("context id = %q, response id = %q", ctxID, id)
+			}
+			if entry := hook.LastEntry(); entry == nil || entry.Data["request_id"] != id {
+				t.Errorf("request log entry = %v, want request_id %s", entry, id)
+			}
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name      string
+		path      string
+		handler   gin.HandlerFunc
+		wantLevel logrus.Level
+		wantField map[string]interface{}
+		absent    []string
+	}{
+		{
+			name: "upload miss",
+			path: "/api/v1/screenshot/:symbol",
+			handler: func(c *gin.Context) {
+				noteArtifact(c.Request.Context(), &s3.UploadResult{Key: "screenshots/a.png"})
+				noteArtifact(c.Request.Context(), &s3.UploadResult{Key: "data/a.json", Unchanged: true})
+				c.Status(http.StatusOK)
+			},
+			wantLevel: logrus.InfoLevel,
+			wantField: map[string]interface{}{"status": http.StatusOK, "path": "/api/v1/screenshot/:symbol", "cache_status": cacheMiss},
+		},
+		{
+			name: "all unchanged",
+			path: "/api/v1/screenshot/:symbol",
+			handler: func(c *gin.Context) {
+				noteArtifact(c.Request.Context(), &s3.UploadResult{Key: "screenshots/a.png", Unchanged: true})
+				c.Status(http.StatusOK)
+			},
+			wantLevel: logrus.InfoLevel,
+			wantField: map[string]interface{}{"cache_status": cacheHit},
+		},
+		{
+			name:      "server error",
+			path:      "/api/v1/screenshot/:symbol",
+			handler:   func(c *gin.Context) { c.AbortWithStatus(http.StatusServiceUnavailable) },
+			wantLevel: logrus.ErrorLevel,
+			wantField: map[string]interface{}{"status": http.StatusServiceUnavailable},
+			absent:    []string{"artifact_keys", "cache_status"},
+		},
+		{
+			name:      "client error",
+			path:      "/api/v1/screenshot/:symbol",
+			handler:   func(c *gin.Context) { c.AbortWithStatus(http.StatusBadRequest) },
+			wantLevel: logrus.WarnLevel,
+			wantField: map[string]interface{}{"status": http.StatusBadRequest},
+		},
+		{
+			name:      "health check",
+			path:      "/health",
+			handler:   func(c *gin.Context) { c.Status(http.StatusOK) },
+			wantLevel: logrus.DebugLevel,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, hook := test.NewNullLogger()
+			logger.SetLevel(logrus.DebugLevel)
+			s := &Service{logger: logger}
+
+			r := gin.New()
+			r.Use(s.requestID(), s.accessLog())
+			r.GET(tt.path, tt.handler)
+			target := strings.Replace(tt.path, ":symbol", "NVDA", 1)
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+
+			entry := hook.LastEntry()
+			if entry == nil || entry.Message != "HTTP request" {
+				t.Fatalf("last log entry = %v, want the access log", entry)
+			}
+			if entry.Level != tt.wantLevel {
+				t.Errorf("level = %s, want %s", entry.Level, tt.wantLevel)
+			}
+			if entry.Data["request_id"] == "" || entry.Data["method"] != http.MethodGet {
+				t.Errorf("access log fields = %v", entry.Data)
+			}
+			for key, want := range tt.wantField {
+				if entry.Data[key] != want {
+					t.Errorf("%s = %v, want %v", key, entry.Data[key], want)
+				}
+			}
+			for _, key := range tt.absent {
+				if _, ok := entry.Data[key]; ok {
+					t.Errorf("unexpected field %s = %v", key, entry.Data[key])
+				}
+			}
+		})
+	}
+}
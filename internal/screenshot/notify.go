@@ -0,0 +1,93 @@
+package screenshot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"makeprofit/internal/apierror"
+	"makeprofit/internal/webhook"
+	"makeprofit/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultDeliveriesLimit = 100
+
+// webhookPayload webhook消息中的data字段
+type webhookPayload struct {
+	Request  *ScreenshotRequest  `json:"request"`
+	Response *ScreenshotResponse `json:"response,omitempty"`
+	Error    *webhookError       `json:"error,omitempty"`
+}
+
+type webhookError struct {
+	ErrorCode apierror.Code `json:"error_code"`
+	Message   string        `json:"message"`
+}
+
+// webhookNotifier 在流水线notify阶段投递webhook
+type webhookNotifier struct {
+	dispatcher *webhook.Dispatcher
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, req *ScreenshotRequest, response *ScreenshotResponse, err error) {
+	event := webhook.EventCompleted
+	payload := &webhookPayload{Request: req, Response: response}
+	if err != nil {
+		event = webhook.EventFailed
+		apiErr := apierror.From(err)
+		payload.Error = &webhookError{ErrorCode: apiErr.Code, Message: apiErr.Message}
+	}
+
+	n.dispatcher.Dispatch(event, utils.RequestID(ctx), req.CallbackURL, payload)
+}
+
+// validateCallbackURL 校验请求级回调地址，未启用webhook时不允许指定
+func (s *Service) validateCallbackURL(callbackURL string) error {
+	if callbackURL == "" {
+		return nil
+	}
+	if s.webhooks == nil {
+		return fmt.Errorf("callback_url requires webhook.enabled")
+	}
+	return s.webhooks.ValidateCallbackURL(callbackURL)
+}
+
+// handleWebhookDeliveries GET /api/v1/admin/webhooks/deliveries?status=failed&limit=100
+// 按时间倒序返回最近的webhook投递记录
+func (s *Service) handleWebhookDeliveries(c *gin.Context) {
+	if s.webhooks == nil {
+		apierror.Abort(c, apierror.New(apierror.CodeNotFound, "Webhooks are not enabled"))
+		return
+	}
+
+	status := c.Query("status")
+	switch status {
+	case "", webhook.StatusPending, webhook.StatusSucceeded, webhook.StatusFailed:
+	default:
+		apierror.Abort(c, apierror.New(apierror.CodeInvalidRequest, fmt.Sprintf("Invalid status: %s", status)))
+		return
+	}
+
+	limit := defaultDeliveriesLimit
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			apierror.Abort(c, apierror.New(apierror.CodeInvalidRequest, fmt.Sprintf("Invalid limit: %s", value)))
+			return
+		}
+		limit = n
+	}
+
+	deliveries := s.webhooks.Deliveries(status, limit)
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"message":    "Webhook deliveries retrieved successfully",
+		"count":      len(deliveries),
+		"deliveries": deliveries,
+		"timestamp":  time.Now().Format(time.RFC3339),
+	})
+}
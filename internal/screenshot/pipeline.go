@@ -0,0 +1,404 @@
+package screenshot
+
+import (
+	"context"
+	"fmt"
+	"image"
+	_ "image/png" // 共享目录模式下探测PNG尺寸
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"makeprofit/internal/chartservice"
+	"makeprofit/internal/s3"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Stage 截图流水线的阶段
+type Stage string
+
+const (
+	StageResolve     Stage = "resolve"      // 校验请求，格式化股票代码，解析刷新策略（总是执行）
+	StageRefresh     Stage = "refresh"      // 按刷新策略刷新K线数据
+	StageRender      Stage = "render"       // 渲染图表图片
+	StageData        Stage = "data"         // 获取面板JSON数据
+	StagePostProcess Stage = "post_process" // 补全图片尺寸，生成对象元数据
+	StageStore       Stage = "store"        // 上传图片和数据到S3
+	StageIndex       Stage = "index"        // 写入历史索引
+	StageNotify      Stage = "notify"       // 通知已注册的Notifier，失败时也会执行
+)
+
+// stageOrder 流水线按此顺序执行，请求未指定stages时执行全部阶段
+var stageOrder = []Stage{StageResolve, StageRefresh, StageRender, StageData, StagePostProcess, StageStore, StageIndex, StageNotify}
+
+// stageSet 本次请求要执行的阶段
+type stageSet map[Stage]bool
+
+// stagePrerequisites 阶段的前置条件：requires中至少有一个阶段被选中，否则该阶段没有可处理的内容
+// 同一阶段可以有多条前置条件，需要全部满足
+var stagePrerequisites = []struct {
+	stage    Stage
+	requires []Stage
+}{
+	{StagePostProcess, []Stage{StageRender}},
+	{StageStore, []Stage{StageRender, StageData}},
+	{StageIndex, []Stage{StageStore}},
+	{StageIndex, []Stage{StageRender}}, // 历史索引只记录上传的图片
+}
+
+// parseStages 解析请求中的阶段列表，为空时执行全部阶段，resolve总是执行
+// 选中的阶段缺少前置阶段时返回错误，避免返回没有任何结果的成功响应
+func parseStages(names []string) (stageSet, error) {
+	stages := make(stageSet, len(stageOrder))
+	if len(names) == 0 {
+		for _, stage := range stageOrder {
+			stages[stage] = true
+		}
+		return stages, nil
+	}
+
+	stages[StageResolve] = true
+	for _, name := range names {
+		stage := Stage(strings.TrimSpace(name))
+		known := false
+		for _, candidate := range stageOrder {
+			if stage == candidate {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown stage %q", name)
+		}
+		stages[stage] = true
+	}
+
+	for _, p := range stagePrerequisites {
+		if !stages[p.stage] {
+			continue
+		}
+		satisfied := false
+		for _, required := range p.requires {
+			satisfied = satisfied || stages[required]
+		}
+		if !satisfied {
+			names := make([]string, len(p.requires))
+			for i, required := range p.requires {
+				names[i] = string(required)
+			}
+			return nil, fmt.Errorf("stage %s requires %s", p.stage, strings.Join(names, " or "))
+		}
+	}
+	return stages, nil
+}
+
+// Notifier 截图完成或失败时收到通知，err非nil时response为nil
+type Notifier interface {
+	Notify(ctx context.Context, req *ScreenshotRequest, response *ScreenshotResponse, err error)
+}
+
+// AddNotifier 注册流水线notify阶段的通知目标
+func (s *Service) AddNotifier(n Notifier) {
+	s.notifiers = append(s.notifiers, n)
+}
+
+// capture 一次截图流水线的中间状态
+type capture struct {
+	req   *ScreenshotRequest
+	start time.Time
+
+	symbol  string // 图表服务使用的股票代码
+	refresh *chartservice.RefreshOptions
+
+	image     *renderedImage
+	panelData *chartservice.PanelData
+
+	imageMetadata map[string]string
+	dataMetadata  map[string]string
+
+	imageResult *s3.UploadResult
+	dataResult  *s3.UploadResult
+}
+
+// stage 流水线中的一个阶段
+type stage struct {
+	name Stage
+	run  func(s *Service, ctx context.Context, c *capture) error
+}
+
+// pipeline 按组执行，同一组内选中的多个阶段并发执行
+// 刷新完成后渲染图片和获取数据互不依赖，并发执行可缩短约一半耗时
+var pipeline = [][]stage{
+	{{StageResolve, (*Service).resolveStage}},
+	{{StageRefresh, (*Service).refreshStage}},
+	{{StageRender, (*Service).renderStage}, {StageData, (*Service).dataStage}},
+	{{StagePostProcess, (*Service).postProcessStage}},
+	{{StageStore, (*Service).storeStage}},
+	{{StageIndex, (*Service).indexStage}},
+}
+
+// runGroup 执行一组阶段，任一阶段失败时通过cancel取消同组其余阶段
+// 返回按阶段顺序的第一个错误
+func (s *Service) runGroup(ctx context.Context, cancel context.CancelFunc, c *capture, group []stage, stages stageSet) error {
+	var selected []stage
+	for _, st := range group {
+		if stages[st.name] {
+			selected = append(selected, st)
+		}
+	}
+	if len(selected) == 1 {
+		return selected[0].run(s, ctx, c)
+	}
+
+	errs := make([]error, len(selected))
+	var wg sync.WaitGroup
+	for i, st := range selected {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := st.run(s, ctx, c); err != nil {
+				errs[i] = err
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Capture 按请求选择的阶段执行截图流水线
+// 失败时返回 *apierror.Error，notify阶段在成功和失败时都会执行
+func (s *Service) Capture(ctx context.Context, req *ScreenshotRequest) (*ScreenshotResponse, error) {
+	stages, err := parseStages(req.Stages)
+	if err != nil {
+		return nil, invalidRequest(err)
+	}
+	if err := s.validateCallbackURL(req.CallbackURL); err != nil {
+		return nil, invalidRequest(err)
+	}
+
+	response, err := s.runPipeline(ctx, req, stages)
+	if err != nil {
+		s.log(ctx).WithError(err).WithFields(logrus.Fields{
+			"symbol":    req.Symbol,
+			"market":    req.Market,
+			"timeframe": req.Timeframe,
+		}).Error("Screenshot pipeline failed")
+	}
+
+	if stages[StageNotify] {
+		for _, n := range s.notifiers {
+			n.Notify(ctx, req, response, err)
+		}
+	}
+
+	return response, err
+}
+
+func (s *Service) runPipeline(ctx context.Context, req *ScreenshotRequest, stages stageSet) (*ScreenshotResponse, error) {
+	// 流式模式下图片连接在上传完成前保持打开，只在流水线失败或结束时取消
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c := &capture{req: req, start: time.Now()}
+	defer func() {
+		if c.image != nil {
+			c.image.close()
+		}
+	}()
+
+	s.log(ctx).WithFields(logrus.Fields{
+		"symbol":    req.Symbol,
+		"market":    req.Market,
+		"timeframe": req.Timeframe,
+		"stages":    req.Stages,
+	}).Info("Taking screenshot using chart service")
+
+	for _, group := range pipeline {
+		if err := s.runGroup(ctx, cancel, c, group, stages); err != nil {
+			return nil, err
+		}
+	}
+
+	response := s.buildResponse(ctx, c)
+
+	s.log(ctx).WithFields(logrus.Fields{
+		"symbol":    req.Symbol,
+		"market":    req.Market,
+		"timeframe": req.Timeframe,
+		"cdn_url":   response.CDNURL,
+	}).Info("Screenshot completed successfully")
+
+	return response, nil
+}
+
+// resolveStage 校验请求，格式化股票代码，解析刷新策略
+func (s *Service) resolveStage(ctx context.Context, c *capture) error {
+	if err := c.req.validate(); err != nil {
+		return err
+	}
+	refresh, err := c.req.refreshOptions()
+	if err != nil {
+		return invalidRequest(err)
+	}
+	c.refresh = refresh
+	c.symbol = s.formatSymbolForMarket(c.req.Symbol, c.req.Market)
+	return nil
+}
+
+// refreshStage 按刷新策略刷新K线数据，仅在required策略下失败时中止
+func (s *Service) refreshStage(ctx context.Context, c *capture) error {
+	if err := s.current(ctx).chartService.Refresh(ctx, c.symbol, c.req.Timeframe, c.refresh); err != nil {
+		return captureError(err)
+	}
+	return nil
+}
+
+// renderStage 按图片传输模式获取图表图片
+func (s *Service) renderStage(ctx context.Context, c *capture) error {
+	image, err := s.renderImage(ctx, c.req, c.symbol)
+	if err != nil {
+		return captureError(err)
+	}
+	c.image = image
+	return nil
+}
+
+// dataStage 获取面板数据，失败时继续，只是没有JSON数据
+func (s *Service) dataStage(ctx context.Context, c *capture) error {
+	panelData, err := s.current(ctx).chartService.GetPanelData(ctx, c.symbol, c.req.Timeframe)
+	if err != nil {
+		// 渲染失败取消了流水线时不再记录
+		if ctx.Err() == nil {
+			s.log(ctx).WithError(err).Warn("Failed to get panel data, will continue without JSON data")
+		}
+		return nil
+	}
+	if panelData.Success {
+		c.panelData = panelData
+	}
+	return nil
+}
+
+// postProcessStage 补全共享目录模式下的图片尺寸，并生成对象的描述性元数据
+func (s *Service) postProcessStage(ctx context.Context, c *capture) error {
+	metadata := s.artifactMetadata(ctx, c.req, c.start)
+	c.dataMetadata = metadata
+
+	if c.image == nil {
+		return nil
+	}
+	if c.image.width == 0 {
+		probeDimensions(c.image)
+	}
+
+	c.imageMetadata = make(map[string]string, len(metadata)+2)
+	for key, value := range metadata {
+		c.imageMetadata[key] = value
+	}
+	if c.image.width > 0 {
+		c.imageMetadata["image-width"] = strconv.Itoa(c.image.width)
+		c.imageMetadata["image-height"] = strconv.Itoa(c.image.height)
+	}
+	return nil
+}
+
+// probeDimensions 读取可回退内容的图片头获取宽高，流式内容无法回退时跳过
+func probeDimensions(img *renderedImage) {
+	body, ok := img.body.(io.ReadSeeker)
+	if !ok {
+		return
+	}
+	if cfg, _, err := image.DecodeConfig(body); err == nil {
+		img.width, img.height = cfg.Width, cfg.Height
+	}
+	body.Seek(0, io.SeekStart)
+}
+
+// storeStage 并发上传图片和JSON数据
+// 图片上传失败时中止并取消数据上传，数据上传失败只记录日志
+func (s *Service) storeStage(ctx context.Context, c *capture) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	if c.panelData != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := s.uploadPanelData(ctx, c.req, c.panelData, c.dataMetadata)
+			if err != nil {
+				if ctx.Err() == nil {
+					s.log(ctx).WithError(err).Warn("Failed to upload JSON data to S3")
+				}
+				return
+			}
+			c.dataResult = result
+		}()
+	}
+
+	var imageErr error
+	if c.image != nil {
+		result, err := s.uploadImage(ctx, c.req, c.image, c.imageMetadata)
+		if err != nil {
+			cancel()
+			imageErr = captureError(storageError("failed to upload screenshot to S3", err))
+		} else {
+			c.imageResult = result
+		}
+	}
+
+	wg.Wait()
+	return imageErr
+}
+
+// indexStage 将截图写入历史索引
+func (s *Service) indexStage(ctx context.Context, c *capture) error {
+	if c.imageResult != nil {
+		s.recordCapture(ctx, c.req, c.imageResult, c.dataResult, c.start)
+	}
+	return nil
+}
+
+// buildResponse 根据已执行的阶段生成响应，未上传的对象没有URL
+func (s *Service) buildResponse(ctx context.Context, c *capture) *ScreenshotResponse {
+	response := &ScreenshotResponse{
+		Success:   true,
+		Message:   "Screenshot taken successfully",
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+	if c.image != nil {
+		response.ImageWidth = c.image.width
+		response.ImageHeight = c.image.height
+	}
+
+	if result := c.imageResult; result != nil {
+		cdnURL, urlExpiresAt := s.generateCDNURL(ctx, result.Key, result.SHA256)
+		response.CDNURL = cdnURL
+		response.S3URL = result.Key // 这里存储S3 key而不是URL
+		response.ExpiresAt = formatExpiresAt(urlExpiresAt)
+		response.ImageSHA256 = result.SHA256
+		response.Unchanged = result.Unchanged
+		if result.ContentKey != "" {
+			response.ContentCDNURL, _ = s.generateCDNURL(ctx, result.ContentKey, "")
+		}
+	}
+
+	if result := c.dataResult; result != nil {
+		dataCDNURL, _ := s.generateCDNURL(ctx, result.Key, result.SHA256)
+		response.DataCDNURL = dataCDNURL
+		response.DataS3URL = result.Key
+		response.DataSHA256 = result.SHA256
+	}
+
+	return response
+}
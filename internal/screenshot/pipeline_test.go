@@ -0,0 +1,147 @@
+package screenshot
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStages(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      []string
+		want    []Stage // 除resolve外选中的阶段
+		wantErr string
+	}{
+		{name: "all by default", want: []Stage{StageRefresh, StageRender, StageData, StagePostProcess, StageStore, StageIndex, StageNotify}},
+		{name: "render only", in: []string{"render"}, want: []Stage{StageRender}},
+		{name: "refresh only", in: []string{"refresh"}, want: []Stage{StageRefresh}},
+		{name: "trims spaces", in: []string{" render", "store "}, want: []Stage{StageRender, StageStore}},
+		{name: "data only upload", in: []string{"data", "store"}, want: []Stage{StageData, StageStore}},
+		{
+			name: "full upload with index",
+			in:   []string{"render", "post_process", "store", "index"},
+			want: []Stage{StageRender, StagePostProcess, StageStore, StageIndex},
+		},
+		{name: "resolve is implied", in: []string{"resolve", "render"}, want: []Stage{StageRender}},
+		{name: "unknown stage", in: []string{"render", "upload"}, wantErr: `unknown stage "upload"`},
+		{name: "store without content", in: []string{"store"}, wantErr: "stage store requires render or data"},
+		{name: "index without store", in: []string{"render", "index"}, wantErr: "stage index requires store"},
+		{name: "index without image", in: []string{"data", "store", "index"}, wantErr: "stage index requires render"},
+		{name: "post_process without render", in: []string{"data", "post_process", "store"}, wantErr: "stage post_process requires render"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stages, err := parseStages(tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseStages(%v) error = %v, want %q", tt.in, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseStages(%v) error = %v", tt.in, err)
+			}
+			if !stages[StageResolve] {
+				t.Errorf("parseStages(%v) did not select resolve", tt.in)
+			}
+
+			var got []string
+			for stage, selected := range stages {
+				if selected && stage != StageResolve {
+					got = append(got, string(stage))
+				}
+			}
+			want := make([]string, len(tt.want))
+			for i, stage := range tt.want {
+				want[i] = string(stage)
+			}
+			sort.Strings(got)
+			sort.Strings(want)
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("parseStages(%v) = %v, want %v", tt.in, got, want)
+			}
+		})
+	}
+}
+
+func TestRunGroupRunsStagesConcurrently(t *testing.T) {
+	// 两个阶段互相等待对方开始，串行执行时会超时
+	renderStarted, dataStarted := make(chan struct{}), make(chan struct{})
+	wait := func(started, other chan struct{}) func(*Service, context.Context, *capture) error {
+		return func(_ *Service, ctx context.Context, _ *capture) error {
+			close(started)
+			select {
+			case <-other:
+				return nil
+			case <-time.After(5 * time.Second):
+				return errors.New("stages did not overlap")
+			}
+		}
+	}
+	group := []stage{
+		{StageRender, wait(renderStarted, dataStarted)},
+		{StageData, wait(dataStarted, renderStarted)},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stages := stageSet{StageRender: true, StageData: true}
+	if err := (&Service{}).runGroup(ctx, cancel, &capture{}, group, stages); err != nil {
+		t.Fatalf("runGroup() error = %v", err)
+	}
+}
+
+func TestRunGroupCancelsOnFailure(t *testing.T) {
+	renderErr := errors.New("render failed")
+	var dataErr error
+	group := []stage{
+		{StageRender, func(*Service, context.Context, *capture) error { return renderErr }},
+		{StageData, func(_ *Service, ctx context.Context, _ *capture) error {
+			// 渲染失败后取消同组的数据获取
+			select {
+			case <-ctx.Done():
+				dataErr = ctx.Err()
+				return dataErr
+			case <-time.After(5 * time.Second):
+				return nil
+			}
+		}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stages := stageSet{StageRender: true, StageData: true}
+	if err := (&Service{}).runGroup(ctx, cancel, &capture{}, group, stages); err != renderErr {
+		t.Errorf("runGroup() error = %v, want %v", err, renderErr)
+	}
+	if dataErr != context.Canceled {
+		t.Errorf("data stage error = %v, want context.Canceled", dataErr)
+	}
+}
+
+func TestRunGroupSkipsUnselectedStages(t *testing.T) {
+	var ran []Stage
+	record := func(name Stage) func(*Service, context.Context, *capture) error {
+		return func(*Service, context.Context, *capture) error {
+			ran = append(ran, name)
+			return nil
+		}
+	}
+	group := []stage{{StageRender, record(StageRender)}, {StageData, record(StageData)}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := (&Service{}).runGroup(ctx, cancel, &capture{}, group, stageSet{StageData: true}); err != nil {
+		t.Fatalf("runGroup() error = %v", err)
+	}
+	if len(ran) != 1 || ran[0] != StageData {
+		t.Errorf("ran stages %v, want [data]", ran)
+	}
+	if ctx.Err() != nil {
+		t.Error("runGroup() cancelled the pipeline without a failure")
+	}
+}
@@ -0,0 +1,166 @@
+package screenshot
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"makeprofit/internal/cdn"
+	"makeprofit/internal/chartservice"
+	"makeprofit/internal/config"
+	"makeprofit/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// components 可热更新的组件
+// 每个请求开始时取一次快照，重载后进行中的请求继续使用旧组件完成
+type components struct {
+	config       *config.Config
+	chartService *chartservice.Client
+	urls         *cdn.URLBuilder
+	loadedAt     time.Time
+}
+
+type componentsKey struct{}
+
+// newComponents 按配置创建可热更新的组件，tracker在重载前后共享
+func newComponents(cfg *config.Config, presigner cdn.Presigner, tracker *chartservice.RefreshTracker, logger *logrus.Logger) (*components, error) {
+	switch cfg.ChartService.ImageMode {
+	case "", chartservice.ImageModeBuffered, chartservice.ImageModeStream:
+	case chartservice.ImageModeSharedPath:
+		if cfg.ChartService.SharedDir == "" {
+			return nil, fmt.Errorf("chart_service.shared_dir is required when image_mode is %s", chartservice.ImageModeSharedPath)
+		}
+	default:
+		return nil, fmt.Errorf("unknown chart_service.image_mode %q", cfg.ChartService.ImageMode)
+	}
+
+	// 创建图表服务客户端
+	chartService, err := chartservice.NewClient(&cfg.ChartService, tracker, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create chart service client: %w", err)
+	}
+
+	// 创建URL生成器
+	urls, err := cdn.NewURLBuilder(&cfg.CDN, &cfg.S3, presigner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CDN URL builder: %w", err)
+	}
+
+	return &components{
+		config:       cfg,
+		chartService: chartService,
+		urls:         urls,
+		loadedAt:     time.Now(),
+	}, nil
+}
+
+// snapshot 中间件，将当前组件快照放入请求上下文
+func (s *Service) snapshot() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := context.WithValue(c.Request.Context(), componentsKey{}, s.components.Load())
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// current 获取请求上下文中的组件快照，不在请求中时返回最新组件
+func (s *Service) current(ctx context.Context) *components {
+	if comps, ok := ctx.Value(componentsKey{}).(*components); ok && comps != nil {
+		return comps
+	}
+	return s.components.Load()
+}
+
+// WatchConfig 监听配置文件变化并热更新，新配置校验失败时继续使用旧配置
+func (s *Service) WatchConfig(configPath string) error {
+	return config.Watch(configPath, func(cfg *config.Config, err error) {
+		if err != nil {
+			s.logger.WithError(err).Error("Config changed but is invalid, keeping current config")
+			return
+		}
+		if err := s.Reload(cfg); err != nil {
+			s.logger.WithError(err).Error("Failed to reload config, keeping current config")
+		}
+	})
+}
+
+// Reload 使用新配置原子替换图表服务客户端和URL生成器，并更新日志级别和限流参数
+// K线刷新记录、令牌桶和每日用量在重载后保留
+func (s *Service) Reload(cfg *config.Config) error {
+	previous := s.components.Load()
+	if previous.config.Revision == cfg.Revision {
+		return nil
+	}
+
+	next, err := newComponents(cfg, s.s3Client, s.refreshTracker, s.logger)
+	if err != nil {
+		return err
+	}
+	// 刷新记录只对同一个图表服务有效
+	if previous.config.ChartService.BaseURL != cfg.ChartService.BaseURL {
+		s.refreshTracker.Reset()
+	}
+
+	utils.ApplyLogLevel(s.logger, cfg.Logging.Level)
+	utils.ApplyLogFormat(s.logger, cfg.Logging.Format)
+	s.limiter.UpdateLimits(&cfg.RateLimit)
+	if s.invalidator != nil {
+		s.invalidator.SetURLBuilder(next.urls)
+	}
+	s.components.Store(next)
+
+	fields := logrus.Fields{
+		"previous_revision": previous.config.Revision,
+		"revision":          cfg.Revision,
+	}
+	// 环境变量设置的配置项优先于配置文件，文件中的修改对它们无效
+	if overrides := cfg.EnvOverrides(); len(overrides) > 0 {
+		fields["env_overrides"] = overrides
+	}
+	if sections := restartRequired(previous.config, cfg); len(sections) > 0 {
+		s.logger.WithFields(fields).WithField("sections", sections).Warn("Config reloaded, some changes require a restart")
+	} else {
+		s.logger.WithFields(fields).Info("Config reloaded")
+	}
+	return nil
+}
+
+// restartRequired 列出无法热更新、变更后需要重启才能生效的配置项
+func restartRequired(previous, next *config.Config) []string {
+	s3Connection := func(cfg *config.S3Config) []interface{} {
+		return []interface{}{cfg.Region, cfg.Bucket, cfg.ImagePrefix, cfg.AccessKeyID, cfg.SecretAccessKey, cfg.UploadTimeout, cfg.Multipart}
+	}
+	rateLimitState := func(cfg *config.RateLimitConfig) []interface{} {
+		return []interface{}{cfg.Enabled, cfg.UsageFile, cfg.FlushInterval}
+	}
+	logOutput := func(cfg *config.LoggingConfig) []interface{} {
+		return []interface{}{cfg.Output, cfg.Rotation, cfg.Syslog}
+	}
+
+	checks := []struct {
+		name           string
+		previous, next interface{}
+	}{
+		{"server", previous.Server, next.Server},
+		{"logging.output", logOutput(&previous.Logging), logOutput(&next.Logging)},
+		{"s3", s3Connection(&previous.S3), s3Connection(&next.S3)},
+		{"cdn.invalidation", previous.CDN.Invalidation, next.CDN.Invalidation},
+		{"auth", previous.Auth, next.Auth},
+		{"rate_limit", rateLimitState(&previous.RateLimit), rateLimitState(&next.RateLimit)},
+		{"history", previous.History, next.History},
+		{"retention", previous.Retention, next.Retention},
+		{"webhook", previous.Webhook, next.Webhook},
+	}
+
+	var sections []string
+	for _, check := range checks {
+		if !reflect.DeepEqual(check.previous, check.next) {
+			sections = append(sections, check.name)
+		}
+	}
+	return sections
+}
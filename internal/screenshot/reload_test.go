@@ -0,0 +1,144 @@
+package screenshot
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"makeprofit/internal/chartservice"
+	"makeprofit/internal/config"
+	"makeprofit/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// reloadConfig 可以创建组件的最小配置
+func reloadConfig(revision, chartURL string) *config.Config {
+	cfg := &config.Config{Revision: revision}
+	cfg.ChartService.BaseURL = chartURL
+	cfg.CDN.BaseURL = "https://cdn.example.com"
+	cfg.RateLimit.UsageFile = "usage.json"
+	return cfg
+}
+
+// newReloadService 创建只包含热更新所需组件的服务
+func newReloadService(t *testing.T, cfg *config.Config) *Service {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	limiter, err := ratelimit.NewLimiter(&config.RateLimitConfig{UsageFile: filepath.Join(t.TempDir(), "usage.json")}, logger)
+	if err != nil {
+		t.Fatalf("NewLimiter() error = %v", err)
+	}
+	t.Cleanup(func() { limiter.Close() })
+
+	s := &Service{refreshTracker: chartservice.NewRefreshTracker(), limiter: limiter, logger: logger}
+	comps, err := newComponents(cfg, nil, s.refreshTracker, logger)
+	if err != nil {
+		t.Fatalf("newComponents() error = %v", err)
+	}
+	s.components.Store(comps)
+	return s
+}
+
+func TestReload(t *testing.T) {
+	s := newReloadService(t, reloadConfig("r1", "http://chart-a:8000"))
+	initial := s.components.Load()
+
+	// 版本相同时不重建组件
+	if err := s.Reload(reloadConfig("r1", "http://chart-a:8000")); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if s.components.Load() != initial {
+		t.Error("Reload() with the same revision replaced the components")
+	}
+
+	// 新配置无效时保留当前配置
+	invalid := reloadConfig("r2", "http://chart-b:8000")
+	invalid.ChartService.ImageMode = "mmap"
+	if err := s.Reload(invalid); err == nil || !strings.Contains(err.Error(), "unknown chart_service.image_mode") {
+		t.Fatalf("Reload() error = %v, want image_mode error", err)
+	}
+	if s.components.Load() != initial {
+		t.Error("invalid config replaced the components")
+	}
+
+	next := reloadConfig("r3", "http://chart-b:8000")
+	next.CDN.BaseURL = "https://cdn2.example.com"
+	if err := s.Reload(next); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	current := s.current(context.Background())
+	if current.config != next || current.chartService == initial.chartService {
+		t.Error("Reload() did not replace the chart service client")
+	}
+	url, err := current.urls.URL(context.Background(), "screenshot/screenshots/NVDA.png")
+	if err != nil || url.URL != "https://cdn2.example.com/screenshots/NVDA.png" {
+		t.Errorf("URL after reload = %v, %v", url, err)
+	}
+}
+
+func TestSnapshotKeepsRequestComponents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newReloadService(t, reloadConfig("r1", "http://chart-a:8000"))
+
+	// 请求进行中发生重载，请求内继续使用开始时的配置
+	var before, after string
+	r := gin.New()
+	r.GET("/", s.snapshot(), func(c *gin.Context) {
+		before = s.current(c.Request.Context()).config.Revision
+		if err := s.Reload(reloadConfig("r2", "http://chart-b:8000")); err != nil {
+			t.Errorf("Reload() error = %v", err)
+		}
+		after = s.current(c.Request.Context()).config.Revision
+		c.Status(http.StatusOK)
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if before != "r1" || after != "r1" {
+		t.Errorf("request saw revisions %s then %s, want r1 throughout", before, after)
+	}
+	if got := s.current(context.Background()).config.Revision; got != "r2" {
+		t.Errorf("latest revision = %s, want r2", got)
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*config.Config)
+		want   string
+	}{
+		{name: "chart service", mutate: func(c *config.Config) { c.ChartService.Timeout = time.Minute }},
+		{name: "cdn url", mutate: func(c *config.Config) { c.CDN.BaseURL = "https://cdn2.example.com" }},
+		{name: "log level", mutate: func(c *config.Config) { c.Logging.Level = "debug" }},
+		{name: "rate limit values", mutate: func(c *config.Config) { c.RateLimit.PerIP.Rate = 5 }},
+		{name: "cache control", mutate: func(c *config.Config) { c.S3.CacheControl = map[string]string{"1d": "no-cache"} }},
+		{name: "server port", mutate: func(c *config.Config) { c.Server.Port = 9090 }, want: "server"},
+		{name: "bucket", mutate: func(c *config.Config) { c.S3.Bucket = "other" }, want: "s3"},
+		{name: "invalidation", mutate: func(c *config.Config) { c.CDN.Invalidation.Mode = "purge" }, want: "cdn.invalidation"},
+		{name: "rate limit toggle", mutate: func(c *config.Config) { c.RateLimit.Enabled = true }, want: "rate_limit"},
+		{
+			name:   "several sections",
+			mutate: func(c *config.Config) { c.Auth.Enabled = true; c.History.Enabled = true },
+			want:   "auth,history",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := reloadConfig("r1", "http://chart-a:8000")
+			next := reloadConfig("r2", "http://chart-a:8000")
+			tt.mutate(next)
+			if got := strings.Join(restartRequired(previous, next), ","); got != tt.want {
+				t.Errorf("restartRequired() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
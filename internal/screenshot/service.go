@@ -2,18 +2,24 @@ package screenshot
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
-	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"makeprofit/internal/apierror"
+	"makeprofit/internal/auth"
+	"makeprofit/internal/cdn"
 	"makeprofit/internal/chartservice"
 	"makeprofit/internal/config"
+	"makeprofit/internal/history"
+	"makeprofit/internal/ratelimit"
+	"makeprofit/internal/retention"
 	"makeprofit/internal/s3"
-	"makeprofit/pkg/utils"
+	"makeprofit/internal/webhook"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -21,346 +27,259 @@ import (
 
 // Service 截图服务
 type Service struct {
-	chartService *chartservice.Client
-	s3Client     *s3.Client
-	config       *config.Config
-	logger       *logrus.Logger
+	components     atomic.Pointer[components]   // 可热更新的配置、图表服务客户端和URL生成器
+	refreshTracker *chartservice.RefreshTracker // K线刷新记录，热更新重建图表服务客户端时保留
+	s3Client       *s3.Client
+	auth           *auth.Authenticator
+	limiter        *ratelimit.Limiter
+	history        *history.Store      // 未启用历史索引时为nil
+	retention      *retention.Manager  // 未启用保留策略时为nil
+	invalidator    *cdn.Invalidator    // 未启用CDN purge时为nil
+	webhooks       *webhook.Dispatcher // 未启用webhook时为nil
+	notifiers      []Notifier
+	logger         *logrus.Logger
 }
 
 // NewService 创建新的截图服务
-func NewService(cfg *config.Config) (*Service, error) {
-	logger := utils.GetLogger()
-
-	// 创建图表服务客户端
-	chartService := chartservice.NewClient(cfg.ChartService.BaseURL)
+// logger由调用方创建并注入，服务内各组件共用同一个日志实例
+func NewService(cfg *config.Config, logger *logrus.Logger) (*Service, error) {
+	// 记录各配置项的生效值和来源，敏感配置已脱敏
+	effective := make(map[string]string, len(cfg.Sources))
+	for _, source := range cfg.Sources {
+		effective[source.Key] = fmt.Sprintf("%s (%s)", source.Value, source.Source)
+	}
+	logger.WithFields(logrus.Fields{
+		"revision": cfg.Revision,
+		"config":   effective,
+	}).Info("Effective configuration")
 
 	// 创建S3客户端
-	s3Client, err := s3.NewClient(&cfg.S3)
+	s3Client, err := s3.NewClient(&cfg.S3, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create S3 client: %w", err)
 	}
 
-	return &Service{
-		chartService: chartService,
-		s3Client:     s3Client,
-		config:       cfg,
-		logger:       logger,
-	}, nil
-}
-
-// ScreenshotRequest 截图请求
-type ScreenshotRequest struct {
-	Symbol    string `json:"symbol" binding:"required"`    // 股票代码，如 "NVDA"
-	Market    string `json:"market" binding:"required"`    // 市场，如 "us", "hk", "cn"
-	Timeframe string `json:"timeframe" binding:"required"` // 时间框架，如 "1d", "1h"
-}
-
-// ScreenshotResponse 截图响应
-type ScreenshotResponse struct {
-	Success    bool   `json:"success"`
-	Message    string `json:"message"`
-	CDNURL     string `json:"cdn_url,omitempty"`
-	S3URL      string `json:"s3_url,omitempty"`
-	DataCDNURL string `json:"data_cdn_url,omitempty"`
-	DataS3URL  string `json:"data_s3_url,omitempty"`
-	Timestamp  string `json:"timestamp"`
-}
-
-// ScreenshotWithDataResponse 带数据的截图响应
-type ScreenshotWithDataResponse struct {
-	Success    bool   `json:"success"`
-	Message    string `json:"message"`
-	CDNURL     string `json:"cdn_url,omitempty"`
-	S3URL      string `json:"s3_url,omitempty"`
-	DataCDNURL string `json:"data_cdn_url,omitempty"`
-	DataS3URL  string `json:"data_s3_url,omitempty"`
-	Timestamp  string `json:"timestamp"`
-}
-
-// TakeScreenshot 截取股票K线图
-func (s *Service) TakeScreenshot(ctx context.Context, req *ScreenshotRequest) (*ScreenshotResponse, error) {
-	s.logger.WithFields(logrus.Fields{
-		"symbol":    req.Symbol,
-		"market":    req.Market,
-		"timeframe": req.Timeframe,
-	}).Info("Taking screenshot using chart service")
-
-	// 格式化股票代码
-	formattedSymbol := s.formatSymbolForMarket(req.Symbol, req.Market)
-
-	// 使用图表服务获取截图
-	chartImage, err := s.chartService.TakeScreenshotWithRefresh(ctx, formattedSymbol, req.Timeframe)
+	// 创建API Key鉴权器
+	authenticator, err := auth.NewAuthenticator(&cfg.Auth)
 	if err != nil {
-		s.logger.WithError(err).Error("Failed to get chart image from chart service")
-		return &ScreenshotResponse{
-			Success:   false,
-			Message:   fmt.Sprintf("Failed to get chart image: %v", err),
-			Timestamp: time.Now().Format(time.RFC3339),
-		}, nil
+		return nil, fmt.Errorf("failed to create authenticator: %w", err)
 	}
 
-	// 同时获取JSON数据（但不返回给用户，只上传到S3）
-	panelData, err := s.chartService.GetPanelData(ctx, formattedSymbol, req.Timeframe)
+	// 创建限流器
+	limiter, err := ratelimit.NewLimiter(&cfg.RateLimit, logger)
 	if err != nil {
-		s.logger.WithError(err).Warn("Failed to get panel data, will continue without JSON data")
+		return nil, fmt.Errorf("failed to create rate limiter: %w", err)
 	}
 
-	// 生成截图文件名
-	screenshotFileName := s.generateScreenshotFileName(req.Symbol, req.Market, req.Timeframe)
-	if screenshotFileName == "" {
-		return &ScreenshotResponse{
-			Success:   false,
-			Message:   "Failed to generate screenshot filename",
-			Timestamp: time.Now().Format(time.RFC3339),
-		}, nil
+	// 创建图表服务客户端和URL生成器
+	refreshTracker := chartservice.NewRefreshTracker()
+	comps, err := newComponents(cfg, s3Client, refreshTracker, logger)
+	if err != nil {
+		return nil, err
 	}
 
-	// 创建临时文件
-	tempDir := os.TempDir()
-	screenshotTempFile := filepath.Join(tempDir, screenshotFileName)
+	// 创建CDN缓存失效器
+	var invalidator *cdn.Invalidator
+	if cfg.CDN.Invalidation.Mode == cdn.InvalidationPurge {
+		invalidator, err = cdn.NewInvalidator(&cfg.CDN.Invalidation, &cfg.S3, comps.urls, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create CDN invalidator: %w", err)
+		}
+	}
 
-	// 写入图片数据到临时文件
-	if err := os.WriteFile(screenshotTempFile, chartImage.Data, 0o644); err != nil {
-		s.logger.WithError(err).Error("Failed to write image to temp file")
-		return &ScreenshotResponse{
-			Success:   false,
-			Message:   fmt.Sprintf("Failed to write image to temp file: %v", err),
-			Timestamp: time.Now().Format(time.RFC3339),
-		}, nil
+	// 打开历史索引
+	var historyStore *history.Store
+	if cfg.History.Enabled {
+		historyStore, err = history.Open(cfg.History.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open history index: %w", err)
+		}
 	}
 
-	// 确保临时文件被清理
-	defer func() {
-		if err := os.Remove(screenshotTempFile); err != nil {
-			s.logger.WithError(err).Warn("Failed to remove screenshot temp file")
+	// 创建保留策略管理器
+	var retentionManager *retention.Manager
+	if cfg.Retention.Enabled {
+		// 删除对象时同步清理历史索引，避免 /history 返回已不存在的URL
+		var index retention.Index
+		if historyStore != nil {
+			index = historyStore
 		}
-	}()
+		retentionManager, err = retention.NewManager(&cfg.Retention, s3Client, index, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create retention manager: %w", err)
+		}
+		retentionManager.Start()
+	}
 
-	// 上传截图到S3
-	uploadResult, err := s.s3Client.UploadScreenshot(ctx, screenshotTempFile, req.Symbol, req.Market, req.Timeframe)
-	if err != nil {
-		s.logger.WithError(err).Error("Failed to upload screenshot to S3")
-		return &ScreenshotResponse{
-			Success:   false,
-			Message:   fmt.Sprintf("Failed to upload to S3: %v", err),
-			Timestamp: time.Now().Format(time.RFC3339),
-		}, nil
-	}
-
-	// 如果有JSON数据，上传到S3并返回URL
-	var jsonResult *s3.UploadResult
-	if panelData != nil && panelData.Success {
-		// 生成JSON文件名
-		jsonFileName := s.generateJSONFileName(req.Symbol, req.Market, req.Timeframe)
-		if jsonFileName != "" {
-			jsonTempFile := filepath.Join(tempDir, jsonFileName)
-
-			// 将JSON数据写入临时文件
-			jsonData, err := json.Marshal(panelData.Data)
-			if err != nil {
-				s.logger.WithError(err).Warn("Failed to marshal JSON data")
-			} else {
-				if err := os.WriteFile(jsonTempFile, jsonData, 0o644); err != nil {
-					s.logger.WithError(err).Warn("Failed to write JSON to temp file")
-				} else {
-					// 确保JSON临时文件被清理
-					defer func() {
-						if err := os.Remove(jsonTempFile); err != nil {
-							s.logger.WithError(err).Warn("Failed to remove JSON temp file")
-						}
-					}()
-
-					// 上传JSON到S3
-					jsonResult, err = s.s3Client.UploadJSONData(ctx, jsonTempFile, req.Symbol, req.Market, req.Timeframe)
-					if err != nil {
-						s.logger.WithError(err).Warn("Failed to upload JSON data to S3")
-					} else {
-						s.logger.WithFields(logrus.Fields{
-							"symbol":    req.Symbol,
-							"market":    req.Market,
-							"timeframe": req.Timeframe,
-							"json_key":  jsonResult.Key,
-						}).Info("JSON data uploaded successfully")
-					}
-				}
-			}
+	// 创建webhook投递器
+	var webhooks *webhook.Dispatcher
+	if cfg.Webhook.Enabled {
+		webhooks, err = webhook.NewDispatcher(&cfg.Webhook, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create webhook dispatcher: %w", err)
 		}
 	}
 
-	s.logger.WithFields(logrus.Fields{
-		"symbol":    req.Symbol,
-		"market":    req.Market,
-		"timeframe": req.Timeframe,
-		"cdn_url":   uploadResult.URL,
-	}).Info("Screenshot completed successfully")
+	service := &Service{
+		refreshTracker: refreshTracker,
+		s3Client:       s3Client,
+		webhooks:       webhooks,
+		invalidator:    invalidator,
+		history:        historyStore,
+		retention:      retentionManager,
+		auth:           authenticator,
+		limiter:        limiter,
+		logger:         logger,
+	}
+	service.components.Store(comps)
+	if webhooks != nil {
+		service.AddNotifier(&webhookNotifier{dispatcher: webhooks})
+	}
 
-	// 生成CDN URL
-	cdnURL := s.generateCDNURL(uploadResult.Key)
+	return service, nil
+}
 
-	response := &ScreenshotResponse{
-		Success:   true,
-		Message:   "Screenshot taken successfully",
-		CDNURL:    cdnURL,
-		S3URL:     uploadResult.Key, // 这里存储S3 key而不是URL
-		Timestamp: time.Now().Format(time.RFC3339),
-	}
+// ScreenshotRequest 截图请求
+type ScreenshotRequest struct {
+	Symbol    string `json:"symbol" binding:"required"`    // 股票代码，如 "NVDA"
+	Market    string `json:"market" binding:"required"`    // 市场，如 "us", "hk", "cn"
+	Timeframe string `json:"timeframe" binding:"required"` // 时间框架，如 "1d", "1h"
 
-	// 如果有JSON数据，添加到响应中
-	if jsonResult != nil {
-		dataCDNURL := s.generateCDNURL(jsonResult.Key)
-		response.DataCDNURL = dataCDNURL
-		response.DataS3URL = jsonResult.Key
-		s.logger.WithFields(logrus.Fields{
-			"symbol":       req.Symbol,
-			"market":       req.Market,
-			"timeframe":    req.Timeframe,
-			"data_cdn_url": dataCDNURL,
-		}).Info("JSON data URL added to response")
-	}
+	// 可选，覆盖配置中的刷新策略：always, never, if_older_than, required
+	RefreshPolicy string `json:"refresh_policy,omitempty"`
+	// 可选，if_older_than 策略的刷新间隔（分钟）
+	RefreshMaxAgeMinutes int `json:"refresh_max_age_minutes,omitempty"`
 
-	return response, nil
+	// 可选，要执行的流水线阶段，如 ["render", "store"]，未指定时执行全部阶段
+	Stages []string `json:"stages,omitempty"`
+
+	// 可选，截图完成或失败后接收webhook通知的地址，需启用 webhook.allow_callback_url
+	CallbackURL string `json:"callback_url,omitempty"`
 }
 
-// TakeScreenshotWithData 截取股票K线图并下载JSON数据
-func (s *Service) TakeScreenshotWithData(ctx context.Context, req *ScreenshotRequest) (*ScreenshotWithDataResponse, error) {
-	s.logger.WithFields(logrus.Fields{
-		"symbol":    req.Symbol,
-		"market":    req.Market,
-		"timeframe": req.Timeframe,
-	}).Info("Taking screenshot with data using chart service")
+// 股票代码、市场和时间框架会拼进图表服务的URL、S3 key和历史索引key，只允许固定格式
+var (
+	symbolPattern    = regexp.MustCompile(`^[A-Za-z0-9.^=_-]{1,32}$`)
+	marketPattern    = regexp.MustCompile(`^[A-Za-z]{2,8}$`)
+	timeframePattern = regexp.MustCompile(`^[0-9]{1,3}(m|h|d|wk|mo|y)$`)
+)
 
-	// 格式化股票代码
-	formattedSymbol := s.formatSymbolForMarket(req.Symbol, req.Market)
+// validate 校验股票代码、市场和时间框架格式
+func (r *ScreenshotRequest) validate() error {
+	if !symbolPattern.MatchString(r.Symbol) {
+		return apierror.New(apierror.CodeInvalidSymbol, fmt.Sprintf("Invalid symbol %q", r.Symbol))
+	}
+	if !marketPattern.MatchString(r.Market) {
+		return apierror.New(apierror.CodeInvalidRequest, fmt.Sprintf("Invalid market %q", r.Market))
+	}
+	if !timeframePattern.MatchString(r.Timeframe) {
+		return apierror.New(apierror.CodeInvalidRequest, fmt.Sprintf("Invalid timeframe %q", r.Timeframe))
+	}
+	return nil
+}
 
-	// 1. 获取截图
-	chartImage, err := s.chartService.TakeScreenshotWithRefresh(ctx, formattedSymbol, req.Timeframe)
+// refreshOptions 解析请求中的刷新策略，未指定时返回nil使用配置默认值
+func (r *ScreenshotRequest) refreshOptions() (*chartservice.RefreshOptions, error) {
+	policy, err := chartservice.ParseRefreshPolicy(r.RefreshPolicy)
 	if err != nil {
-		s.logger.WithError(err).Error("Failed to get chart image from chart service")
-		return &ScreenshotWithDataResponse{
-			Success:   false,
-			Message:   fmt.Sprintf("Failed to get chart image: %v", err),
-			Timestamp: time.Now().Format(time.RFC3339),
-		}, nil
+		return nil, err
+	}
+	if policy == "" {
+		return nil, nil
+	}
+	if r.RefreshMaxAgeMinutes < 0 {
+		return nil, fmt.Errorf("refresh_max_age_minutes must not be negative")
 	}
 
-	// 2. 获取JSON数据
-	panelData, err := s.chartService.GetPanelData(ctx, formattedSymbol, req.Timeframe)
-	if err != nil {
-		s.logger.WithError(err).Warn("Failed to get panel data, will continue without JSON data")
+	return &chartservice.RefreshOptions{
+		Policy: policy,
+		MaxAge: time.Duration(r.RefreshMaxAgeMinutes) * time.Minute,
+	}, nil
+}
+
+// screenshotRequestFromParams 从路径参数和查询参数构建截图请求
+func screenshotRequestFromParams(c *gin.Context) (*ScreenshotRequest, error) {
+	req := &ScreenshotRequest{
+		Symbol:        c.Param("symbol"),
+		Market:        c.Param("market"),
+		Timeframe:     c.Param("timeframe"),
+		RefreshPolicy: c.Query("refresh_policy"),
 	}
 
-	// 生成截图文件名
-	screenshotFileName := s.generateScreenshotFileName(req.Symbol, req.Market, req.Timeframe)
-	if screenshotFileName == "" {
-		return &ScreenshotWithDataResponse{
-			Success:   false,
-			Message:   "Failed to generate screenshot filename",
-			Timestamp: time.Now().Format(time.RFC3339),
-		}, nil
+	if req.Symbol == "" || req.Market == "" || req.Timeframe == "" {
+		return nil, fmt.Errorf("Missing required parameters: symbol, market, timeframe")
 	}
 
-	// 创建临时文件
-	tempDir := os.TempDir()
-	screenshotTempFile := filepath.Join(tempDir, screenshotFileName)
+	if maxAge := c.Query("refresh_max_age_minutes"); maxAge != "" {
+		minutes, err := strconv.Atoi(maxAge)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid refresh_max_age_minutes: %v", err)
+		}
+		req.RefreshMaxAgeMinutes = minutes
+	}
 
-	// 写入图片数据到临时文件
-	if err := os.WriteFile(screenshotTempFile, chartImage.Data, 0o644); err != nil {
-		s.logger.WithError(err).Error("Failed to write image to temp file")
-		return &ScreenshotWithDataResponse{
-			Success:   false,
-			Message:   fmt.Sprintf("Failed to write image to temp file: %v", err),
-			Timestamp: time.Now().Format(time.RFC3339),
-		}, nil
+	if stages := c.Query("stages"); stages != "" {
+		req.Stages = strings.Split(stages, ",")
 	}
+	req.CallbackURL = c.Query("callback_url")
 
-	// 确保临时文件被清理
-	defer func() {
-		if err := os.Remove(screenshotTempFile); err != nil {
-			s.logger.WithError(err).Warn("Failed to remove screenshot temp file")
-		}
-	}()
+	return req, nil
+}
 
-	// 上传截图到S3
-	screenshotResult, err := s.s3Client.UploadScreenshot(ctx, screenshotTempFile, req.Symbol, req.Market, req.Timeframe)
+// ScreenshotResponse 截图响应
+type ScreenshotResponse struct {
+	Success     bool   `json:"success"`
+	Message     string `json:"message"`
+	CDNURL      string `json:"cdn_url,omitempty"`
+	S3URL       string `json:"s3_url,omitempty"`
+	DataCDNURL  string `json:"data_cdn_url,omitempty"`
+	DataS3URL   string `json:"data_s3_url,omitempty"`
+	ImageWidth  int    `json:"image_width,omitempty"`
+	ImageHeight int    `json:"image_height,omitempty"`
+	ExpiresAt   string `json:"expires_at,omitempty"` // 签名URL的过期时间
+	ImageSHA256 string `json:"image_sha256,omitempty"`
+	DataSHA256  string `json:"data_sha256,omitempty"`
+	// 内容寻址存储下的不可变URL，以及内容是否与上次截图相同
+	ContentCDNURL string `json:"content_cdn_url,omitempty"`
+	Unchanged     bool   `json:"unchanged,omitempty"`
+	Timestamp     string `json:"timestamp"`
+}
+
+// ScreenshotWithDataResponse 带数据的截图响应，与 ScreenshotResponse 相同，保留以兼容旧代码
+type ScreenshotWithDataResponse = ScreenshotResponse
+
+// TakeScreenshot 截取股票K线图，执行请求选择的流水线阶段
+func (s *Service) TakeScreenshot(ctx context.Context, req *ScreenshotRequest) (*ScreenshotResponse, error) {
+	return s.Capture(ctx, req)
+}
+
+// TakeScreenshotWithData 截取股票K线图并上传JSON数据，与 TakeScreenshot 相同，仅响应消息不同
+func (s *Service) TakeScreenshotWithData(ctx context.Context, req *ScreenshotRequest) (*ScreenshotWithDataResponse, error) {
+	response, err := s.Capture(ctx, req)
 	if err != nil {
-		s.logger.WithError(err).Error("Failed to upload screenshot to S3")
-		return &ScreenshotWithDataResponse{
-			Success:   false,
-			Message:   fmt.Sprintf("Failed to upload screenshot to S3: %v", err),
-			Timestamp: time.Now().Format(time.RFC3339),
-		}, nil
-	}
-
-	s.logger.WithFields(logrus.Fields{
-		"symbol":    req.Symbol,
-		"market":    req.Market,
-		"timeframe": req.Timeframe,
-		"cdn_url":   screenshotResult.URL,
-	}).Info("Screenshot with data completed successfully")
-
-	// 生成CDN URL
-	cdnURL := s.generateCDNURL(screenshotResult.Key)
-
-	response := &ScreenshotWithDataResponse{
-		Success:   true,
-		Message:   "Screenshot with data taken successfully",
-		CDNURL:    cdnURL,
-		S3URL:     screenshotResult.Key, // 这里存储S3 key而不是URL
-		Timestamp: time.Now().Format(time.RFC3339),
-	}
-
-	// 如果有JSON数据，上传到S3
-	if panelData != nil && panelData.Success {
-		// 生成JSON文件名
-		jsonFileName := s.generateJSONFileName(req.Symbol, req.Market, req.Timeframe)
-		if jsonFileName != "" {
-			jsonTempFile := filepath.Join(tempDir, jsonFileName)
-
-			// 将JSON数据写入临时文件
-			jsonData, err := json.Marshal(panelData.Data)
-			if err != nil {
-				s.logger.WithError(err).Warn("Failed to marshal JSON data")
-			} else {
-				if err := os.WriteFile(jsonTempFile, jsonData, 0o644); err != nil {
-					s.logger.WithError(err).Warn("Failed to write JSON to temp file")
-				} else {
-					// 确保JSON临时文件被清理
-					defer func() {
-						if err := os.Remove(jsonTempFile); err != nil {
-							s.logger.WithError(err).Warn("Failed to remove JSON temp file")
-						}
-					}()
-
-					// 上传JSON到S3
-					jsonResult, err := s.s3Client.UploadJSONData(ctx, jsonTempFile, req.Symbol, req.Market, req.Timeframe)
-					if err != nil {
-						s.logger.WithError(err).Warn("Failed to upload JSON data to S3")
-					} else {
-						dataCDNURL := s.generateCDNURL(jsonResult.Key)
-						response.DataCDNURL = dataCDNURL
-						response.DataS3URL = jsonResult.Key
-						s.logger.WithFields(logrus.Fields{
-							"symbol":       req.Symbol,
-							"market":       req.Market,
-							"timeframe":    req.Timeframe,
-							"data_cdn_url": dataCDNURL,
-						}).Info("JSON data uploaded successfully")
-					}
-				}
-			}
-		}
+		return nil, err
 	}
-
+	response.Message = "Screenshot with data taken successfully"
 	return response, nil
 }
 
 // SetupRoutes 设置路由
 func (s *Service) SetupRoutes(r *gin.Engine) {
+	// gin默认信任所有代理，客户端可以伪造 X-Forwarded-For 绕过按IP的限流和配额
+	trustedProxies := s.current(context.Background()).config.Server.TrustedProxies
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		s.logger.WithError(err).Error("Invalid server.trusted_proxies, not trusting any proxy")
+		r.SetTrustedProxies(nil)
+	}
+
+	// 请求ID和访问日志，对所有路由生效
+	r.Use(s.requestID(), s.accessLog())
+
 	// 健康检查 - 支持GET和HEAD请求
 	r.GET("/health", func(c *gin.Context) {
 		// 检查图表服务是否可用
 		chartServiceStatus := "healthy"
-		if s.chartService != nil {
+		if s.current(c.Request.Context()).chartService != nil {
 			// 可以添加图表服务的健康检查逻辑
 			chartServiceStatus = "available"
 		}
@@ -377,165 +296,97 @@ func (s *Service) SetupRoutes(r *gin.Engine) {
 	})
 
 	// API路由组
-	api := r.Group("/api/v1")
+	// 按IP限流放在鉴权之前，使用无效API Key的请求同样受限
+	api := r.Group("/api/v1", s.snapshot(), s.limiter.IPMiddleware())
 	{
-		// 截图API
-		api.POST("/screenshot", s.handleScreenshot)
-		api.GET("/screenshot/:symbol/:market/:timeframe", s.handleScreenshotGet)
-
-		// 带数据的截图API
-		api.POST("/screenshot-with-data", s.handleScreenshotWithData)
-		api.GET("/screenshot-with-data/:symbol/:market/:timeframe", s.handleScreenshotWithDataGet)
+		// 截图API，stages参数可选择要执行的流水线阶段
+		capture := s.handleCapture(s.Capture)
+		api.POST("/capture", s.auth.Middleware(auth.ScopeScreenshot), s.limiter.Middleware(), capture)
+		api.GET("/capture/:symbol/:market/:timeframe", s.auth.Middleware(auth.ScopeScreenshot), s.limiter.Middleware(), capture)
+
+		// 兼容旧版本的别名
+		screenshot := s.handleCapture(s.TakeScreenshot)
+		api.POST("/screenshot", s.auth.Middleware(auth.ScopeScreenshot), s.limiter.Middleware(), screenshot)
+		api.GET("/screenshot/:symbol/:market/:timeframe", s.auth.Middleware(auth.ScopeScreenshot), s.limiter.Middleware(), screenshot)
+
+		withData := s.handleCapture(s.TakeScreenshotWithData)
+		api.POST("/screenshot-with-data", s.auth.Middleware(auth.ScopeData), s.limiter.Middleware(), withData)
+		api.GET("/screenshot-with-data/:symbol/:market/:timeframe", s.auth.Middleware(auth.ScopeData), s.limiter.Middleware(), withData)
+
+		// 历史记录API
+		api.GET("/history", s.auth.Middleware(auth.ScopeData), s.handleHistory)
+
+		// 存储列举API
+		api.GET("/artifacts/:market/:symbol", s.auth.Middleware(auth.ScopeData), s.handleArtifacts)
+
+		// 管理API
+		admin := api.Group("/admin", s.auth.Middleware(auth.ScopeAdmin))
+		{
+			admin.POST("/retention/run", s.handleRetentionRun)
+			admin.GET("/webhooks/deliveries", s.handleWebhookDeliveries)
+		}
 
 		// 状态监控API
-		api.GET("/status", func(c *gin.Context) {
+		api.GET("/status", s.auth.Middleware(""), func(c *gin.Context) {
+			comps := s.current(c.Request.Context())
+
 			// 图表服务状态
 			chartServiceStatus := "unavailable"
-			if s.chartService != nil {
+			if comps.chartService != nil {
 				chartServiceStatus = "available"
 			}
 
 			c.JSON(http.StatusOK, gin.H{
 				"chart_service_status": chartServiceStatus,
-				"chart_service_url":    s.config.ChartService.BaseURL,
+				"chart_service_url":    comps.config.ChartService.BaseURL,
+				"config_revision":      comps.config.Revision,
+				"config_loaded_at":     comps.loadedAt.Format(time.RFC3339),
 				"timestamp":            time.Now().Format(time.RFC3339),
 			})
 		})
 	}
 }
 
-// handleScreenshot POST /api/v1/screenshot
-func (s *Service) handleScreenshot(c *gin.Context) {
-	var req ScreenshotRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ScreenshotResponse{
-			Success:   false,
-			Message:   fmt.Sprintf("Invalid request: %v", err),
-			Timestamp: time.Now().Format(time.RFC3339),
-		})
-		return
-	}
+// handleCapture 截图接口，POST从JSON请求体读取参数，GET从路径和查询参数读取
+// /screenshot 和 /screenshot-with-data 是 /capture 的别名，仅响应消息不同
+func (s *Service) handleCapture(capture func(context.Context, *ScreenshotRequest) (*ScreenshotResponse, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req, err := captureRequest(c)
+		if err != nil {
+			apierror.Abort(c, err)
+			return
+		}
 
-	response, err := s.TakeScreenshot(c.Request.Context(), &req)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ScreenshotResponse{
-			Success:   false,
-			Message:   fmt.Sprintf("Internal server error: %v", err),
-			Timestamp: time.Now().Format(time.RFC3339),
-		})
-		return
-	}
+		if !auth.MarketAllowed(c, req.Market) {
+			apierror.Abort(c, marketForbidden(req.Market))
+			return
+		}
+
+		response, err := capture(c.Request.Context(), req)
+		if err != nil {
+			apierror.Abort(c, err)
+			return
+		}
 
-	if response.Success {
 		c.JSON(http.StatusOK, response)
-	} else {
-		c.JSON(http.StatusBadRequest, response)
 	}
 }
 
-// handleScreenshotGet GET /api/v1/screenshot/:symbol/:market/:timeframe
-func (s *Service) handleScreenshotGet(c *gin.Context) {
-	symbol := c.Param("symbol")
-	market := c.Param("market")
-	timeframe := c.Param("timeframe")
-
-	if symbol == "" || market == "" || timeframe == "" {
-		c.JSON(http.StatusBadRequest, ScreenshotResponse{
-			Success:   false,
-			Message:   "Missing required parameters: symbol, market, timeframe",
-			Timestamp: time.Now().Format(time.RFC3339),
-		})
-		return
-	}
-
-	req := &ScreenshotRequest{
-		Symbol:    symbol,
-		Market:    market,
-		Timeframe: timeframe,
-	}
-
-	response, err := s.TakeScreenshot(c.Request.Context(), req)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ScreenshotResponse{
-			Success:   false,
-			Message:   fmt.Sprintf("Internal server error: %v", err),
-			Timestamp: time.Now().Format(time.RFC3339),
-		})
-		return
-	}
-
-	if response.Success {
-		c.JSON(http.StatusOK, response)
-	} else {
-		c.JSON(http.StatusBadRequest, response)
+// captureRequest 按请求方法解析截图请求
+func captureRequest(c *gin.Context) (*ScreenshotRequest, error) {
+	if c.Request.Method == http.MethodGet {
+		req, err := screenshotRequestFromParams(c)
+		if err != nil {
+			return nil, invalidRequest(err)
+		}
+		return req, nil
 	}
-}
 
-// handleScreenshotWithData POST /api/v1/screenshot-with-data
-func (s *Service) handleScreenshotWithData(c *gin.Context) {
 	var req ScreenshotRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ScreenshotWithDataResponse{
-			Success:   false,
-			Message:   fmt.Sprintf("Invalid request: %v", err),
-			Timestamp: time.Now().Format(time.RFC3339),
-		})
-		return
-	}
-
-	response, err := s.TakeScreenshotWithData(c.Request.Context(), &req)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ScreenshotWithDataResponse{
-			Success:   false,
-			Message:   fmt.Sprintf("Internal server error: %v", err),
-			Timestamp: time.Now().Format(time.RFC3339),
-		})
-		return
-	}
-
-	if response.Success {
-		c.JSON(http.StatusOK, response)
-	} else {
-		c.JSON(http.StatusBadRequest, response)
-	}
-}
-
-// handleScreenshotWithDataGet GET /api/v1/screenshot-with-data/:symbol/:market/:timeframe
-func (s *Service) handleScreenshotWithDataGet(c *gin.Context) {
-	symbol := c.Param("symbol")
-	market := c.Param("market")
-	timeframe := c.Param("timeframe")
-
-	if symbol == "" || market == "" || timeframe == "" {
-		c.JSON(http.StatusBadRequest, ScreenshotWithDataResponse{
-			Success:   false,
-			Message:   "Missing required parameters: symbol, market, timeframe",
-			Timestamp: time.Now().Format(time.RFC3339),
-		})
-		return
-	}
-
-	req := &ScreenshotRequest{
-		Symbol:    symbol,
-		Market:    market,
-		Timeframe: timeframe,
-	}
-
-	response, err := s.TakeScreenshotWithData(c.Request.Context(), req)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ScreenshotWithDataResponse{
-			Success:   false,
-			Message:   fmt.Sprintf("Internal server error: %v", err),
-			Timestamp: time.Now().Format(time.RFC3339),
-		})
-		return
-	}
-
-	if response.Success {
-		c.JSON(http.StatusOK, response)
-	} else {
-		c.JSON(http.StatusBadRequest, response)
+		return nil, invalidRequest(err)
 	}
+	return &req, nil
 }
 
 // formatSymbolForMarket 根据市场类型格式化股票代码
@@ -561,70 +412,52 @@ func (s *Service) formatSymbolForMarket(symbol, market string) string {
 	}
 }
 
-// generateScreenshotFileName 生成截图文件名
-func (s *Service) generateScreenshotFileName(symbol, market, timeframe string) string {
-	now := time.Now()
-
-	switch timeframe {
-	case "1d":
-		// 日线：同一天内一支股票只有一张，格式：{symbol}_{market}_1d_{date}.png
-		return fmt.Sprintf("%s_%s_1d_%s.png", symbol, market, now.Format("20060102"))
-	case "1h":
-		// 小时线：{symbol}_{market}_1h_{date}_{hour}.png
-		return fmt.Sprintf("%s_%s_1h_%s_%02d.png", symbol, market, now.Format("20060102"), now.Hour())
-	case "1wk":
-		// 周线：同一周内一支股票只有一张，格式：{symbol}_{market}_1wk_{year}_{week}.png
-		year, week := now.ISOWeek()
-		return fmt.Sprintf("%s_%s_1wk_%d_%02d.png", symbol, market, year, week)
-	default:
-		// 其他时间框架使用时间戳（保持向后兼容）
-		return fmt.Sprintf("%s_%s_%s_%s.png", symbol, market, timeframe, now.Format("20060102_150405"))
+// generateCDNURL 生成对象的访问URL，签名URL同时返回过期时间（永久有效时为零值）
+// version为内容哈希，cdn.invalidation.mode 为 version 时取前12位追加到URL上
+func (s *Service) generateCDNURL(ctx context.Context, s3Key, version string) (string, time.Time) {
+	if len(version) > 12 {
+		version = version[:12]
 	}
-}
-
-// generateJSONFileName 生成JSON文件名
-func (s *Service) generateJSONFileName(symbol, market, timeframe string) string {
-	now := time.Now()
-
-	switch timeframe {
-	case "1d":
-		// 日线：同一天内一支股票只有一张，格式：{symbol}_{market}_1d_{date}.json
-		return fmt.Sprintf("%s_%s_1d_%s.json", symbol, market, now.Format("20060102"))
-	case "1h":
-		// 小时线：{symbol}_{market}_1h_{date}_{hour}.json
-		return fmt.Sprintf("%s_%s_1h_%s_%02d.json", symbol, market, now.Format("20060102"), now.Hour())
-	case "1wk":
-		// 周线：同一周内一支股票只有一张，格式：{symbol}_{market}_1wk_{year}_{week}.json
-		year, week := now.ISOWeek()
-		return fmt.Sprintf("%s_%s_1wk_%d_%02d.json", symbol, market, year, week)
-	default:
-		// 其他时间框架使用时间戳（保持向后兼容）
-		return fmt.Sprintf("%s_%s_%s_%s.json", symbol, market, timeframe, now.Format("20060102_150405"))
+	signed, err := s.current(ctx).urls.VersionedURL(ctx, s3Key, version)
+	if err != nil {
+		s.log(ctx).WithError(err).WithField("s3_key", s3Key).Error("Failed to generate CDN URL")
+		return "", time.Time{}
 	}
+	return signed.URL, signed.ExpiresAt
 }
 
-// generateCDNURL 生成CDN URL
-func (s *Service) generateCDNURL(s3Key string) string {
-	// 如果CDN配置为空，返回S3 URL
-	if s.config.CDN.BaseURL == "" || s.config.CDN.BaseURL == "https://your-cdn-domain.com" {
-		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s",
-			s.config.S3.Bucket, s.config.S3.Region, s3Key)
-	}
-
-	// 从S3 key中提取文件名部分（去掉screenshot/前缀）
-	// S3 key格式: screenshot/screenshots/PDD_us_1h_20250808_01.png
-	// 我们需要提取: screenshots/PDD_us_1h_20250808_01.png
-	fileName := s3Key
-	if strings.HasPrefix(s3Key, "screenshot/") {
-		fileName = strings.TrimPrefix(s3Key, "screenshot/")
+// formatExpiresAt 格式化URL过期时间，永久有效时返回空字符串
+func formatExpiresAt(t time.Time) string {
+	if t.IsZero() {
+		return ""
 	}
-
-	// 生成CDN URL
-	return fmt.Sprintf("%s/%s", s.config.CDN.BaseURL, fileName)
+	return t.Format(time.RFC3339)
 }
 
 // Close 关闭服务
 func (s *Service) Close() {
-	// 由于不再使用浏览器服务，这里不需要关闭任何资源
+	// 持久化限流用量
+	if err := s.limiter.Close(); err != nil {
+		s.logger.WithError(err).Warn("Failed to persist rate limit usage")
+	}
+	// 停止定期清理
+	if s.retention != nil {
+		s.retention.Close()
+	}
+	// 发送剩余的CDN缓存清除请求
+	if s.invalidator != nil {
+		s.invalidator.Close()
+	}
+	// 等待进行中的webhook投递
+	if s.webhooks != nil {
+		s.webhooks.Close()
+	}
+
+	// 关闭历史索引
+	if s.history != nil {
+		if err := s.history.Close(); err != nil {
+			s.logger.WithError(err).Warn("Failed to close history index")
+		}
+	}
 	s.logger.Info("Screenshot service closed")
 }
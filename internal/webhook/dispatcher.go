@@ -0,0 +1,337 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"makeprofit/internal/config"
+	"makeprofit/pkg/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 事件类型
+const (
+	EventCompleted = "capture.completed"
+	EventFailed    = "capture.failed"
+)
+
+// 投递请求头，接收方用 HMAC-SHA256(secret, timestamp + "." + body) 校验签名
+const (
+	SignatureHeader = "X-Webhook-Signature" // sha256=<hex>
+	TimestampHeader = "X-Webhook-Timestamp" // Unix秒，每次重试重新签名
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+const (
+	defaultMaxAttempts    = 5
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = time.Minute
+	defaultTimeout        = 10 * time.Second
+	defaultQueueSize      = 100
+	defaultLogSize        = 1000
+)
+
+// Envelope 投递的JSON消息体
+type Envelope struct {
+	ID        string      `json:"id"` // 事件ID，同一事件投递到多个地址时相同
+	Event     string      `json:"event"`
+	RequestID string      `json:"request_id,omitempty"`
+	Timestamp string      `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// endpoint 全局配置的webhook地址
+type endpoint struct {
+	url    string
+	secret string
+	events map[string]bool // 为空时接收全部事件
+}
+
+// Dispatcher 异步投递webhook，失败时按指数退避重试
+type Dispatcher struct {
+	endpoints      []endpoint
+	secret         string
+	allowCallback  bool
+	callbackHosts  map[string]bool
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	timeout        time.Duration
+	client         *http.Client // 投递到全局配置的地址
+	callbackClient *http.Client // 投递到callback_url，只允许公网地址
+	log            *deliveryLog
+	logger         *logrus.Logger
+
+	slots    chan struct{} // 限制同时进行中的投递数
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewDispatcher 创建webhook投递器
+func NewDispatcher(cfg *config.WebhookConfig, logger *logrus.Logger) (*Dispatcher, error) {
+	d := &Dispatcher{
+		secret:         cfg.Secret,
+		allowCallback:  cfg.AllowCallbackURL,
+		callbackHosts:  make(map[string]bool, len(cfg.CallbackHosts)),
+		maxAttempts:    cfg.MaxAttempts,
+		initialBackoff: cfg.InitialBackoff,
+		maxBackoff:     cfg.MaxBackoff,
+		timeout:        cfg.Timeout,
+		logger:         logger,
+		stop:           make(chan struct{}),
+	}
+	if d.maxAttempts <= 0 {
+		d.maxAttempts = defaultMaxAttempts
+	}
+	if d.initialBackoff <= 0 {
+		d.initialBackoff = defaultInitialBackoff
+	}
+	if d.maxBackoff <= 0 {
+		d.maxBackoff = defaultMaxBackoff
+	}
+	if d.timeout <= 0 {
+		d.timeout = defaultTimeout
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	logSize := cfg.LogSize
+	if logSize <= 0 {
+		logSize = defaultLogSize
+	}
+	d.slots = make(chan struct{}, queueSize)
+	d.log = newDeliveryLog(logSize)
+	d.client = newClient(false)
+	d.callbackClient = newClient(true)
+
+	for _, host := range cfg.CallbackHosts {
+		d.callbackHosts[strings.ToLower(host)] = true
+	}
+
+	for i, cfgEndpoint := range cfg.Endpoints {
+		secret := cfgEndpoint.Secret
+		if secret == "" {
+			secret = cfg.Secret
+		}
+		if cfgEndpoint.URL == "" || secret == "" {
+			return nil, fmt.Errorf("webhook.endpoints[%d] requires url and secret", i)
+		}
+		ep := endpoint{url: cfgEndpoint.URL, secret: secret, events: make(map[string]bool)}
+		for _, event := range cfgEndpoint.Events {
+			ep.events[event] = true
+		}
+		d.endpoints = append(d.endpoints, ep)
+	}
+
+	return d, nil
+}
+
+// ValidateCallbackURL 校验请求级回调地址
+func (d *Dispatcher) ValidateCallbackURL(raw string) error {
+	if !d.allowCallback {
+		return fmt.Errorf("callback_url is not enabled")
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("callback_url must be an absolute http(s) URL")
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if !d.callbackHosts[host] {
+		return fmt.Errorf("callback_url host %s is not allowed", host)
+	}
+	if ip := net.ParseIP(host); ip != nil && blockedIP(ip) {
+		return fmt.Errorf("callback_url host %s is not allowed", host)
+	}
+	return nil
+}
+
+// Dispatch 将事件投递到订阅该事件的全局地址和callbackURL，不阻塞调用方
+// callbackURL需先通过 ValidateCallbackURL 校验，为空时只投递到全局地址
+func (d *Dispatcher) Dispatch(event, requestID, callbackURL string, data interface{}) {
+	envelope := Envelope{
+		ID:        utils.NewRequestID(),
+		Event:     event,
+		RequestID: requestID,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Data:      data,
+	}
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		d.logger.WithError(err).WithField("event", event).Error("Failed to encode webhook payload")
+		return
+	}
+
+	for _, ep := range d.endpoints {
+		if len(ep.events) == 0 || ep.events[event] {
+			d.enqueue(envelope, ep.url, ep.secret, body, d.client)
+		}
+	}
+	if callbackURL != "" {
+		d.enqueue(envelope, callbackURL, d.secret, body, d.callbackClient)
+	}
+}
+
+// enqueue 创建投递记录并在后台投递，进行中的投递达到上限时直接记为失败
+func (d *Dispatcher) enqueue(envelope Envelope, target, secret string, body []byte, client *http.Client) {
+	delivery := d.log.add(&Delivery{
+		ID:        utils.NewRequestID(),
+		EventID:   envelope.ID,
+		Event:     envelope.Event,
+		URL:       target,
+		RequestID: envelope.RequestID,
+		Status:    StatusPending,
+		CreatedAt: time.Now(),
+	})
+
+	select {
+	case d.slots <- struct{}{}:
+	default:
+		d.log.finish(delivery, StatusFailed, "delivery queue is full")
+		d.logger.WithFields(logrus.Fields{
+			"delivery_id": delivery.ID,
+			"url":         target,
+			"request_id":  envelope.RequestID,
+		}).Warn("Webhook delivery queue is full, dropping delivery")
+		return
+	}
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer func() { <-d.slots }()
+		d.deliver(delivery, secret, body, client)
+	}()
+}
+
+// deliver 投递并按指数退避重试，2xx视为成功，除408和429外的4xx不重试
+func (d *Dispatcher) deliver(delivery *Delivery, secret string, body []byte, client *http.Client) {
+	fields := logrus.Fields{
+		"delivery_id": delivery.ID,
+		"event":       delivery.Event,
+		"url":         delivery.URL,
+		"request_id":  delivery.RequestID,
+	}
+
+	for attempt := 1; ; attempt++ {
+		statusCode, err := d.send(delivery, secret, body, client)
+		if err == nil {
+			d.log.finish(delivery, StatusSucceeded, "")
+			d.logger.WithFields(fields).WithField("attempts", attempt).Info("Webhook delivered")
+			return
+		}
+
+		retryable := statusCode == 0 || statusCode >= 500 || statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests
+		if !retryable || attempt >= d.maxAttempts {
+			d.log.finish(delivery, StatusFailed, err.Error())
+			d.logger.WithError(err).WithFields(fields).WithField("attempts", attempt).Error("Webhook delivery failed")
+			return
+		}
+
+		backoff := d.retryDelay(attempt)
+		d.logger.WithError(err).WithFields(fields).WithFields(logrus.Fields{
+			"attempt":  attempt,
+			"retry_in": backoff.String(),
+		}).Warn("Webhook delivery attempt failed, will retry")
+
+		select {
+		case <-d.stop:
+			d.log.finish(delivery, StatusFailed, "dispatcher closed before retry")
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// retryDelay 第attempt次尝试失败后的等待时间，从initialBackoff开始每次翻倍，不超过maxBackoff
+func (d *Dispatcher) retryDelay(attempt int) time.Duration {
+	backoff := d.initialBackoff
+	for i := 1; i < attempt && backoff < d.maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, d.maxBackoff)
+}
+
+// send 签名并发送一次，返回HTTP状态码（网络错误时为0）
+func (d *Dispatcher) send(delivery *Delivery, secret string, body []byte, client *http.Client) (int, error) {
+	start := time.Now()
+	timestamp := strconv.FormatInt(start.Unix(), 10)
+
+	statusCode, err := func() (int, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+		if err != nil {
+			return 0, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(EventHeader, delivery.Event)
+		req.Header.Set(DeliveryHeader, delivery.ID)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, "sha256="+Sign(secret, timestamp, body))
+		if delivery.RequestID != "" {
+			req.Header.Set(utils.RequestIDHeader, delivery.RequestID)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, fmt.Errorf("failed to make request: %w", err)
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return resp.StatusCode, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+		}
+		return resp.StatusCode, nil
+	}()
+
+	attempt := Attempt{
+		At:         start,
+		StatusCode: statusCode,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	d.log.addAttempt(delivery, attempt)
+
+	return statusCode, err
+}
+
+// Sign 计算 HMAC-SHA256(secret, timestamp + "." + body) 的十六进制签名
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Deliveries 按时间倒序返回最近的投递记录，status为空时返回全部状态
+func (d *Dispatcher) Deliveries(status string, limit int) []Delivery {
+	return d.log.list(status, limit)
+}
+
+// Close 停止等待中的重试，并等待进行中的投递完成
+func (d *Dispatcher) Close() {
+	d.stopOnce.Do(func() { close(d.stop) })
+	d.wg.Wait()
+}
@@ -0,0 +1,302 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"makeprofit/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// waitFinished 等待所有投递（含重试）结束后关闭投递器；Close会取消等待中的重试，不能直接调用
+func waitFinished(t *testing.T, d *Dispatcher) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(d.Deliveries(StatusPending, 100)) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("webhook deliveries did not finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	d.Close()
+}
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		secret    string
+		timestamp string
+		body      string
+	}{
+		{secret: "s3cret", timestamp: "1722240000", body: `{"event":"capture.completed"}`},
+		{secret: "s3cret", timestamp: "1722240001", body: `{"event":"capture.completed"}`},
+		{secret: "other", timestamp: "1722240000", body: `{"event":"capture.completed"}`},
+		{secret: "s3cret", timestamp: "1722240000", body: ""},
+	}
+	seen := make(map[string]bool)
+	for _, tt := range tests {
+		// 接收方按文档的方式独立计算签名
+		mac := hmac.New(sha256.New, []byte(tt.secret))
+		mac.Write([]byte(tt.timestamp + "." + tt.body))
+		want := hex.EncodeToString(mac.Sum(nil))
+
+		got := Sign(tt.secret, tt.timestamp, []byte(tt.body))
+		if got != want {
+			t.Errorf("Sign(%q, %q, %q) = %s, want %s", tt.secret, tt.timestamp, tt.body, got, want)
+		}
+		if seen[got] {
+			t.Errorf("Sign(%q, %q, %q) collides with another input", tt.secret, tt.timestamp, tt.body)
+		}
+		seen[got] = true
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	d := &Dispatcher{initialBackoff: time.Second, maxBackoff: 10 * time.Second}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: time.Second},
+		{attempt: 2, want: 2 * time.Second},
+		{attempt: 3, want: 4 * time.Second},
+		{attempt: 4, want: 8 * time.Second},
+		{attempt: 5, want: 10 * time.Second},
+		{attempt: 100, want: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := d.retryDelay(tt.attempt); got != tt.want {
+			t.Errorf("retryDelay(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int // 依次返回的状态码，用完后重复最后一个
+		wantStatus   string
+		wantAttempts int
+	}{
+		{name: "success", statuses: []int{http.StatusOK}, wantStatus: StatusSucceeded, wantAttempts: 1},
+		{name: "retry server errors", statuses: []int{500, 503, 204}, wantStatus: StatusSucceeded, wantAttempts: 3},
+		{name: "retry rate limited", statuses: []int{429, 200}, wantStatus: StatusSucceeded, wantAttempts: 2},
+		{name: "no retry on client error", statuses: []int{400}, wantStatus: StatusFailed, wantAttempts: 1},
+		{name: "redirect is a failure", statuses: []int{302}, wantStatus: StatusFailed, wantAttempts: 1},
+		{name: "give up after max attempts", statuses: []int{500}, wantStatus: StatusFailed, wantAttempts: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu       sync.Mutex
+				requests []*http.Request
+				bodies   [][]byte
+			)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				mu.Lock()
+				status := tt.statuses[min(len(requests), len(tt.statuses)-1)]
+				requests = append(requests, r)
+				bodies = append(bodies, body)
+				mu.Unlock()
+				if status == http.StatusFound {
+					w.Header().Set("Location", "/elsewhere")
+				}
+				w.WriteHeader(status)
+			}))
+			defer server.Close()
+
+			d, err := NewDispatcher(&config.WebhookConfig{
+				Secret:         "s3cret",
+				Endpoints:      []config.WebhookEndpointConfig{{URL: server.URL}},
+				MaxAttempts:    3,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     2 * time.Millisecond,
+			}, testLogger())
+			if err != nil {
+				t.Fatalf("NewDispatcher() error = %v", err)
+			}
+
+			d.Dispatch(EventCompleted, "req-1", "", map[string]string{"symbol": "NVDA"})
+			waitFinished(t, d)
+
+			deliveries := d.Deliveries("", 10)
+			if len(deliveries) != 1 {
+				t.Fatalf("deliveries = %d, want 1", len(deliveries))
+			}
+			delivery := deliveries[0]
+			if delivery.Status != tt.wantStatus || len(delivery.Attempts) != tt.wantAttempts {
+				t.Errorf("delivery status = %s with %d attempts, want %s with %d", delivery.Status, len(delivery.Attempts), tt.wantStatus, tt.wantAttempts)
+			}
+			if len(requests) != tt.wantAttempts {
+				t.Fatalf("requests = %d, want %d", len(requests), tt.wantAttempts)
+			}
+
+			// 每次尝试都带有可校验的签名和相同的事件ID
+			var envelope Envelope
+			if err := json.Unmarshal(bodies[0], &envelope); err != nil {
+				t.Fatalf("failed to decode payload: %v", err)
+			}
+			for i, r := range requests {
+				want := "sha256=" + Sign("s3cret", r.Header.Get(TimestampHeader), bodies[i])
+				if got := r.Header.Get(SignatureHeader); got != want {
+					t.Errorf("attempt %d signature = %s, want %s", i+1, got, want)
+				}
+				if r.Header.Get(EventHeader) != EventCompleted || r.Header.Get(DeliveryHeader) != delivery.ID {
+					t.Errorf("attempt %d headers = %v", i+1, r.Header)
+				}
+				if string(bodies[i]) != string(bodies[0]) {
+					t.Errorf("attempt %d body changed between retries", i+1)
+				}
+			}
+			if envelope.ID != delivery.EventID || envelope.RequestID != "req-1" {
+				t.Errorf("envelope = %+v, delivery = %+v", envelope, delivery)
+			}
+		})
+	}
+}
+
+func TestDispatcherEventFilter(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string][]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received[r.URL.Path] = append(received[r.URL.Path], r.Header.Get(EventHeader))
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	d, err := NewDispatcher(&config.WebhookConfig{
+		Secret: "s3cret",
+		Endpoints: []config.WebhookEndpointConfig{
+			{URL: server.URL + "/all"},
+			{URL: server.URL + "/failures", Secret: "own", Events: []string{EventFailed}},
+		},
+	}, testLogger())
+	if err != nil {
+		t.Fatalf("NewDispatcher() error = %v", err)
+	}
+
+	d.Dispatch(EventCompleted, "", "", nil)
+	d.Dispatch(EventFailed, "", "", nil)
+	waitFinished(t, d)
+
+	if got := strings.Join(received["/all"], ","); got != EventCompleted+","+EventFailed && got != EventFailed+","+EventCompleted {
+		t.Errorf("/all received %q", got)
+	}
+	if got := strings.Join(received["/failures"], ","); got != EventFailed {
+		t.Errorf("/failures received %q, want %s", got, EventFailed)
+	}
+}
+
+func TestNewDispatcherRequiresSecret(t *testing.T) {
+	_, err := NewDispatcher(&config.WebhookConfig{
+		Endpoints: []config.WebhookEndpointConfig{{URL: "https://hooks.example.com"}},
+	}, testLogger())
+	if err == nil {
+		t.Error("NewDispatcher() without any secret returned nil error")
+	}
+}
+
+func TestValidateCallbackURL(t *testing.T) {
+	d, err := NewDispatcher(&config.WebhookConfig{
+		Secret:           "s3cret",
+		AllowCallbackURL: true,
+		CallbackHosts:    []string{"hooks.example.com", "10.0.0.5", "203.0.113.10"},
+	}, testLogger())
+	if err != nil {
+		t.Fatalf("NewDispatcher() error = %v", err)
+	}
+	disabled, err := NewDispatcher(&config.WebhookConfig{Secret: "s3cret", CallbackHosts: []string{"hooks.example.com"}}, testLogger())
+	if err != nil {
+		t.Fatalf("NewDispatcher() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		dispatcher *Dispatcher
+		url        string
+		wantErr    bool
+	}{
+		{name: "allowed host", dispatcher: d, url: "https://hooks.example.com/capture"},
+		{name: "host is case insensitive", dispatcher: d, url: "https://HOOKS.example.com/capture"},
+		{name: "allowed public ip", dispatcher: d, url: "http://203.0.113.10:8080/hook"},
+		{name: "disabled", dispatcher: disabled, url: "https://hooks.example.com/capture", wantErr: true},
+		{name: "host not listed", dispatcher: d, url: "https://evil.example.com/capture", wantErr: true},
+		{name: "subdomain not listed", dispatcher: d, url: "https://a.hooks.example.com/capture", wantErr: true},
+		{name: "private ip even if listed", dispatcher: d, url: "http://10.0.0.5/hook", wantErr: true},
+		{name: "metadata address", dispatcher: d, url: "http://169.254.169.254/latest/meta-data", wantErr: true},
+		{name: "unsupported scheme", dispatcher: d, url: "ftp://hooks.example.com/capture", wantErr: true},
+		{name: "relative url", dispatcher: d, url: "/capture", wantErr: true},
+		{name: "userinfo host trick", dispatcher: d, url: "https://hooks.example.com@evil.example.com/", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.dispatcher.ValidateCallbackURL(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateCallbackURL(%q) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBlockedIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "127.0.0.1", want: true},
+		{ip: "::1", want: true},
+		{ip: "10.1.2.3", want: true},
+		{ip: "172.16.0.1", want: true},
+		{ip: "192.168.1.1", want: true},
+		{ip: "169.254.169.254", want: true},
+		{ip: "0.0.0.0", want: true},
+		{ip: "100.64.0.1", want: true},
+		{ip: "198.18.0.1", want: true},
+		{ip: "fd00::1", want: true},
+		{ip: "fe80::1", want: true},
+		{ip: "224.0.0.1", want: true},
+		{ip: "::ffff:127.0.0.1", want: true},
+		{ip: "203.0.113.10", want: false},
+		{ip: "8.8.8.8", want: false},
+		{ip: "2606:4700::1111", want: false},
+	}
+	for _, tt := range tests {
+		if got := blockedIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("blockedIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestCallbackClientRefusesInternalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// 回环地址上的服务：普通客户端可以访问，callback客户端在建立连接前拒绝
+	if resp, err := newClient(false).Get(server.URL); err != nil {
+		t.Fatalf("default client error = %v", err)
+	} else {
+		resp.Body.Close()
+	}
+	if resp, err := newClient(true).Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Error("callback client connected to a loopback address")
+	}
+}
@@ -0,0 +1,100 @@
+package webhook
+
+import (
+	"sync"
+	"time"
+)
+
+// 投递状态
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Delivery 一次webhook投递及其所有尝试
+type Delivery struct {
+	ID        string    `json:"id"`
+	EventID   string    `json:"event_id"`
+	Event     string    `json:"event"`
+	URL       string    `json:"url"`
+	RequestID string    `json:"request_id,omitempty"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"` // 最终失败原因
+	Attempts  []Attempt `json:"attempts"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Attempt 单次投递尝试
+type Attempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// deliveryLog 内存中的投递记录，超出容量时丢弃最早的记录
+type deliveryLog struct {
+	mu      sync.Mutex
+	entries []*Delivery // 环形缓冲区
+	next    int
+	full    bool
+}
+
+func newDeliveryLog(size int) *deliveryLog {
+	return &deliveryLog{entries: make([]*Delivery, size)}
+}
+
+func (l *deliveryLog) add(delivery *Delivery) *Delivery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delivery.UpdatedAt = delivery.CreatedAt
+	l.entries[l.next] = delivery
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+	return delivery
+}
+
+func (l *deliveryLog) addAttempt(delivery *Delivery, attempt Attempt) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	delivery.UpdatedAt = time.Now()
+}
+
+func (l *deliveryLog) finish(delivery *Delivery, status, reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delivery.Status = status
+	delivery.Error = reason
+	delivery.UpdatedAt = time.Now()
+}
+
+// list 按时间倒序复制记录
+func (l *deliveryLog) list(status string, limit int) []Delivery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	count := l.next
+	if l.full {
+		count = len(l.entries)
+	}
+
+	result := make([]Delivery, 0, min(count, limit))
+	for i := 1; i <= count && len(result) < limit; i++ {
+		delivery := l.entries[(l.next-i+len(l.entries))%len(l.entries)]
+		if status != "" && delivery.Status != status {
+			continue
+		}
+		copied := *delivery
+		copied.Attempts = append([]Attempt(nil), delivery.Attempts...)
+		result = append(result, copied)
+	}
+	return result
+}
@@ -1,33 +1,71 @@
 package utils
 
 import (
+	"fmt"
+	"io"
 	"os"
 
 	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-var logger *logrus.Logger
+// LogConfig 日志配置
+type LogConfig struct {
+	Level  string
+	Format string
+	Output string // stdout（默认）、stderr、syslog、journald，其他值视为日志文件路径
 
-func init() {
-	logger = logrus.New()
+	// 输出到文件时的轮转配置
+	MaxSizeMB  int
+	MaxAgeDays int
+	MaxBackups int
+	Compress   bool
 
-	// 设置日志格式
-	logger.SetFormatter(&logrus.JSONFormatter{})
+	// syslog输出配置，SyslogNetwork为空时使用本机syslog/journald套接字
+	SyslogNetwork string
+	SyslogAddress string
+	SyslogTag     string
+}
+
+// NewLogger 按日志配置创建独立的日志实例，由调用方注入到各组件
+func NewLogger(cfg LogConfig) (*logrus.Logger, error) {
+	logger := logrus.New()
 
-	// 设置日志级别
-	logger.SetLevel(logrus.InfoLevel)
+	ApplyLogLevel(logger, cfg.Level)
+	ApplyLogFormat(logger, cfg.Format)
 
 	// 设置输出
-	logger.SetOutput(os.Stdout)
-}
+	switch cfg.Output {
+	case "", "stdout":
+		logger.SetOutput(os.Stdout)
+	case "stderr":
+		logger.SetOutput(os.Stderr)
+	case "syslog", "journald":
+		// journald接管本机syslog套接字，两者都通过hook按级别写入，不再输出到stdout
+		network, address := cfg.SyslogNetwork, cfg.SyslogAddress
+		if cfg.Output == "journald" {
+			network, address = "", ""
+		}
+		if err := addSyslogHook(logger, network, address, cfg.SyslogTag); err != nil {
+			return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		logger.SetOutput(io.Discard)
+	default:
+		logger.SetOutput(&lumberjack.Logger{
+			Filename:   cfg.Output,
+			MaxSize:    cfg.MaxSizeMB,
+			MaxAge:     cfg.MaxAgeDays,
+			MaxBackups: cfg.MaxBackups,
+			Compress:   cfg.Compress,
+			LocalTime:  true,
+		})
+	}
 
-// GetLogger 获取日志实例
-func GetLogger() *logrus.Logger {
-	return logger
+	return logger, nil
 }
 
-// SetLogLevel 设置日志级别
-func SetLogLevel(level string) {
+// ApplyLogLevel 设置日志级别
+func ApplyLogLevel(logger *logrus.Logger, level string) {
 	switch level {
 	case "debug":
 		logger.SetLevel(logrus.DebugLevel)
@@ -42,8 +80,8 @@ func SetLogLevel(level string) {
 	}
 }
 
-// SetLogFormat 设置日志格式
-func SetLogFormat(format string) {
+// ApplyLogFormat 设置日志格式
+func ApplyLogFormat(logger *logrus.Logger, format string) {
 	switch format {
 	case "json":
 		logger.SetFormatter(&logrus.JSONFormatter{})
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+func TestNewLoggerOutput(t *testing.T) {
+	tests := []struct {
+		output string
+		want   interface{}
+	}{
+		{output: "", want: os.Stdout},
+		{output: "stdout", want: os.Stdout},
+		{output: "stderr", want: os.Stderr},
+	}
+	for _, tt := range tests {
+		logger, err := NewLogger(LogConfig{Output: tt.output})
+		if err != nil {
+			t.Fatalf("NewLogger(%q) error = %v", tt.output, err)
+		}
+		if logger.Out != tt.want {
+			t.Errorf("NewLogger(%q) output = %T", tt.output, logger.Out)
+		}
+	}
+}
+
+func TestNewLoggerFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "screenshot-server.log")
+	logger, err := NewLogger(LogConfig{Level: "debug", Format: "json", Output: path, MaxSizeMB: 1, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+	file, ok := logger.Out.(*lumberjack.Logger)
+	if !ok {
+		t.Fatalf("NewLogger() output = %T, want a rotating file", logger.Out)
+	}
+	defer file.Close()
+
+	logger.WithField("symbol", "NVDA").Debug("Chart image saved")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatalf("log line %q is not JSON: %v", data, err)
+	}
+	if entry["msg"] != "Chart image saved" || entry["symbol"] != "NVDA" || entry["level"] != "debug" {
+		t.Errorf("log entry = %v", entry)
+	}
+
+	// 超过max_size_mb后轮转，旧文件保留在同一目录
+	padding := strings.Repeat("x", 64<<10)
+	for i := 0; i < 20; i++ {
+		logger.WithField("padding", padding).Info("Filling log file")
+	}
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(path), "screenshot-server-*.log"))
+	if err != nil || len(matches) == 0 {
+		t.Errorf("no rotated log file found: %v", err)
+	}
+}
+
+func TestApplyLogLevelAndFormat(t *testing.T) {
+	logger := logrus.New()
+
+	levels := map[string]logrus.Level{
+		"debug": logrus.DebugLevel,
+		"warn":  logrus.WarnLevel,
+		"error": logrus.ErrorLevel,
+		"":      logrus.InfoLevel,
+		"trace": logrus.InfoLevel,
+	}
+	for level, want := range levels {
+		ApplyLogLevel(logger, level)
+		if logger.GetLevel() != want {
+			t.Errorf("ApplyLogLevel(%q) = %s, want %s", level, logger.GetLevel(), want)
+		}
+	}
+
+	ApplyLogFormat(logger, "text")
+	if _, ok := logger.Formatter.(*logrus.TextFormatter); !ok {
+		t.Errorf("ApplyLogFormat(text) = %T", logger.Formatter)
+	}
+	ApplyLogFormat(logger, "")
+	if _, ok := logger.Formatter.(*logrus.JSONFormatter); !ok {
+		t.Errorf("ApplyLogFormat() = %T, want JSON by default", logger.Formatter)
+	}
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RequestIDHeader 请求ID的HTTP头，由调用方传入或服务端生成，并透传给图表服务
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+type loggerKey struct{}
+
+// NewRequestID 生成随机请求ID
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithRequestID 将请求ID放入上下文
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID 获取上下文中的请求ID，不在请求中时返回空字符串
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithLogger 将请求范围的日志放入上下文
+func WithLogger(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey{}, entry)
+}
+
+// LoggerFromContext 获取请求范围的日志（带request_id字段），不在请求中时使用logger
+func LoggerFromContext(ctx context.Context, logger *logrus.Logger) *logrus.Entry {
+	if entry, ok := ctx.Value(loggerKey{}).(*logrus.Entry); ok && entry != nil {
+		return entry
+	}
+	return logrus.NewEntry(logger)
+}
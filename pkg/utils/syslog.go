@@ -0,0 +1,20 @@
+//go:build !windows && !plan9
+
+package utils
+
+import (
+	"log/syslog"
+
+	"github.com/sirupsen/logrus"
+	logrussyslog "github.com/sirupsen/logrus/hooks/syslog"
+)
+
+// addSyslogHook 将日志按级别写入syslog，network为空时使用本机套接字（journald）
+func addSyslogHook(logger *logrus.Logger, network, address, tag string) error {
+	hook, err := logrussyslog.NewSyslogHook(network, address, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return err
+	}
+	logger.AddHook(hook)
+	return nil
+}
@@ -0,0 +1,50 @@
+//go:build !windows && !plan9
+
+package utils
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewLoggerSyslog(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket() error = %v", err)
+	}
+	defer conn.Close()
+
+	logger, err := NewLogger(LogConfig{
+		Output:        "syslog",
+		SyslogNetwork: "udp",
+		SyslogAddress: conn.LocalAddr().String(),
+		SyslogTag:     "screenshot-server",
+	})
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+	// 写入syslog后不再输出到stdout
+	if logger.Out != io.Discard {
+		t.Errorf("NewLogger() output = %T, want io.Discard", logger.Out)
+	}
+
+	logger.Warn("Chart service is slow")
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("ReadFrom() error = %v", err)
+	}
+	message := string(buf[:n])
+	if !strings.Contains(message, "screenshot-server") || !strings.Contains(message, "Chart service is slow") {
+		t.Errorf("syslog message = %q", message)
+	}
+	// LOG_DAEMON|LOG_WARNING = 3*8+4
+	if !strings.HasPrefix(message, "<28>") {
+		t.Errorf("syslog message %q does not have warning priority", message)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build windows || plan9
+
+package utils
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/sirupsen/logrus"
+)
+
+// addSyslogHook 当前平台不支持syslog
+func addSyslogHook(logger *logrus.Logger, network, address, tag string) error {
+	return fmt.Errorf("syslog output is not supported on %s", runtime.GOOS)
+}
@@ -22,11 +22,10 @@ echo "📝 请编辑 .env 文件，填入实际配置："
 echo "   nano .env"
 echo ""
 echo "🔑 必需的配置项："
-echo "   - AWS_ACCESS_KEY_ID"
-echo "   - AWS_SECRET_ACCESS_KEY"
-echo "   - AWS_S3_BUCKET"
-echo "   - CDN_BASE_URL"
-echo "   - MAFIT_JWT_TOKEN"
+echo "   - SCREENSHOT_S3_ACCESS_KEY_ID"
+echo "   - SCREENSHOT_S3_SECRET_ACCESS_KEY"
+echo "   - SCREENSHOT_S3_BUCKET"
+echo "   - SCREENSHOT_CDN_BASE_URL"
 echo ""
 echo "🚀 配置完成后，可以启动服务："
 echo "   docker compose up -d"